@@ -0,0 +1,123 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
+)
+
+// Usage describes the administrative commands of the backend
+const Usage = `commands:
+  user create [-mail mail] [-role role] [-password password] <username>
+  user reset-password [-password password] <username>
+  user deactivate <username>
+  scenario export [-o file] <scenarioID>
+  scenario import -owner <username> <file>
+  migrate [status | up [version] | down [version]]
+  db check
+  files migrate-storage -to db|s3|local
+  groups sync [file]
+
+Generated passwords are printed if no password is given.`
+
+type command struct {
+	run func(args []string) error
+	// false for commands which work with an outdated schema of the database
+	requiresSchema bool
+}
+
+var commands = map[string]command{
+	"user":     {run: userCommand, requiresSchema: true},
+	"scenario": {run: scenarioCommand, requiresSchema: true},
+	"migrate":  {run: migrateCommand},
+	"db":       {run: dbCommand},
+	"files":    {run: filesCommand, requiresSchema: true},
+	"groups":   {run: groupsCommand, requiresSchema: true},
+}
+
+var errUsage = errors.New(Usage)
+
+// Run runs the administrative command given by the positional arguments of the backend
+func Run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %v\n\n%v", args[0], Usage)
+	}
+	// all commands but migrate require a subcommand
+	if len(args) == 1 && args[0] != "migrate" {
+		return errUsage
+	}
+
+	err := database.ConnectDB(configuration.GlobalConfig)
+	if err != nil {
+		return err
+	}
+	defer database.DBpool.Close()
+
+	if cmd.requiresSchema {
+		version, err := database.GetSchemaVersion()
+		if err != nil {
+			return err
+		}
+		if version != database.LatestSchemaVersion() {
+			return fmt.Errorf("the database has the schema version %v instead of %v, run the migrate command first",
+				version, database.LatestSchemaVersion())
+		}
+	}
+
+	err = cmd.run(args[1:])
+
+	// wait for the jobs submitted by the command (e.g. uploads of files to the S3 object storage)
+	jobs.Wait()
+
+	return err
+}
+
+// newFlagSet returns the flag set of a command which reports errors instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {}
+	return fs
+}
+
+// parseArgs parses the flags of a command and returns its positional arguments,
+// the number of positional arguments has to match
+func parseArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return nil, errUsage
+	} else if err != nil {
+		return nil, fmt.Errorf("%v\n\n%v", err, Usage)
+	}
+
+	if fs.NArg() != n {
+		return nil, errUsage
+	}
+
+	return fs.Args(), nil
+}
@@ -0,0 +1,226 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	err := configuration.InitConfig()
+	if err != nil {
+		panic(m)
+	}
+
+	err = database.InitDB(configuration.GlobalConfig, true)
+	if err != nil {
+		panic(m)
+	}
+	defer database.DBpool.Close()
+
+	os.Exit(m.Run())
+}
+
+func TestRun(t *testing.T) {
+	// usage errors are reported without connecting to the database
+	assert.Error(t, Run(nil))
+	assert.Error(t, Run([]string{"unknown"}))
+	assert.Error(t, Run([]string{"user"}))
+}
+
+func TestUserCommand(t *testing.T) {
+
+	database.DropTables()
+	assert.NoError(t, database.MigrateModels())
+
+	assert.NoError(t, userCommand([]string{"create", "-role", "Admin", "-mail", "alice@example.com", "-password", "secret", "alice"}))
+
+	var u database.User
+	assert.NoError(t, database.DBpool.Find(&u, "username = ?", "alice").Error)
+	assert.Equal(t, "Admin", u.Role)
+	assert.Equal(t, "alice@example.com", u.Mail)
+	assert.True(t, u.Active)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(u.Password), []byte("secret")))
+
+	// the username is taken, the role is invalid or the username is missing
+	assert.Error(t, userCommand([]string{"create", "-password", "secret", "alice"}))
+	assert.Error(t, userCommand([]string{"create", "-role", "Superuser", "bob"}))
+	assert.Error(t, userCommand([]string{"create", "-role", "User"}))
+
+	// a password is generated if none is given
+	assert.NoError(t, userCommand([]string{"create", "bob"}))
+	assert.NoError(t, database.DBpool.Find(&u, "username = ?", "bob").Error)
+	assert.Equal(t, "User", u.Role)
+	assert.NotEmpty(t, u.Password)
+
+	assert.NoError(t, userCommand([]string{"reset-password", "-password", "newsecret", "alice"}))
+	assert.NoError(t, database.DBpool.Find(&u, "username = ?", "alice").Error)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(u.Password), []byte("newsecret")))
+
+	assert.NoError(t, userCommand([]string{"reset-password", "alice"}))
+	assert.NoError(t, database.DBpool.Find(&u, "username = ?", "alice").Error)
+	assert.Error(t, bcrypt.CompareHashAndPassword([]byte(u.Password), []byte("newsecret")))
+
+	assert.NoError(t, userCommand([]string{"deactivate", "alice"}))
+	assert.NoError(t, database.DBpool.Find(&u, "username = ?", "alice").Error)
+	assert.False(t, u.Active)
+
+	assert.Error(t, userCommand([]string{"reset-password", "-password", "secret", "nobody"}))
+	assert.Error(t, userCommand([]string{"deactivate", "nobody"}))
+	assert.Error(t, userCommand([]string{"delete", "alice"}))
+}
+
+func TestScenarioCommand(t *testing.T) {
+
+	database.DropTables()
+	assert.NoError(t, database.MigrateModels())
+	assert.NoError(t, database.AddTestUsers())
+
+	so := database.Scenario{Name: "Scenario1"}
+	assert.NoError(t, database.DBpool.Create(&so).Error)
+	dashboard := database.Dashboard{Name: "Dashboard1", Grid: 15, ScenarioID: so.ID}
+	assert.NoError(t, database.DBpool.Create(&dashboard).Error)
+
+	archive := filepath.Join(t.TempDir(), "scenario.json")
+	assert.NoError(t, scenarioCommand([]string{"export", "-o", archive, fmt.Sprint(so.ID)}))
+	assert.Error(t, scenarioCommand([]string{"export", "-o", archive, "42"}))
+	assert.Error(t, scenarioCommand([]string{"export", "abc"}))
+
+	// the owner is required and has to exist
+	assert.Error(t, scenarioCommand([]string{"import", archive}))
+	assert.Error(t, scenarioCommand([]string{"import", "-owner", "nobody", archive}))
+
+	assert.NoError(t, scenarioCommand([]string{"import", "-owner", database.UserA.Username, archive}))
+
+	var imported database.Scenario
+	assert.NoError(t, database.DBpool.Where("id <> ?", so.ID).Find(&imported).Error)
+	assert.Equal(t, "Scenario1", imported.Name)
+
+	var dashboards []database.Dashboard
+	assert.NoError(t, database.DBpool.Where("scenario_id = ?", imported.ID).Find(&dashboards).Error)
+	assert.Len(t, dashboards, 1)
+
+	var u database.User
+	assert.NoError(t, database.DBpool.Find(&u, "username = ?", database.UserA.Username).Error)
+	_, err := database.GetScenarioMembership(imported.ID, u.ID)
+	assert.NoError(t, err)
+}
+
+func TestDBCommand(t *testing.T) {
+
+	database.DropTables()
+	assert.NoError(t, database.MigrateModels())
+
+	assert.NoError(t, dbCommand([]string{"check"}))
+
+	// a dashboard of a scenario which does not exist
+	dashboard := database.Dashboard{Name: "Dashboard1", Grid: 15, ScenarioID: 42}
+	assert.NoError(t, database.DBpool.Create(&dashboard).Error)
+	assert.Error(t, dbCommand([]string{"check"}))
+
+	assert.Error(t, dbCommand([]string{"repair"}))
+}
+
+func TestGroupsCommand(t *testing.T) {
+
+	database.DropTables()
+	assert.NoError(t, database.MigrateModels())
+
+	so := database.Scenario{Name: "Scenario1"}
+	assert.NoError(t, database.DBpool.Create(&so).Error)
+
+	groups := filepath.Join(t.TempDir(), "groups.yaml")
+	assert.NoError(t, os.WriteFile(groups, []byte("groups:\n  students:\n  - scenario: 1\n    role: viewer\n"), 0644))
+	assert.NoError(t, groupsCommand([]string{"sync", groups}))
+
+	var ug database.UserGroup
+	assert.NoError(t, database.DBpool.Find(&ug, "name = ?", "students").Error)
+	var mappings []database.ScenarioMapping
+	assert.NoError(t, database.DBpool.Where("user_group_id = ?", ug.ID).Find(&mappings).Error)
+	if assert.Len(t, mappings, 1) {
+		assert.Equal(t, so.ID, mappings[0].ScenarioID)
+		assert.Equal(t, database.ScenarioViewer, mappings[0].Role)
+	}
+
+	// the mappings of existing groups are replaced
+	assert.NoError(t, os.WriteFile(groups, []byte("groups:\n  students:\n  - scenario: 1\n    role: editor\n"), 0644))
+	assert.NoError(t, groupsCommand([]string{"sync", groups}))
+	assert.NoError(t, database.DBpool.Where("user_group_id = ?", ug.ID).Find(&mappings).Error)
+	if assert.Len(t, mappings, 1) {
+		assert.Equal(t, database.ScenarioEditor, mappings[0].Role)
+	}
+
+	// invalid roles and scenarios
+	assert.NoError(t, os.WriteFile(groups, []byte("groups:\n  students:\n  - scenario: 1\n    role: admin\n"), 0644))
+	assert.Error(t, groupsCommand([]string{"sync", groups}))
+	assert.NoError(t, os.WriteFile(groups, []byte("groups:\n  students:\n  - scenario: 42\n"), 0644))
+	assert.Error(t, groupsCommand([]string{"sync", groups}))
+
+	assert.Error(t, groupsCommand([]string{"sync", filepath.Join(t.TempDir(), "missing.yaml")}))
+}
+
+func TestFilesCommand(t *testing.T) {
+
+	database.DropTables()
+	assert.NoError(t, database.MigrateModels())
+
+	t.Setenv("FILE_STORAGE_PATH", t.TempDir())
+
+	data := []byte("This is my testfile\n")
+	f := database.File{Name: "testfile.txt", Size: uint(len(data)), FileData: data}
+	assert.NoError(t, database.GetDB().Create(&f).Error)
+
+	// move the file from the database to the local storage
+	assert.NoError(t, filesCommand([]string{"migrate-storage", "-to", "local"}))
+
+	var moved database.File
+	assert.NoError(t, database.GetDB().Find(&moved, f.ID).Error)
+	assert.Equal(t, "local", moved.Storage)
+	assert.Empty(t, moved.FileData)
+	stored, err := os.ReadFile(filepath.Join(os.Getenv("FILE_STORAGE_PATH"), moved.Key))
+	assert.NoError(t, err)
+	assert.Equal(t, data, stored)
+
+	// and back to the database
+	assert.NoError(t, filesCommand([]string{"migrate-storage", "-to", "db"}))
+	assert.NoError(t, database.GetDB().Find(&moved, f.ID).Error)
+	assert.Equal(t, "db", moved.Storage)
+	assert.Equal(t, data, moved.FileData)
+
+	assert.Error(t, filesCommand([]string{"migrate-storage", "-to", "ftp"}))
+	assert.Error(t, filesCommand([]string{"migrate-storage"}))
+}
+
+func TestMigrateCommand(t *testing.T) {
+
+	database.DropTables()
+	assert.NoError(t, database.MigrateModels())
+
+	assert.NoError(t, migrateCommand(nil))
+	assert.NoError(t, migrateCommand([]string{"up"}))
+	assert.Error(t, migrateCommand([]string{"sideways"}))
+	assert.Error(t, migrateCommand([]string{"up", "abc"}))
+}
@@ -0,0 +1,117 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package commands
+
+import (
+	"fmt"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+)
+
+// reference is a column referencing the rows of a parent table
+type reference struct {
+	table  string
+	column string
+	parent string
+	// true if the rows of the table are soft deleted, join tables keep the rows of
+	// deleted users and of scenarios in the trash
+	softDeleted bool
+}
+
+var references = []reference{
+	{"user_scenarios", "user_id", "users", false},
+	{"user_scenarios", "scenario_id", "scenarios", false},
+	{"user_groups_users", "user_id", "users", false},
+	{"user_groups_users", "user_group_id", "user_groups", false},
+	{"scenario_mappings", "scenario_id", "scenarios", true},
+	{"scenario_mappings", "user_group_id", "user_groups", true},
+	{"component_configurations", "scenario_id", "scenarios", true},
+	{"signals", "config_id", "component_configurations", true},
+	{"dashboards", "scenario_id", "scenarios", true},
+	{"widgets", "dashboard_id", "dashboards", true},
+	{"files", "scenario_id", "scenarios", true},
+	{"results", "scenario_id", "scenarios", true},
+}
+
+// dbCommand checks the connection to the database, its schema version and the consistency of its data
+func dbCommand(args []string) error {
+	if len(args) != 1 || args[0] != "check" {
+		return errUsage
+	}
+
+	db := database.GetDB()
+	err := db.DB().Ping()
+	if err != nil {
+		return fmt.Errorf("database not reachable: %v", err)
+	}
+	fmt.Println("OK    connection to the database")
+
+	problems := 0
+	version, err := database.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version == database.LatestSchemaVersion() {
+		fmt.Printf("OK    schema version %v\n", version)
+	} else {
+		fmt.Printf("FAIL  schema version %v instead of %v, run the migrate command\n", version, database.LatestSchemaVersion())
+		// the consistency of the data cannot be checked without the tables
+		return fmt.Errorf("1 problem found")
+	}
+
+	for _, ref := range references {
+		// rows referencing a parent which does not exist,
+		// rows which are not in the trash must not reference a parent in the trash
+		query := fmt.Sprintf("SELECT count(*) FROM %v c WHERE NOT EXISTS (SELECT 1 FROM %v p WHERE p.id = c.%v)",
+			ref.table, ref.parent, ref.column)
+		if ref.softDeleted {
+			query = fmt.Sprintf("SELECT count(*) FROM %v c WHERE c.deleted_at IS NULL AND NOT EXISTS "+
+				"(SELECT 1 FROM %v p WHERE p.id = c.%v AND p.deleted_at IS NULL)", ref.table, ref.parent, ref.column)
+		}
+
+		var count int
+		err = db.Raw(query).Row().Scan(&count)
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			fmt.Printf("OK    %v.%v references %v\n", ref.table, ref.column, ref.parent)
+		} else {
+			fmt.Printf("FAIL  %v rows of %v reference missing %v by %v\n", count, ref.table, ref.parent, ref.column)
+			problems++
+		}
+	}
+
+	var count int
+	err = db.Model(&database.File{}).Where(`storage = 'db' AND "FileData" IS NULL AND size > 0`).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Println("OK    data of files")
+	} else {
+		fmt.Printf("FAIL  %v files of the db storage have no data in the database\n", count)
+		problems++
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%v problems found", problems)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/file"
+)
+
+// filesCommand moves the data of all files to a storage driver (e.g. from the database to the local storage)
+func filesCommand(args []string) error {
+	if len(args) == 0 || args[0] != "migrate-storage" {
+		return errUsage
+	}
+
+	fs := newFlagSet("files migrate-storage")
+	to := fs.String("to", "", "Storage to which the files are moved (db, s3 or local)")
+	_, err := parseArgs(fs, args[1:], 0)
+	if err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("the storage to which the files are moved is required\n\n%v", Usage)
+	}
+
+	moved, skipped, err := file.MigrateStorage(context.Background(), *to)
+	fmt.Printf("Moved %v files to %v\n", moved, *to)
+	if len(skipped) > 0 {
+		fmt.Printf("Skipped %v files whose data is not stored yet, run the migration again once they are stored: %v\n",
+			len(skipped), skipped)
+	}
+	return err
+}
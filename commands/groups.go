@@ -0,0 +1,54 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package commands
+
+import (
+	"fmt"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/usergroup"
+)
+
+// groupsCommand synchronizes the user groups and their scenario mappings with the groups file
+// (default is the file of the groups-path parameter)
+func groupsCommand(args []string) error {
+	if len(args) == 0 || args[0] != "sync" || len(args) > 2 {
+		return errUsage
+	}
+
+	path, _ := configuration.GlobalConfig.String("groups.path")
+	if len(args) == 2 {
+		path = args[1]
+	}
+	if path == "" {
+		return fmt.Errorf("no groups file given, use the groups-path parameter or pass the file to the command")
+	}
+
+	err := configuration.ReadGroupsFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = usergroup.SyncGroups(configuration.ScenarioGroupMap)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Synchronized %v user groups with %v\n", len(configuration.ScenarioGroupMap), path)
+	return nil
+}
@@ -0,0 +1,119 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+)
+
+// migrateCommand shows the applied and pending migrations, applies the pending migrations
+// (up to the given version) or reverts the last migration (or all migrations after the given version)
+func migrateCommand(args []string) error {
+	if len(args) > 2 {
+		return errUsage
+	}
+
+	current, err := database.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	target := database.LatestSchemaVersion()
+	if command == "down" {
+		target = 0
+		if current > 0 {
+			status, err := database.GetMigrationStatus()
+			if err != nil {
+				return err
+			}
+			// the version of the migration applied before the current one
+			for _, m := range status {
+				if m.AppliedAt != nil && m.Version < current {
+					target = m.Version
+				}
+			}
+		}
+	}
+	if len(args) > 1 {
+		version, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid version %v", args[1])
+		}
+		target = uint(version)
+	}
+
+	switch command {
+	case "status":
+		if len(args) > 1 {
+			return errUsage
+		}
+		return printMigrationStatus(current)
+	case "up":
+		err = database.MigrateUp(target)
+	case "down":
+		err = database.MigrateDown(target)
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err = database.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Schema version is %v (latest version is %v)\n", current, database.LatestSchemaVersion())
+
+	return nil
+}
+
+func printMigrationStatus(current uint) error {
+	status, err := database.GetMigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, m := range status {
+		applied := "pending"
+		if m.AppliedAt != nil {
+			applied = m.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", m.Version, m.Name, applied)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version is %v (latest version is %v)\n", current, database.LatestSchemaVersion())
+	return nil
+}
@@ -0,0 +1,111 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	scenario_transfer "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario-transfer"
+)
+
+// scenarioCommand exports a scenario to an archive or imports a scenario from an archive,
+// the archives are the same as those of the export and import endpoints
+func scenarioCommand(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "export":
+		fs := newFlagSet("scenario export")
+		output := fs.String("o", "", "File to which the archive is written (default is stdout)")
+		pos, err := parseArgs(fs, args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		scenarioID, err := strconv.ParseUint(pos[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid scenario ID %v", pos[0])
+		}
+
+		archive, err := scenario_transfer.ExportScenario(uint(scenarioID))
+		if err != nil {
+			return fmt.Errorf("failed to export scenario %v: %v", scenarioID, err)
+		}
+
+		data, err := json.MarshalIndent(archive, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if *output == "" {
+			_, err = os.Stdout.Write(append(data, '\n'))
+			return err
+		}
+
+		err = os.WriteFile(*output, data, 0644)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Exported scenario %v to %v\n", scenarioID, *output)
+		}
+		return err
+
+	case "import":
+		fs := newFlagSet("scenario import")
+		owner := fs.String("owner", "", "Username of the owner of the imported scenario")
+		pos, err := parseArgs(fs, args[1:], 1)
+		if err != nil {
+			return err
+		}
+		if *owner == "" {
+			return fmt.Errorf("the owner of the imported scenario is required\n\n%v", Usage)
+		}
+
+		var u database.User
+		err = database.GetDB().Find(&u, "username = ?", *owner).Error
+		if err != nil {
+			return fmt.Errorf("failed to find user %v: %v", *owner, err)
+		}
+
+		data, err := os.ReadFile(pos[0])
+		if err != nil {
+			return err
+		}
+
+		var archive scenario_transfer.ScenarioArchive
+		err = json.Unmarshal(data, &archive)
+		if err != nil {
+			return fmt.Errorf("failed to parse archive %v: %v", pos[0], err)
+		}
+
+		so, err := scenario_transfer.ImportScenario(archive, &u)
+		if err != nil {
+			return fmt.Errorf("failed to import scenario: %v", err)
+		}
+
+		fmt.Printf("Imported scenario %v with ID %v owned by %v\n", so.Name, so.ID, u.Username)
+		return nil
+
+	default:
+		return errUsage
+	}
+}
@@ -0,0 +1,109 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package commands
+
+import (
+	"fmt"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+)
+
+// userCommand creates a user, resets the password of a user or deactivates a user
+func userCommand(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "create":
+		fs := newFlagSet("user create")
+		mail := fs.String("mail", "", "Mail address of the user")
+		role := fs.String("role", "User", "Role of the user (Admin, User or Guest)")
+		password := fs.String("password", "", "Password of the user (generated if empty)")
+		pos, err := parseArgs(fs, args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		if *role != "Admin" && *role != "User" && *role != "Guest" {
+			return fmt.Errorf("invalid role %v, the role has to be Admin, User or Guest", *role)
+		}
+
+		pw := passwordOrGenerate(*password)
+		u, err := user.NewUser(pos[0], pw, *mail, *role, true)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created user %v with ID %v and role %v\n", u.Username, u.ID, u.Role)
+		printGeneratedPassword(*password, pw)
+		return nil
+
+	case "reset-password":
+		fs := newFlagSet("user reset-password")
+		password := fs.String("password", "", "New password of the user (generated if empty)")
+		pos, err := parseArgs(fs, args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		pw := passwordOrGenerate(*password)
+		u, err := user.ResetPassword(pos[0], pw)
+		if err != nil {
+			return fmt.Errorf("failed to reset the password of user %v: %v", pos[0], err)
+		}
+
+		fmt.Printf("Reset the password of user %v\n", u.Username)
+		if !u.Active {
+			fmt.Printf("Note: user %v is inactive and cannot log in\n", u.Username)
+		}
+		printGeneratedPassword(*password, pw)
+		return nil
+
+	case "deactivate":
+		pos, err := parseArgs(newFlagSet("user deactivate"), args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		u, err := user.Deactivate(pos[0])
+		if err != nil {
+			return fmt.Errorf("failed to deactivate user %v: %v", pos[0], err)
+		}
+
+		fmt.Printf("Deactivated user %v\n", u.Username)
+		return nil
+
+	default:
+		return errUsage
+	}
+}
+
+func passwordOrGenerate(password string) string {
+	if password != "" {
+		return password
+	}
+	return database.GeneratePassword(16)
+}
+
+func printGeneratedPassword(given string, password string) {
+	if given == "" {
+		fmt.Printf("Generated password: %v\n", password)
+	}
+}
@@ -26,18 +26,39 @@ import (
 	"strings"
 
 	"github.com/zpatrick/go-config"
+	"gopkg.in/yaml.v3"
 )
 
 // Global configuration
 var GlobalConfig *config.Config = nil
 
 type GroupedScenario struct {
-	Scenario  int  `yaml:"scenario"`
-	Duplicate bool `default:"false" yaml:"duplicate"`
+	Scenario  int    `yaml:"scenario"`
+	Duplicate bool   `default:"false" yaml:"duplicate"`
+	Role      string `yaml:"role"`
 }
 
 var ScenarioGroupMap = map[string][]GroupedScenario{}
 
+// ReadGroupsFile reads the YAML file which maps user groups to scenario IDs into ScenarioGroupMap
+func ReadGroupsFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var groups struct {
+		Groups map[string][]GroupedScenario `yaml:"groups"`
+	}
+	err = yaml.Unmarshal(data, &groups)
+	if err != nil {
+		return fmt.Errorf("failed to parse groups file %v: %v", path, err)
+	}
+
+	ScenarioGroupMap = groups.Groups
+	return nil
+}
+
 func InitConfig() error {
 	if GlobalConfig != nil {
 		return nil
@@ -54,6 +75,7 @@ func InitConfig() error {
 		amqpHost                 = flag.String("amqp-host", "", "If set, use this as host for AMQP broker (default is disabled)")
 		amqpUser                 = flag.String("amqp-user", "", "Username for AMQP broker")
 		amqpPass                 = flag.String("amqp-pass", "", "Password for AMQP broker")
+		amqpActionTimeout        = flag.String("amqp-action-timeout", "1m", "Time after which an action sent to an IC times out if the IC does not acknowledge it")
 		configFile               = flag.String("config", "", "Path to YAML configuration file")
 		port                     = flag.String("port", "4000", "Port of the backend (default is 4000)")
 		adminUser                = flag.String("admin-user", "", "Initial admin username")
@@ -65,11 +87,35 @@ func InitConfig() error {
 		s3Region                 = flag.String("s3-region", "default", "S3 Region for file uploads")
 		s3NoSSL                  = flag.Bool("s3-nossl", false, "Use encrypted connections to the S3 API")
 		s3PathStyle              = flag.Bool("s3-pathstyle", false, "Use path-style S3 API")
+		fileStorage              = flag.String("file-storage", "", "Storage of uploaded files: db, s3 or local (default is s3 if an S3 bucket is set, db otherwise)")
+		fileStoragePath          = flag.String("file-storage-path", "files", "Directory in which the local storage keeps uploaded files")
 		jwtSecret                = flag.String("jwt-secret", "This should NOT be here!!@33$8&", "The JSON Web Token secret")
 		jwtExpiresAfter          = flag.String("jwt-expires-after", "168h" /* 1 week */, "The time after which the JSON Web Token expires")
+		jwtRefreshExpiresAfter   = flag.String("jwt-refresh-expires-after", "720h" /* 30 days */, "The time after which the refresh token of a session expires")
 		authExternal             = flag.Bool("auth-external", false, "Use external authentication via X-Forwarded-User header (e.g. OAuth2 Proxy)")
 		authExternalLoginURL     = flag.String("auth-external-login-url", "/oauth2/start", "A URL to initiate external login procedure")
 		authExternalProviderName = flag.String("auth-external-provider-name", "JupyterHub", "A name of the external authentication provider")
+		authOIDC                 = flag.Bool("auth-oidc", false, "Use OpenID Connect authentication (authorization code flow with PKCE)")
+		authOIDCIssuer           = flag.String("auth-oidc-issuer", "", "Issuer URL of the OpenID Connect provider")
+		authOIDCClientID         = flag.String("auth-oidc-client-id", "", "Client ID of the backend at the OpenID Connect provider")
+		authOIDCClientSecret     = flag.String("auth-oidc-client-secret", "", "Client secret of the backend at the OpenID Connect provider (empty for public clients)")
+		authOIDCRedirectURL      = flag.String("auth-oidc-redirect-url", "", "URL the OpenID Connect provider redirects to after login, must pass code and state to POST /authenticate/oidc")
+		authOIDCScopes           = flag.String("auth-oidc-scopes", "openid,profile,email,groups", "Scopes requested from the OpenID Connect provider (comma-separated list)")
+		authOIDCGroupsClaim      = flag.String("auth-oidc-groups-claim", "groups", "Claim of the OpenID Connect provider containing the groups of a user")
+		authOIDCAdminGroup       = flag.String("auth-oidc-admin-group", "admin", "Group of the OpenID Connect provider whose members become admins on first login")
+		authOIDCProviderName     = flag.String("auth-oidc-provider-name", "OpenID Connect", "A name of the OpenID Connect provider")
+		authLDAP                 = flag.Bool("auth-ldap", false, "Use LDAP authentication")
+		authLDAPURL              = flag.String("auth-ldap-url", "ldap://localhost:389", "URL of the LDAP server (ldap:// or ldaps://)")
+		authLDAPStartTLS         = flag.Bool("auth-ldap-start-tls", false, "Encrypt connections to ldap:// URLs with StartTLS")
+		authLDAPBindDN           = flag.String("auth-ldap-bind-dn", "", "DN used to search the directory (empty for anonymous searches)")
+		authLDAPBindPass         = flag.String("auth-ldap-bind-pass", "", "Password of the DN used to search the directory")
+		authLDAPUserBaseDN       = flag.String("auth-ldap-user-base-dn", "", "DN below which users are searched")
+		authLDAPUserAttribute    = flag.String("auth-ldap-user-attribute", "uid", "Attribute of users which contains the username")
+		authLDAPMailAttribute    = flag.String("auth-ldap-mail-attribute", "mail", "Attribute of users which contains the mail address")
+		authLDAPGroupBaseDN      = flag.String("auth-ldap-group-base-dn", "", "DN below which groups are searched (empty to disable group sync)")
+		authLDAPGroupAttribute   = flag.String("auth-ldap-group-attribute", "cn", "Attribute of groups which contains the group name")
+		authLDAPMemberAttribute  = flag.String("auth-ldap-member-attribute", "member", "Attribute of groups which contains the DNs of their members")
+		authLDAPAdminGroup       = flag.String("auth-ldap-admin-group", "admin", "LDAP group whose members become admins on first login")
 		authLogoutURL            = flag.String("auth-logout-url", "/oauth2/sign_out?rd=https%3A%2F%2Fjupyter.k8s.eonerc.rwth-aachen.de%2Fhub%2Flogout", "The URL to redirect the user to log out")
 		title                    = flag.String("title", "VILLASweb", "Title shown in the frontend")
 		subTitle                 = flag.String("sub-title", "", "Sub-title shown in the frontend")
@@ -78,9 +124,14 @@ func InitConfig() error {
 		testDataPath             = flag.String("test-data-path", "", "The path to a test data json file")
 		groupsPath               = flag.String("groups-path", "", "The path to a YAML file that maps user groups to scenario IDs")
 		apiUpdateInterval        = flag.String("api-update-interval", "10s" /* 10 sec */, "Interval in which API URL is queried for status updates of ICs")
+		apiUpdateWorkers         = flag.Int("api-update-workers", 8, "Maximum number of concurrent queries of IC APIs (default is 8)")
 		k8sRancherURL            = flag.String("k8s-rancher-url", "https://rancher.k8s.eonerc.rwth-aachen.de", "URL of Rancher instance that is used to deploy the backend")
 		k8sClusterName           = flag.String("k8s-cluster-name", "local", "Name of the Kubernetes cluster where the backend is deployed")
 		staleICTime              = flag.String("stale-ic-time", "1h" /* 1 hour */, "Time after which an IC is considered stale")
+		staleICDelete            = flag.Bool("stale-ic-delete", false, "Delete externally managed ICs once they are stale and no component configuration uses them")
+		icHistoryRetention       = flag.String("ic-history-retention", "720h" /* 30 days */, "Time for which the state history of ICs is kept")
+		trashRetention           = flag.String("trash-retention", "720h" /* 30 days */, "Time after which deleted scenarios and their children are removed from the trash")
+		jobWorkers               = flag.Int("job-workers", 4, "Number of workers executing asynchronous jobs (default is 4)")
 		webRTCiceUrls            = flag.String("webrtc-ice-urls",
 			"stun:stun.l.google.com:19302,villas:villas@stun:stun.0l.de,villas:villas@turn:turn.0l.de?transport=udp,villas:villas@turn:turn.0l.de?transport=tcp",
 			"WebRTC ICE URLs (comma-separated list, use username:password@url style for non-anonymous URLs)")
@@ -97,6 +148,7 @@ func InitConfig() error {
 		"amqp.host":                   *amqpHost,
 		"amqp.user":                   *amqpUser,
 		"amqp.pass":                   *amqpPass,
+		"amqp.action-timeout":         *amqpActionTimeout,
 		"port":                        *port,
 		"admin.user":                  *adminUser,
 		"admin.pass":                  *adminPass,
@@ -105,10 +157,31 @@ func InitConfig() error {
 		"s3.endpoint":                 *s3Endpoint,
 		"s3.endpoint-public":          *s3EndpointPublic,
 		"s3.region":                   *s3Region,
+		"file.storage":                *fileStorage,
+		"file.storage-path":           *fileStoragePath,
 		"jwt.secret":                  *jwtSecret,
 		"jwt.expires-after":           *jwtExpiresAfter,
+		"jwt.refresh-expires-after":   *jwtRefreshExpiresAfter,
 		"auth.external.login-url":     *authExternalLoginURL,
 		"auth.external.provider-name": *authExternalProviderName,
+		"auth.oidc.issuer":            *authOIDCIssuer,
+		"auth.oidc.client-id":         *authOIDCClientID,
+		"auth.oidc.client-secret":     *authOIDCClientSecret,
+		"auth.oidc.redirect-url":      *authOIDCRedirectURL,
+		"auth.oidc.scopes":            *authOIDCScopes,
+		"auth.oidc.groups-claim":      *authOIDCGroupsClaim,
+		"auth.oidc.admin-group":       *authOIDCAdminGroup,
+		"auth.oidc.provider-name":     *authOIDCProviderName,
+		"auth.ldap.url":               *authLDAPURL,
+		"auth.ldap.bind-dn":           *authLDAPBindDN,
+		"auth.ldap.bind-pass":         *authLDAPBindPass,
+		"auth.ldap.user-base-dn":      *authLDAPUserBaseDN,
+		"auth.ldap.user-attribute":    *authLDAPUserAttribute,
+		"auth.ldap.mail-attribute":    *authLDAPMailAttribute,
+		"auth.ldap.group-base-dn":     *authLDAPGroupBaseDN,
+		"auth.ldap.group-attribute":   *authLDAPGroupAttribute,
+		"auth.ldap.member-attribute":  *authLDAPMemberAttribute,
+		"auth.ldap.admin-group":       *authLDAPAdminGroup,
 		"auth.logout-url":             *authLogoutURL,
 		"title":                       *title,
 		"sub-title":                   *subTitle,
@@ -118,9 +191,13 @@ func InitConfig() error {
 		"groups.path":                 *groupsPath,
 		"config.file":                 *configFile,
 		"apiupdateinterval":           *apiUpdateInterval,
+		"apiupdateworkers":            fmt.Sprint(*apiUpdateWorkers),
 		"k8s.rancher-url":             *k8sRancherURL,
 		"k8s.cluster-name":            *k8sClusterName,
 		"staleictime":                 *staleICTime,
+		"ichistoryretention":          *icHistoryRetention,
+		"trashretention":              *trashRetention,
+		"jobs.workers":                fmt.Sprint(*jobWorkers),
 		"webrtc.ice-urls":             *webRTCiceUrls,
 	}
 
@@ -148,6 +225,30 @@ func InitConfig() error {
 		static["auth.external.enabled"] = "false"
 	}
 
+	if *authOIDC {
+		static["auth.oidc.enabled"] = "true"
+	} else {
+		static["auth.oidc.enabled"] = "false"
+	}
+
+	if *staleICDelete {
+		static["staleicdelete"] = "true"
+	} else {
+		static["staleicdelete"] = "false"
+	}
+
+	if *authLDAP {
+		static["auth.ldap.enabled"] = "true"
+	} else {
+		static["auth.ldap.enabled"] = "false"
+	}
+
+	if *authLDAPStartTLS {
+		static["auth.ldap.start-tls"] = "true"
+	} else {
+		static["auth.ldap.start-tls"] = "false"
+	}
+
 	mappings := map[string]string{}
 	for name := range static {
 		envName := strings.ReplaceAll(name, ".", "_")
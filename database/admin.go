@@ -30,8 +30,6 @@ import (
 
 // AddAdminUser adds a default admin user to the DB
 func AddAdminUser(cfg *config.Config) (string, error) {
-	DBpool.AutoMigrate(User{})
-
 	updatedPW := false
 	generatedPW := false
 
@@ -41,7 +39,7 @@ func AddAdminUser(cfg *config.Config) (string, error) {
 	if err == nil && adminPW != "" {
 		updatedPW = true
 	} else if err != nil || adminPW == "" {
-		adminPW = generatePassword(16)
+		adminPW = GeneratePassword(16)
 		generatedPW = true
 	}
 
@@ -95,7 +93,8 @@ func AddAdminUser(cfg *config.Config) (string, error) {
 	return adminPW, err
 }
 
-func generatePassword(Len int) string {
+// GeneratePassword generates a random alphanumeric password of the given length
+func GeneratePassword(Len int) string {
 	rand.NewSource(time.Now().UnixNano())
 	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
 		"abcdefghijklmnopqrstuvwxyz" +
@@ -113,7 +112,6 @@ func generatePassword(Len int) string {
 func AddTestUsers() error {
 
 	testUsers := []User{User0, UserA, UserB, UserC}
-	DBpool.AutoMigrate(&User{})
 
 	for _, user := range testUsers {
 		err := DBpool.Create(&user).Error
@@ -0,0 +1,124 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes of API tokens
+const TokenScopeReadOnly = "read-only"
+const TokenScopeScenario = "scenario"
+const TokenScopeICActions = "ic-actions"
+
+// APITokenPrefix distinguishes API tokens from the JWTs issued upon login
+const APITokenPrefix = "vt_"
+
+// length of the displayed prefix of API tokens
+const apiTokenPrefixLength = len(APITokenPrefix) + 8
+
+// models which belong to a scenario and may be accessed with a token of scope scenario
+var scenarioModels = map[ModelName]bool{
+	ModelScenario:               true,
+	ModelScenarioMember:         true,
+	ModelComponentConfiguration: true,
+	ModelSignal:                 true,
+	ModelDashboard:              true,
+	ModelWidget:                 true,
+	ModelFile:                   true,
+	ModelResult:                 true,
+}
+
+// NewAPITokenSecret returns a new random API token and its hash
+func NewAPITokenSecret() (string, string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate API token: %v", err)
+	}
+
+	secret := APITokenPrefix + hex.EncodeToString(b)
+	return secret, HashAPIToken(secret), nil
+}
+
+// HashAPIToken returns the hash of an API token under which it is stored in the DB
+func HashAPIToken(secret string) string {
+	return hashSecret(secret)
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// APITokenPrefixOf returns the displayed prefix of an API token
+func APITokenPrefixOf(secret string) string {
+	if len(secret) < apiTokenPrefixLength {
+		return secret
+	}
+	return secret[:apiTokenPrefixLength]
+}
+
+// IsTokenScope returns true if scope is a valid scope of API tokens
+func IsTokenScope(scope string) bool {
+	return scope == TokenScopeReadOnly || scope == TokenScopeScenario || scope == TokenScopeICActions
+}
+
+// IsAPITokenRequest returns true if the request is authenticated with an API token instead of a login
+func IsAPITokenRequest(c *gin.Context) bool {
+	_, exists := c.Get(APITokenScopeCtx)
+	return exists
+}
+
+// TokenScenarioID returns the ID of the scenario to which the API token of the request is limited (0 if not limited)
+func TokenScenarioID(c *gin.Context) uint {
+	scenarioID, exists := c.Get(APITokenScenarioCtx)
+	if !exists {
+		return 0
+	}
+	return scenarioID.(uint)
+}
+
+func validateTokenScope(scope string, model ModelName, action CRUD) error {
+	switch scope {
+	case TokenScopeReadOnly:
+		if action == Read {
+			return nil
+		}
+	case TokenScopeScenario:
+		// new scenarios cannot be created since the token is limited to an existing one
+		if scenarioModels[model] && !(model == ModelScenario && action == Create) {
+			return nil
+		}
+		// ICs have to be read to work with the component configurations of the scenario
+		if model == ModelInfrastructureComponent && action == Read {
+			return nil
+		}
+	case TokenScopeICActions:
+		if model == ModelInfrastructureComponentAction || (model == ModelInfrastructureComponent && action == Read) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("action not allowed for API token of scope %v", scope)
+}
@@ -0,0 +1,175 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package database
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// AuditAction is the operation recorded for actions sent to ICs
+const AuditAction = "action"
+
+// AuditPurge is the operation recorded for rows which are permanently deleted from the trash
+const AuditPurge = "purge"
+
+// change of a field recorded in the diff of an AuditEntry
+type auditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Audit records an operation of the user of the request context on an object;
+// before is nil for created objects, after is nil for deleted objects.
+// Errors are logged only since the operation itself has already been performed.
+func Audit(c *gin.Context, operation CRUD, model ModelName, objectID uint, scenarioID uint, before interface{}, after interface{}) {
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		log.Printf("AUDIT: failed to compute diff of %s %d: %s", model, objectID, err)
+	}
+
+	addAuditEntry(c, string(operation), model, objectID, scenarioID, diff)
+}
+
+// AuditICAction records an action sent to an IC by the user of the request context
+func AuditICAction(c *gin.Context, icID uint, action interface{}) {
+	raw, err := json.Marshal(map[string]interface{}{"action": action})
+	if err != nil {
+		log.Printf("AUDIT: failed to marshal action sent to IC %d: %s", icID, err)
+	}
+
+	addAuditEntry(c, AuditAction, ModelInfrastructureComponentAction, icID, 0, raw)
+}
+
+// AuditPurgedRows records the rows of a model which were permanently deleted from the trash by a purge
+// which was started by a user (0 for the periodic purge of the backend)
+func AuditPurgedRows(userID uint, model ModelName, ids []uint) {
+	raw, err := json.Marshal(map[string]interface{}{"ids": ids, "count": len(ids)})
+	if err != nil {
+		log.Printf("AUDIT: failed to marshal purged rows of %s: %s", model, err)
+	}
+
+	entry := AuditEntry{
+		UserID:    userID,
+		Operation: AuditPurge,
+		ModelName: string(model),
+		Diff:      postgres.Jsonb{RawMessage: raw},
+	}
+
+	if userID != 0 {
+		var u User
+		if GetDB().Find(&u, userID).Error == nil {
+			entry.Role = u.Role
+		}
+	}
+
+	err = GetDB().Create(&entry).Error
+	if err != nil {
+		log.Printf("AUDIT: failed to record purge of %s by user %d: %s", model, userID, err)
+	}
+}
+
+func addAuditEntry(c *gin.Context, operation string, model ModelName, objectID uint, scenarioID uint, diff json.RawMessage) {
+	entry := AuditEntry{
+		Operation:  operation,
+		ModelName:  string(model),
+		ObjectID:   objectID,
+		ScenarioID: scenarioID,
+		Diff:       postgres.Jsonb{RawMessage: diff},
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	if userID, exists := c.Get(UserIDCtx); exists {
+		entry.UserID = userID.(uint)
+	}
+	if role, exists := c.Get(UserRoleCtx); exists {
+		entry.Role = role.(string)
+	}
+
+	err := GetDB().Create(&entry).Error
+	if err != nil {
+		log.Printf("AUDIT: failed to record %s of %s %d by user %d: %s", operation, model, objectID, entry.UserID, err)
+	}
+}
+
+// auditDiff returns the JSON encoded fields which differ between the JSON representations of before and after
+func auditDiff(before interface{}, after interface{}) (json.RawMessage, error) {
+	b, err := toJSONMap(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := toJSONMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]auditChange)
+	for key, value := range b {
+		if !reflect.DeepEqual(value, a[key]) {
+			diff[key] = auditChange{Before: value, After: a[key]}
+		}
+	}
+	for key, value := range a {
+		if _, ok := b[key]; !ok {
+			diff[key] = auditChange{Before: nil, After: value}
+		}
+	}
+
+	// timestamps are recorded by the audit entry itself
+	delete(diff, "updatedAt")
+	delete(diff, "createdAt")
+
+	return json.Marshal(diff)
+}
+
+func toJSONMap(obj interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if obj == nil {
+		return m, nil
+	}
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(raw, &m)
+	return m, err
+}
+
+// ScenarioIDOfConfig returns the ID of the scenario of a component configuration (0 if it does not exist)
+func ScenarioIDOfConfig(configID uint) uint {
+	var m ComponentConfiguration
+	if GetDB().Find(&m, configID).Error != nil {
+		return 0
+	}
+	return m.ScenarioID
+}
+
+// ScenarioIDOfDashboard returns the ID of the scenario of a dashboard (0 if it does not exist)
+func ScenarioIDOfDashboard(dashboardID uint) uint {
+	var d Dashboard
+	if GetDB().Find(&d, dashboardID).Error != nil {
+		return 0
+	}
+	return d.ScenarioID
+}
@@ -28,8 +28,30 @@ import (
 
 var DBpool *gorm.DB // database used by backend
 
-// InitDB Initialize connection to the database
+// InitDB Initialize connection to the database and apply pending migrations
 func InitDB(cfg *config.Config, clear bool) error {
+	err := ConnectDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	// drop tables if parameter set
+	if clear {
+		DropTables()
+		log.Println("Database tables dropped")
+	}
+
+	err = MigrateModels()
+	if err != nil {
+		return err
+	}
+	log.Println("Database connection established")
+
+	return nil
+}
+
+// ConnectDB Initialize connection to the database without changing its schema
+func ConnectDB(cfg *config.Config) error {
 	name, err := cfg.String("db.name")
 	if err != nil {
 		return err
@@ -80,15 +102,6 @@ func InitDB(cfg *config.Config, clear bool) error {
 
 	DBpool = db
 
-	// drop tables if parameter set
-	if clear {
-		DropTables()
-		log.Println("Database tables dropped")
-	}
-
-	MigrateModels()
-	log.Println("Database connection established")
-
 	return nil
 }
 
@@ -110,21 +123,15 @@ func DropTables() {
 	DBpool.DropTableIfExists(&Dashboard{})
 	DBpool.DropTableIfExists(&Widget{})
 	DBpool.DropTableIfExists(&Result{})
+	DBpool.DropTableIfExists(&Job{})
+	DBpool.DropTableIfExists(&AuditEntry{})
+	DBpool.DropTableIfExists(&APIToken{})
+	DBpool.DropTableIfExists(&Session{})
+	DBpool.DropTableIfExists(&OIDCLogin{})
+	DBpool.DropTableIfExists(&ICAction{})
+	DBpool.DropTableIfExists(&Reservation{})
+	DBpool.DropTableIfExists(&ICStateSample{})
 	// The following statement deletes the many to many relationship between users and scenarios
-	DBpool.DropTableIfExists("user_scenarios")
-}
-
-// MigrateModels AutoMigrate the models
-func MigrateModels() {
-	DBpool.AutoMigrate(&InfrastructureComponent{})
-	DBpool.AutoMigrate(&Signal{})
-	DBpool.AutoMigrate(&ComponentConfiguration{})
-	DBpool.AutoMigrate(&File{})
-	DBpool.AutoMigrate(&Scenario{})
-	DBpool.AutoMigrate(&User{})
-	DBpool.AutoMigrate(&UserGroup{})
-	DBpool.AutoMigrate(&ScenarioMapping{})
-	DBpool.AutoMigrate(&Dashboard{})
-	DBpool.AutoMigrate(&Widget{})
-	DBpool.AutoMigrate(&Result{})
+	DBpool.DropTableIfExists(&ScenarioMembership{})
+	DBpool.DropTableIfExists(&SchemaMigration{})
 }
@@ -382,3 +382,127 @@ func TestFileAssociations(t *testing.T) {
 	var file1 File
 	assert.NoError(t, DBpool.Find(&file1, 1).Error, "Find File with ID=1")
 }
+
+func TestMigrations(t *testing.T) {
+
+	DropTables()
+	assert.NoError(t, MigrateModels())
+
+	version, err := GetSchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(), version)
+
+	status, err := GetMigrationStatus()
+	assert.NoError(t, err)
+	assert.Len(t, status, len(migrations))
+	for _, m := range status {
+		assert.NotNil(t, m.AppliedAt, "Migration %v_%v not applied", m.Version, m.Name)
+	}
+
+	// applying the migrations again does not change anything
+	assert.NoError(t, MigrateModels())
+
+	// the schema matches the models
+	models := []interface{}{&InfrastructureComponent{}, &Signal{}, &ComponentConfiguration{}, &File{},
+		&Scenario{}, &User{}, &ScenarioMembership{}, &UserGroup{}, &ScenarioMapping{}, &Dashboard{},
+		&Widget{}, &Result{}, &Job{}, &AuditEntry{}, &APIToken{}, &Session{}, &OIDCLogin{},
+		&ICAction{}, &Reservation{}, &ICStateSample{}}
+	for _, model := range models {
+		scope := DBpool.NewScope(model)
+		for _, field := range scope.GetModelStruct().StructFields {
+			if field.IsNormal && !field.IsIgnored {
+				assert.True(t, DBpool.Dialect().HasColumn(scope.TableName(), field.DBName),
+					"Column %v of table %v is not created by any migration", field.DBName, scope.TableName())
+			}
+		}
+	}
+
+	// roll back all migrations but the initial schema, which is never reverted
+	assert.NoError(t, MigrateDown(1))
+	version, err = GetSchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+	assert.False(t, DBpool.Dialect().HasColumn("files", "storage"))
+	assert.False(t, DBpool.HasTable(&OIDCLogin{}))
+
+	status, err = GetMigrationStatus()
+	assert.NoError(t, err)
+	for _, m := range status {
+		if m.Version > 1 {
+			assert.Nil(t, m.AppliedAt, "Migration %v_%v not reverted", m.Version, m.Name)
+		}
+	}
+
+	assert.Error(t, MigrateDown(0))
+	version, err = GetSchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+	assert.True(t, DBpool.HasTable(&User{}))
+
+	// migrations to unknown versions fail
+	assert.Error(t, MigrateUp(LatestSchemaVersion()+1))
+
+	assert.NoError(t, MigrateModels())
+	assert.True(t, DBpool.HasTable(&User{}))
+
+	// the backend refuses to migrate a database of a newer version of the backend
+	newer := SchemaMigration{Version: LatestSchemaVersion() + 1, Name: "newer"}
+	assert.NoError(t, DBpool.Create(&newer).Error)
+	assert.Error(t, MigrateModels())
+	assert.Error(t, MigrateDown(0))
+	assert.NoError(t, DBpool.Delete(&newer).Error)
+}
+
+func TestMigrateBaselineSchema(t *testing.T) {
+
+	// create the schema of a database which was created by gorm AutoMigrate before versioned
+	// migrations were introduced: the tables added since and the columns added since are missing
+	DropTables()
+	assert.NoError(t, MigrateModels())
+	for _, stmt := range []string{
+		`DROP TABLE "schema_version"`,
+		`DROP TABLE "jobs", "audit_entries", "api_tokens", "sessions", "oidc_logins", "ic_actions", "reservations", "ic_state_samples"`,
+		`ALTER TABLE "infrastructure_components" DROP COLUMN "poll_settings"`,
+		`ALTER TABLE "user_scenarios" DROP COLUMN "role"`,
+		`ALTER TABLE "scenario_mappings" DROP COLUMN "role"`,
+		`ALTER TABLE "files" DROP COLUMN "storage"`,
+	} {
+		assert.NoError(t, DBpool.Exec(stmt).Error)
+	}
+
+	// data of the existing database
+	assert.NoError(t, DBpool.Exec(`INSERT INTO "users" ("username", "password") VALUES ('User_A', 'secret')`).Error)
+	assert.NoError(t, DBpool.Exec(`INSERT INTO "scenarios" ("name") VALUES ('Scenario_A')`).Error)
+	assert.NoError(t, DBpool.Exec(`INSERT INTO "user_scenarios" ("user_id", "scenario_id") VALUES (1, 1)`).Error)
+	assert.NoError(t, DBpool.Exec(`INSERT INTO "scenario_mappings" ("scenario_id", "user_group_id") VALUES (1, 1)`).Error)
+	assert.NoError(t, DBpool.Exec(`INSERT INTO "files" ("name", "key") VALUES ('a.txt', ''), ('b.txt', 'abc')`).Error)
+
+	// the existing database is adopted
+	assert.NoError(t, MigrateModels())
+	version, err := GetSchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(), version)
+
+	assert.True(t, DBpool.Dialect().HasColumn("infrastructure_components", "poll_settings"))
+	assert.True(t, DBpool.HasTable(&ICStateSample{}))
+
+	// the existing rows get the defaults of new databases
+	var member ScenarioMembership
+	assert.NoError(t, DBpool.Find(&member, "user_id = ? AND scenario_id = ?", 1, 1).Error)
+	assert.Equal(t, "owner", member.Role)
+
+	var mapping ScenarioMapping
+	assert.NoError(t, DBpool.First(&mapping).Error)
+	assert.Equal(t, "owner", mapping.Role)
+
+	var files []File
+	assert.NoError(t, DBpool.Order("name").Find(&files).Error)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "db", files[0].Storage)
+	assert.Equal(t, "s3", files[1].Storage)
+
+	// the membership roles can be used
+	assert.NoError(t, SetScenarioMember(1, 1, "viewer"))
+	assert.NoError(t, DBpool.Find(&member, "user_id = ? AND scenario_id = ?", 1, 1).Error)
+	assert.Equal(t, "viewer", member.Role)
+}
@@ -0,0 +1,47 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// FileStorage copies and deletes the data of files which is kept by the storage drivers of the file
+// endpoints; it is used by packages which cannot import the file endpoints, e.g. to clone scenarios
+type FileStorage interface {
+	// CopyData stores a copy of the data of the file under a new key which is set in the file
+	CopyData(ctx context.Context, f *File) error
+	// DeleteData deletes the data of the file unless it is referenced by other files
+	DeleteData(ctx context.Context, f *File) error
+}
+
+var fileStorage FileStorage
+
+// SetFileStorage sets the storage of the data of files, it is called by the file endpoints upon initialization
+func SetFileStorage(s FileStorage) {
+	fileStorage = s
+}
+
+// GetFileStorage returns the storage of the data of files
+func GetFileStorage() (FileStorage, error) {
+	if fileStorage == nil {
+		return nil, fmt.Errorf("no storage of the data of files available")
+	}
+	return fileStorage, nil
+}
@@ -0,0 +1,64 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package database
+
+import (
+	"fmt"
+)
+
+// IsScenarioRole returns true if role is a valid role of a member of a scenario
+func IsScenarioRole(role string) bool {
+	_, ok := ScenarioRoles[role]
+	return ok
+}
+
+// GetScenarioMembership returns the membership of a user in a scenario
+func GetScenarioMembership(scenarioID uint, userID uint) (ScenarioMembership, error) {
+	var m ScenarioMembership
+	err := GetDB().Where("scenario_id = ? AND user_id = ?", scenarioID, userID).First(&m).Error
+	return m, err
+}
+
+// AddScenarioMember adds a user with the given role to a scenario,
+// the role of users who already are members of the scenario is not changed
+func AddScenarioMember(scenarioID uint, userID uint, role string) error {
+	if !IsScenarioRole(role) {
+		return fmt.Errorf("invalid scenario role %v", role)
+	}
+
+	return GetDB().Exec("INSERT INTO user_scenarios (user_id, scenario_id, role) VALUES (?, ?, ?) "+
+		"ON CONFLICT (user_id, scenario_id) DO NOTHING", userID, scenarioID, role).Error
+}
+
+// SetScenarioMember adds a user with the given role to a scenario,
+// the role of users who already are members of the scenario is changed
+func SetScenarioMember(scenarioID uint, userID uint, role string) error {
+	if !IsScenarioRole(role) {
+		return fmt.Errorf("invalid scenario role %v", role)
+	}
+
+	return GetDB().Exec("INSERT INTO user_scenarios (user_id, scenario_id, role) VALUES (?, ?, ?) "+
+		"ON CONFLICT (user_id, scenario_id) DO UPDATE SET role = EXCLUDED.role", userID, scenarioID, role).Error
+}
+
+// CountScenarioOwners returns the number of owners of a scenario
+func CountScenarioOwners(scenarioID uint) (int, error) {
+	var count int
+	err := GetDB().Model(&ScenarioMembership{}).Where("scenario_id = ? AND role = ?", scenarioID, ScenarioOwner).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,272 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package database
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Migrations are numbered SQL files <version>_<name>.up.sql which apply a change of the schema
+// and <version>_<name>.down.sql which revert it; a released migration must never be changed,
+// every change of the models requires a new migration
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// key of the advisory lock which serializes migrations of several backend instances
+const migrationLock = 4711
+
+// Migration is a versioned change of the database schema
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration data model, a migration which was applied to the database
+type SchemaMigration struct {
+	// Version of the migration
+	Version uint `json:"version" gorm:"primary_key;auto_increment:false"`
+	// Name of the migration
+	Name string `json:"name"`
+	// Time at which the migration was applied (nil if the migration is pending)
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_version"
+}
+
+var migrations = loadMigrations()
+
+func loadMigrations() []Migration {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		panic(err)
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			panic(fmt.Sprintf("invalid name of migration file %v", entry.Name()))
+		}
+
+		version, _ := strconv.ParseUint(match[1], 10, 32)
+		sql, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = m
+		} else if m.Name != match[2] {
+			panic(fmt.Sprintf("migrations %v and %v have the same version", m.Name, match[2]))
+		}
+
+		if match[3] == "up" {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+
+	var sorted []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			panic(fmt.Sprintf("migration %v requires an up and a down file", m.Name))
+		}
+		sorted = append(sorted, *m)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return sorted
+}
+
+// LatestSchemaVersion returns the version of the latest migration known to the backend
+func LatestSchemaVersion() uint {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// GetSchemaVersion returns the version of the latest migration applied to the database
+// (0 if no migration was applied)
+func GetSchemaVersion() (uint, error) {
+	applied, err := appliedMigrations(DBpool)
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// GetMigrationStatus returns all migrations known to the backend or applied to the database
+// ordered by their version, pending migrations have no time of application
+func GetMigrationStatus() ([]SchemaMigration, error) {
+	applied, err := appliedMigrations(DBpool)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]SchemaMigration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = SchemaMigration{Version: m.Version, Name: m.Name}
+	}
+	// migrations of newer versions of the backend are reported as well
+	for _, m := range applied {
+		byVersion[m.Version] = m
+	}
+
+	var status []SchemaMigration
+	for _, m := range byVersion {
+		status = append(status, m)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+
+	return status, nil
+}
+
+// MigrateModels applies all pending migrations to the database
+func MigrateModels() error {
+	return MigrateUp(LatestSchemaVersion())
+}
+
+// MigrateUp applies the pending migrations up to and including the target version,
+// each migration is applied in a transaction of its own
+func MigrateUp(target uint) error {
+	if target > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %v, the latest version is %v", target, LatestSchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.Version > target {
+			break
+		}
+
+		err := DBpool.Transaction(func(tx *gorm.DB) error {
+			applied, err := lockMigrations(tx)
+			if err != nil {
+				return err
+			}
+			if _, ok := applied[m.Version]; ok {
+				return nil
+			}
+
+			err = tx.Exec(m.Up).Error
+			if err != nil {
+				return fmt.Errorf("migration %v_%v failed: %v", m.Version, m.Name, err)
+			}
+
+			now := time.Now()
+			log.Printf("Applied migration %v_%v", m.Version, m.Name)
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: &now}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown reverts the applied migrations down to the target version in reverse order,
+// each migration is reverted in a transaction of its own
+func MigrateDown(target uint) error {
+	for i := len(migrations) - 1; i >= 0 && migrations[i].Version > target; i-- {
+		m := migrations[i]
+
+		err := DBpool.Transaction(func(tx *gorm.DB) error {
+			applied, err := lockMigrations(tx)
+			if err != nil {
+				return err
+			}
+			if _, ok := applied[m.Version]; !ok {
+				return nil
+			}
+
+			err = tx.Exec(m.Down).Error
+			if err != nil {
+				return fmt.Errorf("reverting migration %v_%v failed: %v", m.Version, m.Name, err)
+			}
+
+			log.Printf("Reverted migration %v_%v", m.Version, m.Name)
+			return tx.Delete(&SchemaMigration{Version: m.Version}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockMigrations waits for other backend instances to finish their migrations and returns the
+// applied migrations; it fails if the database was migrated by a newer version of the backend
+func lockMigrations(tx *gorm.DB) (map[uint]SchemaMigration, error) {
+	err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Exec(`CREATE TABLE IF NOT EXISTS "schema_version" ("version" integer, "name" text, ` +
+		`"applied_at" timestamp with time zone, PRIMARY KEY ("version"))`).Error
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]SchemaMigration{}
+	for _, m := range applied {
+		if m.Version > LatestSchemaVersion() {
+			return nil, fmt.Errorf("the database has the schema version %v which is newer than the latest "+
+				"version %v known to the backend", m.Version, LatestSchemaVersion())
+		}
+		byVersion[m.Version] = m
+	}
+
+	return byVersion, nil
+}
+
+func appliedMigrations(db *gorm.DB) ([]SchemaMigration, error) {
+	var applied []SchemaMigration
+	if !db.HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+
+	err := db.Order("version").Find(&applied).Error
+	return applied, err
+}
@@ -0,0 +1,7 @@
+-- the initial schema contains the data of databases which existed before versioned migrations
+-- were introduced, it is never reverted to not lose this data
+DO $$
+BEGIN
+	RAISE EXCEPTION 'the initial schema cannot be reverted, drop the database instead';
+END
+$$;
@@ -0,0 +1,67 @@
+-- Schema created by gorm AutoMigrate before versioned migrations were introduced,
+-- existing databases are adopted since all statements are skipped for existing tables
+-- and the columns which were added to the existing tables since are added below
+
+CREATE TABLE IF NOT EXISTS "infrastructure_components" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"uuid" text NOT NULL,"name" text DEFAULT '',"websocket_url" text DEFAULT '',"api_url" text DEFAULT '',"category" text DEFAULT '',"type" text DEFAULT '',"uptime" numeric DEFAULT -1,"state" text DEFAULT '',"state_update_at" text DEFAULT '',"location" text DEFAULT '',"description" text DEFAULT '',"start_parameter_schema" jsonb,"create_parameter_schema" jsonb,"status_update_raw" jsonb,"poll_settings" jsonb,"managed_externally" boolean DEFAULT false,"manager" text DEFAULT '', PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_infrastructure_components_deleted_at ON "infrastructure_components"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "signals" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"name" text,"unit" text,"index" integer,"direction" text,"scaling_factor" numeric DEFAULT 1,"config_id" integer, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_signals_deleted_at ON "signals"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "component_configurations" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"name" text NOT NULL,"start_parameters" jsonb,"scenario_id" integer,"ic_id" integer,"file_ids" integer[], PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_component_configurations_deleted_at ON "component_configurations"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "files" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"name" text NOT NULL,"key" text,"type" text,"size" integer,"date" text,"scenario_id" integer,"FileData" bytea,"image_height" integer DEFAULT 0,"image_width" integer DEFAULT 0, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_files_deleted_at ON "files"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "scenarios" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"name" text NOT NULL,"is_locked" boolean DEFAULT false,"start_parameters" jsonb, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_scenarios_deleted_at ON "scenarios"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "users" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"username" text NOT NULL UNIQUE,"password" text NOT NULL,"mail" text DEFAULT '',"role" text DEFAULT 'user',"active" boolean DEFAULT true, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON "users"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "user_scenarios" ("user_id" integer,"scenario_id" integer,"role" text DEFAULT 'owner', PRIMARY KEY ("user_id","scenario_id"));
+
+CREATE TABLE IF NOT EXISTS "user_groups" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"name" text NOT NULL UNIQUE, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_user_groups_deleted_at ON "user_groups"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "user_groups_users" ("user_id" integer,"user_group_id" integer, PRIMARY KEY ("user_id","user_group_id"));
+
+CREATE TABLE IF NOT EXISTS "scenario_mappings" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"scenario_id" integer,"user_group_id" integer,"duplicate" boolean,"role" text DEFAULT 'owner', PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_scenario_mappings_deleted_at ON "scenario_mappings"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "dashboards" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"name" text NOT NULL,"grid" integer DEFAULT 15,"height" integer,"scenario_id" integer, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_dashboards_deleted_at ON "dashboards"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "widgets" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"name" text NOT NULL,"type" text NOT NULL,"width" integer NOT NULL,"height" integer NOT NULL,"min_width" integer NOT NULL,"min_height" integer NOT NULL,"x" integer NOT NULL,"y" integer NOT NULL,"z" integer NOT NULL,"is_locked" boolean DEFAULT false,"custom_properties" jsonb,"dashboard_id" integer,"signal_ids" integer[], PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_widgets_deleted_at ON "widgets"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "results" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"config_snapshots" jsonb,"description" text,"scenario_id" integer,"result_file_ids" integer[], PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_results_deleted_at ON "results"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "jobs" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"type" text,"state" text DEFAULT 'pending',"progress" integer DEFAULT 0,"message" text,"error" text,"result" jsonb,"started_at" timestamp with time zone,"finished_at" timestamp with time zone,"user_id" integer,"scenario_id" integer, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_jobs_deleted_at ON "jobs"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "audit_entries" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"user_id" integer,"role" text,"operation" text,"model_name" text,"object_id" integer,"scenario_id" integer,"diff" jsonb, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_audit_entries_deleted_at ON "audit_entries"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "api_tokens" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"user_id" integer,"name" text NOT NULL,"hash" text NOT NULL UNIQUE,"prefix" text,"scope" text NOT NULL,"scenario_id" integer,"expires_at" timestamp with time zone,"last_used_at" timestamp with time zone, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_api_tokens_deleted_at ON "api_tokens"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "sessions" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"user_id" integer,"token_id" text NOT NULL UNIQUE,"refresh_hash" text NOT NULL UNIQUE,"expires_at" timestamp with time zone,"refresh_expires_at" timestamp with time zone,"revoked_at" timestamp with time zone, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_sessions_deleted_at ON "sessions"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "ic_actions" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"uuid" text NOT NULL UNIQUE,"ic_id" integer,"user_id" integer,"action" text,"when" bigint,"parameters" jsonb,"payload" jsonb,"state" text DEFAULT 'sent',"message" text,"sent_at" timestamp with time zone,"timeout_at" timestamp with time zone,"finished_at" timestamp with time zone, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_ic_actions_deleted_at ON "ic_actions"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "reservations" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"ic_id" integer,"user_id" integer,"scenario_id" integer,"start" timestamp with time zone,"end" timestamp with time zone,"description" text, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_reservations_deleted_at ON "reservations"(deleted_at);
+
+CREATE TABLE IF NOT EXISTS "ic_state_samples" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"ic_id" integer,"state" text,"uptime" numeric,"transition" boolean,"status_update_raw" jsonb, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_ic_state_samples_deleted_at ON "ic_state_samples"(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_ic_state_samples_ic_id ON "ic_state_samples"(ic_id);
+
+-- Columns added to the tables of databases created by gorm AutoMigrate, with the defaults of new databases
+ALTER TABLE "infrastructure_components" ADD COLUMN IF NOT EXISTS "poll_settings" jsonb;
+ALTER TABLE "user_scenarios" ADD COLUMN IF NOT EXISTS "role" text DEFAULT 'owner';
+ALTER TABLE "scenario_mappings" ADD COLUMN IF NOT EXISTS "role" text DEFAULT 'owner';
@@ -0,0 +1,10 @@
+-- the previous schema cannot tell files of the local storage from files uploaded to S3
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM "files" WHERE "storage" NOT IN ('db', 's3')) THEN
+		RAISE EXCEPTION 'files are kept in the local storage, move them to db or s3 before reverting this migration';
+	END IF;
+END
+$$;
+
+ALTER TABLE "files" DROP COLUMN "storage";
@@ -0,0 +1,3 @@
+-- Storage driver which keeps the data of a file, files with a key were uploaded to S3
+ALTER TABLE "files" ADD COLUMN "storage" text DEFAULT 'db';
+UPDATE "files" SET "storage" = 's3' WHERE "key" IS NOT NULL AND "key" <> '';
@@ -0,0 +1,3 @@
+-- Logins which were started at the OpenID Connect provider, kept in the database to complete them at any backend instance
+CREATE TABLE IF NOT EXISTS "oidc_logins" ("id" serial,"created_at" timestamp with time zone,"updated_at" timestamp with time zone,"deleted_at" timestamp with time zone,"state_hash" text NOT NULL UNIQUE,"verifier" text,"nonce" text,"expires_at" timestamp with time zone, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS idx_oidc_logins_deleted_at ON "oidc_logins"(deleted_at);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_ic_state_samples_ic_id ON "ic_state_samples"(ic_id);
+DROP INDEX IF EXISTS idx_ic_state_samples_ic_id_created_at;
@@ -0,0 +1,3 @@
+-- The history of an IC is queried by its time window, the index replaces the index on the IC
+CREATE INDEX IF NOT EXISTS idx_ic_state_samples_ic_id_created_at ON "ic_state_samples"(ic_id, created_at);
+DROP INDEX IF EXISTS idx_ic_state_samples_ic_id;
@@ -61,6 +61,8 @@ type ScenarioMapping struct {
 	UserGroup   UserGroup `json:"-" gorm:"foreignkey:UserGroupID"`
 	// Whether to duplicate Scenario or add users to existing Scenario
 	Duplicate bool `json:"duplicate"`
+	// Role of the users of the group in the existing Scenario (owner, editor or viewer)
+	Role string `json:"role" gorm:"default:'owner'"`
 }
 
 // UserGroup data model
@@ -95,6 +97,20 @@ type Scenario struct {
 	Results []Result `json:"-" gorm:"foreignkey:ScenarioID"`
 }
 
+// ScenarioMembership data model, the join table of the many to many relationship between users and scenarios
+type ScenarioMembership struct {
+	// ID of the user who is member of the scenario
+	UserID uint `json:"userID" gorm:"primary_key;auto_increment:false"`
+	// ID of the scenario
+	ScenarioID uint `json:"scenarioID" gorm:"primary_key;auto_increment:false"`
+	// Role of the user in the scenario (owner, editor or viewer)
+	Role string `json:"role" gorm:"default:'owner'"`
+}
+
+func (ScenarioMembership) TableName() string {
+	return "user_scenarios"
+}
+
 // ComponentConfiguration data model
 type ComponentConfiguration struct {
 	Model
@@ -162,6 +178,8 @@ type InfrastructureComponent struct {
 	CreateParameterSchema postgres.Jsonb `json:"createparameterschema"`
 	// raw JSON of last status update
 	StatusUpdateRaw postgres.Jsonb `json:"statusupdateraw"`
+	// JSON settings for querying the API of the IC (poller, interval, timeout, backoff, ...)
+	PollSettings postgres.Jsonb `json:"pollsettings"`
 	// Boolean indicating if IC is managed externally (via AMQP/ VILLAScontroller)
 	ManagedExternally bool `json:"managedexternally" gorm:"default:false"`
 	// UUID of IC that manages this IC
@@ -221,8 +239,10 @@ type File struct {
 	Model
 	// Name of file
 	Name string `json:"name" gorm:"not null"`
-	// Key of file in S3 bucket
+	// Key of file in the storage (S3 bucket or local directory)
 	Key string `json:"key"`
+	// Storage driver which keeps the data of the file (db, s3 or local)
+	Storage string `json:"storage" gorm:"default:'db'"`
 	// Type of file (MIME type)
 	Type string `json:"type"`
 	// Size of file (in byte)
@@ -251,3 +271,159 @@ type Result struct {
 	// File IDs associated with result
 	ResultFileIDs pq.Int64Array `json:"resultFileIDs" gorm:"type:integer[]"`
 }
+
+// Job data model
+type Job struct {
+	Model
+	// Type of the job (e.g. scenario-duplication)
+	Type string `json:"type"`
+	// State of the job (pending, running, succeeded, failed, cancelled)
+	State string `json:"state" gorm:"default:'pending'"`
+	// Progress of the job in percent
+	Progress uint `json:"progress" gorm:"default:0"`
+	// Description of the current step of the job
+	Message string `json:"message"`
+	// Error message if the job failed
+	Error string `json:"error"`
+	// JSON result of the job (e.g. IDs of created objects)
+	Result postgres.Jsonb `json:"result"`
+	// Time at which the job was started by a worker
+	StartedAt *time.Time `json:"startedAt"`
+	// Time at which the job succeeded, failed or was cancelled
+	FinishedAt *time.Time `json:"finishedAt"`
+	// ID of user on whose behalf the job runs (0 for jobs started by the backend)
+	UserID uint `json:"userID"`
+	// ID of scenario the job operates on (optional)
+	ScenarioID uint `json:"scenarioID"`
+}
+
+// AuditEntry data model
+type AuditEntry struct {
+	Model
+	// ID of user who performed the operation
+	UserID uint `json:"userID"`
+	// Role of user at the time of the operation
+	Role string `json:"role"`
+	// Operation that was performed (create, update, delete or action)
+	Operation string `json:"operation"`
+	// Name of model on which the operation was performed
+	ModelName string `json:"model"`
+	// ID of object on which the operation was performed
+	ObjectID uint `json:"objectID"`
+	// ID of scenario to which the object belongs (optional)
+	ScenarioID uint `json:"scenarioID"`
+	// JSON diff of the object, maps changed fields to their values before and after the operation
+	Diff postgres.Jsonb `json:"diff"`
+}
+
+// APIToken data model
+type APIToken struct {
+	Model
+	// ID of user on whose behalf the token acts
+	UserID uint `json:"userID"`
+	// Name of the token chosen by the user (e.g. the name of a CI pipeline)
+	Name string `json:"name" gorm:"not null"`
+	// SHA-256 hash of the token, the token itself is only shown once upon creation
+	Hash string `json:"-" gorm:"unique;not null"`
+	// First characters of the token to help users identify their tokens
+	Prefix string `json:"prefix"`
+	// Scope of the token (read-only, scenario or ic-actions)
+	Scope string `json:"scope" gorm:"not null"`
+	// ID of scenario to which a token of scope scenario is limited
+	ScenarioID uint `json:"scenarioID"`
+	// Time after which the token is no longer accepted (never expires if not set)
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// Time at which the token was last used
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// Session data model, a login of a user
+type Session struct {
+	Model
+	// ID of user who logged in
+	UserID uint `json:"userID"`
+	// ID of the JWT issued for the session (jti claim)
+	TokenID string `json:"-" gorm:"unique;not null"`
+	// SHA-256 hash of the refresh token of the session
+	RefreshHash string `json:"-" gorm:"unique;not null"`
+	// Time at which the JWT of the session expires
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Time after which the session can no longer be refreshed
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+	// Time at which the session was revoked (logout, refresh or change of the user)
+	RevokedAt *time.Time `json:"revokedAt"`
+}
+
+// OIDCLogin data model, a login which was started at the OpenID Connect provider but not yet completed
+type OIDCLogin struct {
+	Model
+	// SHA-256 hash of the state which identifies the login
+	StateHash string `json:"-" gorm:"unique;not null"`
+	// PKCE code verifier with which the authorization code is redeemed
+	Verifier string `json:"-"`
+	// Nonce which the ID token has to contain
+	Nonce string `json:"-"`
+	// Time after which the login can no longer be completed
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ICAction data model, an action sent to an IC via AMQP
+type ICAction struct {
+	Model
+	// UUID of the action, sent along with the action to correlate replies of the IC
+	UUID string `json:"uuid" gorm:"unique;not null"`
+	// ID of the IC to which the action was sent
+	ICID uint `json:"icID"`
+	// ID of user who sent the action (0 for actions sent by the backend)
+	UserID uint `json:"userID"`
+	// Type of the action (start, stop, create, etc.)
+	Action string `json:"action"`
+	// Time at which the IC shall perform the action (Unix timestamp)
+	When int64 `json:"when"`
+	// JSON parameters of the action
+	Parameters postgres.Jsonb `json:"parameters"`
+	// Complete JSON message of the action as it is sent to the IC
+	Payload postgres.Jsonb `json:"-"`
+	// State of the action (scheduled, sent, acknowledged, running, completed, failed, timeout or cancelled)
+	State string `json:"state" gorm:"default:'sent'"`
+	// Last message of the IC concerning the action (e.g. the reason of a failure)
+	Message string `json:"message"`
+	// Time at which the action was published to the AMQP broker (or scheduled)
+	SentAt time.Time `json:"sentAt"`
+	// Time after which the action times out if the IC did not acknowledge it
+	TimeoutAt time.Time `json:"timeoutAt"`
+	// Time at which the action was completed, failed, timed out or cancelled
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+// Reservation data model, an exclusive booking of an IC for a time window
+type Reservation struct {
+	Model
+	// ID of the reserved IC
+	ICID uint `json:"icID"`
+	// ID of user who holds the reservation
+	UserID uint `json:"userID"`
+	// ID of scenario whose members also hold the reservation (optional)
+	ScenarioID uint `json:"scenarioID"`
+	// Start of the reserved time window
+	Start time.Time `json:"start"`
+	// End of the reserved time window
+	End time.Time `json:"end"`
+	// Description of the reservation (e.g. the planned experiment)
+	Description string `json:"description"`
+}
+
+// ICStateSample data model, a status update of an IC in its state history
+type ICStateSample struct {
+	Model
+	// ID of the IC which sent the status update
+	ICID uint `json:"icID"`
+	// State of the IC
+	State string `json:"state"`
+	// Uptime of the IC
+	Uptime float64 `json:"uptime"`
+	// True if the state of the IC changed with this status update
+	Transition bool `json:"transition"`
+	// Raw JSON of the status update, only kept for state transitions
+	StatusUpdateRaw postgres.Jsonb `json:"statusupdateraw"`
+}
@@ -26,6 +26,17 @@ import (
 )
 
 func CheckScenarioPermissions(c *gin.Context, operation CRUD, scenarioIDsource string, scenarioIDbody int) (bool, Scenario) {
+	return checkScenarioPermissions(c, ModelScenario, operation, scenarioIDsource, scenarioIDbody)
+}
+
+// CheckScenarioMemberPermissions checks if the user is allowed to list or manage the members of a scenario
+func CheckScenarioMemberPermissions(c *gin.Context, operation CRUD, scenarioIDsource string, scenarioIDbody int) (bool, Scenario) {
+	return checkScenarioPermissions(c, ModelScenarioMember, operation, scenarioIDsource, scenarioIDbody)
+}
+
+// checkScenarioPermissions checks if the user is allowed to perform the operation on
+// the model belonging to a scenario based on the role of the user in the scenario
+func checkScenarioPermissions(c *gin.Context, model ModelName, operation CRUD, scenarioIDsource string, scenarioIDbody int) (bool, Scenario) {
 
 	var so Scenario
 
@@ -52,6 +63,10 @@ func CheckScenarioPermissions(c *gin.Context, operation CRUD, scenarioIDsource s
 		return false, so
 	}
 
+	if !tokenAllowsScenario(c, so.ID) {
+		return false, so
+	}
+
 	u := User{}
 	err = db.Find(&u, userID.(uint)).Error
 	if err != nil {
@@ -63,19 +78,21 @@ func CheckScenarioPermissions(c *gin.Context, operation CRUD, scenarioIDsource s
 		return true, so
 	}
 
-	scenarioUser := User{}
-	err = db.Order("ID asc").Model(&so).Where("ID = ?", userID.(uint)).Related(&scenarioUser, "Users").Error
+	membership, err := GetScenarioMembership(so.ID, u.ID)
 	if err != nil {
 		helper.UnprocessableEntityError(c, "Access denied (user has no access or scenario is locked).")
 		return false, so
 	}
 
-	if !scenarioUser.Active {
+	if !u.Active {
 		helper.UnprocessableEntityError(c, "Access denied (user has no access or scenario is locked).")
 		return false, so
 	} else if so.IsLocked && operation != Read {
 		helper.UnprocessableEntityError(c, "Access denied (user has no access or scenario is locked).")
 		return false, so
+	} else if err = ValidateScenarioRole(membership.Role, model, operation); err != nil {
+		helper.UnprocessableEntityError(c, fmt.Sprintf("Access denied (role validation of scenario member failed): %v", err))
+		return false, so
 	} else {
 		return true, so
 	}
@@ -103,7 +120,7 @@ func CheckComponentConfigPermissions(c *gin.Context, operation CRUD, configIDSou
 		return false, m
 	}
 
-	ok, _ := CheckScenarioPermissions(c, operation, "body", int(m.ScenarioID))
+	ok, _ := checkScenarioPermissions(c, ModelComponentConfiguration, operation, "body", int(m.ScenarioID))
 	if !ok {
 		return false, m
 	}
@@ -192,7 +209,7 @@ func CheckDashboardPermissions(c *gin.Context, operation CRUD, dabIDSource strin
 		return false, dab
 	}
 
-	ok, _ := CheckScenarioPermissions(c, operation, "body", int(dab.ScenarioID))
+	ok, _ := checkScenarioPermissions(c, ModelDashboard, operation, "body", int(dab.ScenarioID))
 	if !ok {
 		return false, dab
 	}
@@ -255,9 +272,13 @@ func CheckFilePermissions(c *gin.Context, operation CRUD) (bool, File) {
 		return false, f
 	}
 
+	if !tokenAllowsScenario(c, f.ScenarioID) {
+		return false, f
+	}
+
 	if operation != Read {
 		// check access to scenario only if operation is not Read (=download) of file
-		ok, _ := CheckScenarioPermissions(c, operation, "body", int(f.ScenarioID))
+		ok, _ := checkScenarioPermissions(c, ModelFile, operation, "body", int(f.ScenarioID))
 		if !ok {
 			return false, f
 		}
@@ -287,7 +308,7 @@ func CheckResultPermissions(c *gin.Context, operation CRUD, resultIDSource strin
 		return false, result
 	}
 
-	ok, _ := CheckScenarioPermissions(c, operation, "body", int(result.ScenarioID))
+	ok, _ := checkScenarioPermissions(c, ModelResult, operation, "body", int(result.ScenarioID))
 	if !ok {
 		return false, result
 	}
@@ -320,3 +341,143 @@ func CheckICPermissions(c *gin.Context, modeltype ModelName, operation CRUD, has
 
 	return true, s
 }
+
+func CheckJobPermissions(c *gin.Context, operation CRUD, jobIDSource string, jobIDBody int) (bool, Job) {
+
+	var job Job
+
+	err := ValidateRole(c, ModelJob, operation)
+	if err != nil {
+		helper.UnprocessableEntityError(c, fmt.Sprintf("Access denied (role validation of job failed): %v", err.Error()))
+		return false, job
+	}
+
+	if operation == Read && jobIDSource == "none" {
+		return true, job
+	}
+
+	jobID, err := helper.GetIDOfElement(c, "jobID", jobIDSource, jobIDBody)
+	if err != nil {
+		return false, job
+	}
+
+	db := GetDB()
+	err = db.Find(&job, uint(jobID)).Error
+	if helper.DBNotFoundError(c, err, strconv.Itoa(jobID), "Job") {
+		return false, job
+	}
+
+	// admins have access to all jobs, users to the jobs they started
+	userID, _ := c.Get(UserIDCtx)
+	userRole, _ := c.Get(UserRoleCtx)
+	if userRole == "Admin" || job.UserID == userID.(uint) {
+		return true, job
+	}
+
+	// jobs operating on a scenario can be read by all users with access to the scenario
+	if operation == Read && job.ScenarioID != 0 {
+		ok, _ := CheckScenarioPermissions(c, Read, "body", int(job.ScenarioID))
+		return ok, job
+	}
+
+	helper.UnprocessableEntityError(c, "Access denied (user has no access to job).")
+	return false, job
+}
+
+func CheckAPITokenPermissions(c *gin.Context, operation CRUD, tokenIDSource string, tokenIDBody int) (bool, APIToken) {
+
+	var token APIToken
+
+	err := ValidateRole(c, ModelAPIToken, operation)
+	if err != nil {
+		helper.UnprocessableEntityError(c, fmt.Sprintf("Access denied (role validation of API token failed): %v", err.Error()))
+		return false, token
+	}
+
+	// API tokens must not be used to create further tokens or to list or revoke tokens
+	if IsAPITokenRequest(c) {
+		helper.UnprocessableEntityError(c, "Access denied (API tokens cannot be managed with API tokens).")
+		return false, token
+	}
+
+	if operation == Create || (operation == Read && tokenIDSource == "none") {
+		return true, token
+	}
+
+	tokenID, err := helper.GetIDOfElement(c, "tokenID", tokenIDSource, tokenIDBody)
+	if err != nil {
+		return false, token
+	}
+
+	db := GetDB()
+	err = db.Find(&token, uint(tokenID)).Error
+	if helper.DBNotFoundError(c, err, strconv.Itoa(tokenID), "API token") {
+		return false, token
+	}
+
+	// admins have access to all tokens, users to their own tokens
+	userID, _ := c.Get(UserIDCtx)
+	userRole, _ := c.Get(UserRoleCtx)
+	if userRole != "Admin" && token.UserID != userID.(uint) {
+		helper.UnprocessableEntityError(c, "Access denied (API token belongs to another user).")
+		return false, token
+	}
+
+	return true, token
+}
+
+// tokenAllowsScenario checks if the API token used for the request (if any) is not limited to another scenario
+func tokenAllowsScenario(c *gin.Context, scenarioID uint) bool {
+	tokenScenarioID := TokenScenarioID(c)
+	if tokenScenarioID != 0 && tokenScenarioID != scenarioID {
+		helper.UnprocessableEntityError(c, "Access denied (API token is limited to another scenario).")
+		return false
+	}
+	return true
+}
+
+// CheckRestorePermissions checks if the user is allowed to restore a soft-deleted item of the model
+// from the trash, which requires the permission to delete it; the scenario of the item may be in the trash as well
+func CheckRestorePermissions(c *gin.Context, model ModelName, scenarioID uint) bool {
+
+	err := ValidateRole(c, model, Delete)
+	if err != nil {
+		helper.UnprocessableEntityError(c, fmt.Sprintf("Access denied (role validation failed): %v", err.Error()))
+		return false
+	}
+
+	if !tokenAllowsScenario(c, scenarioID) {
+		return false
+	}
+
+	userID, _ := c.Get(UserIDCtx)
+
+	db := GetDB()
+	var so Scenario
+	err = db.Unscoped().Find(&so, scenarioID).Error
+	if helper.DBNotFoundError(c, err, strconv.FormatUint(uint64(scenarioID), 10), "Scenario") {
+		return false
+	}
+
+	u := User{}
+	err = db.Find(&u, userID.(uint)).Error
+	if err != nil {
+		helper.UnprocessableEntityError(c, "Access denied (user has no access or scenario is locked).")
+		return false
+	}
+
+	if u.Role == "Admin" {
+		return true
+	}
+
+	membership, err := GetScenarioMembership(so.ID, u.ID)
+	if err != nil || !u.Active || so.IsLocked {
+		helper.UnprocessableEntityError(c, "Access denied (user has no access or scenario is locked).")
+		return false
+	} else if err = ValidateScenarioRole(membership.Role, model, Delete); err != nil {
+		helper.UnprocessableEntityError(c, fmt.Sprintf("Access denied (role validation of scenario member failed): %v", err))
+		return false
+	}
+
+	return true
+}
@@ -43,6 +43,11 @@ const ModelComponentConfiguration = ModelName("component-configuration")
 const ModelSignal = ModelName("signal")
 const ModelFile = ModelName("file")
 const ModelResult = ModelName("result")
+const ModelJob = ModelName("job")
+const ModelAudit = ModelName("audit")
+const ModelScenarioMember = ModelName("scenario-member")
+const ModelAPIToken = ModelName("token")
+const ModelTrash = ModelName("trash")
 
 type CRUD string
 
@@ -84,6 +89,10 @@ var Roles = RoleActions{
 		ModelSignal:                        crud,
 		ModelFile:                          crud,
 		ModelResult:                        crud,
+		ModelJob:                           crud,
+		ModelAudit:                         _r__,
+		ModelAPIToken:                      crud,
+		ModelTrash:                         crud,
 	},
 	"User": {
 		ModelUser:                          _ru_,
@@ -98,6 +107,10 @@ var Roles = RoleActions{
 		ModelSignal:                        crud,
 		ModelFile:                          crud,
 		ModelResult:                        crud,
+		ModelJob:                           _ru_,
+		ModelAudit:                         none,
+		ModelAPIToken:                      crud,
+		ModelTrash:                         _r__,
 	},
 	"Guest": {
 		ModelScenario:                      _r__,
@@ -111,6 +124,10 @@ var Roles = RoleActions{
 		ModelSignal:                        _r__,
 		ModelFile:                          _r__,
 		ModelResult:                        none,
+		ModelJob:                           _r__,
+		ModelAudit:                         none,
+		ModelAPIToken:                      crud,
+		ModelTrash:                         none,
 	},
 	"Download": {
 		ModelScenario:                      none,
@@ -125,6 +142,10 @@ var Roles = RoleActions{
 		ModelSignal:                        none,
 		ModelFile:                          _r__,
 		ModelResult:                        none,
+		ModelJob:                           none,
+		ModelAudit:                         none,
+		ModelAPIToken:                      none,
+		ModelTrash:                         none,
 	},
 }
 
@@ -144,9 +165,74 @@ func ValidateRole(c *gin.Context, model ModelName, action CRUD) error {
 		return fmt.Errorf("action not allowed for role %v", role)
 	}
 
+	// Check if the API token used for the request (if any) allows the action on the model
+	if scope, exists := c.Get(APITokenScopeCtx); exists {
+		return validateTokenScope(scope.(string), model, action)
+	}
+
+	return nil
+}
+
+// Roles of the members of a scenario
+const ScenarioOwner = "owner"
+const ScenarioEditor = "editor"
+const ScenarioViewer = "viewer"
+
+// ScenarioRoles restricts what a member of a scenario is allowed to do
+// with the scenario, its members and its contents based on the role of the
+// member in the scenario. It applies in addition to the Roles of the user.
+var ScenarioRoles = RoleActions{
+	ScenarioOwner: {
+		ModelScenario:               crud,
+		ModelScenarioMember:         crud,
+		ModelComponentConfiguration: crud,
+		ModelSignal:                 crud,
+		ModelDashboard:              crud,
+		ModelWidget:                 crud,
+		ModelFile:                   crud,
+		ModelResult:                 crud,
+	},
+	ScenarioEditor: {
+		ModelScenario:               _ru_,
+		ModelScenarioMember:         _r__,
+		ModelComponentConfiguration: crud,
+		ModelSignal:                 crud,
+		ModelDashboard:              crud,
+		ModelWidget:                 crud,
+		ModelFile:                   crud,
+		ModelResult:                 crud,
+	},
+	ScenarioViewer: {
+		ModelScenario:               _r__,
+		ModelScenarioMember:         _r__,
+		ModelComponentConfiguration: _r__,
+		ModelSignal:                 _r__,
+		ModelDashboard:              _r__,
+		ModelWidget:                 _r__,
+		ModelFile:                   _r__,
+		ModelResult:                 _r__,
+	},
+}
+
+// ValidateScenarioRole returns an error if the role of a member of a
+// scenario does not allow the action on the model
+func ValidateScenarioRole(role string, model ModelName, action CRUD) error {
+	if _, ok := ScenarioRoles[role]; !ok {
+		return fmt.Errorf("invalid scenario role %v", role)
+	}
+
+	if !ScenarioRoles[role][model][action] {
+		return fmt.Errorf("action not allowed for %v of scenario", role)
+	}
+
 	return nil
 }
 
 // elements added to context about a user
 const UserIDCtx = "user_id"
 const UserRoleCtx = "user_role"
+const SessionIDCtx = "session_id"
+
+// elements added to context if a request is authenticated with an API token
+const APITokenScopeCtx = "api_token_scope"
+const APITokenScenarioCtx = "api_token_scenario"
@@ -0,0 +1,131 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// NewSession starts a session for a user and returns the session and its refresh token
+func NewSession(userID uint, expiresAfter time.Duration, refreshExpiresAfter time.Duration) (Session, string, error) {
+	var s Session
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return s, "", fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+	refreshToken := hex.EncodeToString(b)
+
+	now := time.Now()
+	s.UserID = userID
+	s.TokenID = uuid.New().String()
+	s.RefreshHash = hashSecret(refreshToken)
+	s.ExpiresAt = now.Add(expiresAfter)
+	s.RefreshExpiresAt = now.Add(refreshExpiresAfter)
+
+	db := GetDB()
+	err = db.Create(&s).Error
+	if err != nil {
+		return s, "", err
+	}
+
+	// clean up sessions which can no longer be used
+	err = db.Unscoped().Where("refresh_expires_at < ?", now).Delete(&Session{}).Error
+
+	return s, refreshToken, err
+}
+
+// ActiveSession returns the session of a JWT if it was not revoked
+func ActiveSession(tokenID string) (Session, error) {
+	var s Session
+	err := GetDB().Where("token_id = ? AND revoked_at IS NULL", tokenID).First(&s).Error
+	return s, err
+}
+
+// RefreshableSession returns the session of a refresh token if it was neither revoked nor expired
+func RefreshableSession(refreshToken string) (Session, error) {
+	var s Session
+	err := GetDB().Where("refresh_hash = ? AND revoked_at IS NULL AND refresh_expires_at > ?",
+		hashSecret(refreshToken), time.Now()).First(&s).Error
+	return s, err
+}
+
+// RevokeSession invalidates the JWT and the refresh token of a session
+func RevokeSession(sessionID uint) error {
+	return GetDB().Model(&Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).
+		UpdateColumn("revoked_at", time.Now()).Error
+}
+
+// RevokeRefreshedSession revokes a session whose refresh token is used to start a new session; it returns
+// false if the session was revoked in the meantime, e.g. by a concurrent refresh with the same token
+func RevokeRefreshedSession(sessionID uint) (bool, error) {
+	result := GetDB().Model(&Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).
+		UpdateColumn("revoked_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeUserSessions invalidates the JWTs and refresh tokens of all sessions of a user
+func RevokeUserSessions(userID uint) error {
+	return GetDB().Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		UpdateColumn("revoked_at", time.Now()).Error
+}
+
+// NewOIDCLogin keeps the secrets of a login started at the OpenID Connect provider until the login is completed
+func NewOIDCLogin(state string, verifier string, nonce string, expiresAfter time.Duration) error {
+	now := time.Now()
+	l := OIDCLogin{
+		StateHash: hashSecret(state),
+		Verifier:  verifier,
+		Nonce:     nonce,
+		ExpiresAt: now.Add(expiresAfter),
+	}
+
+	db := GetDB()
+	err := db.Create(&l).Error
+	if err != nil {
+		return err
+	}
+
+	// clean up logins which were never completed
+	return db.Unscoped().Where("expires_at < ?", now).Delete(&OIDCLogin{}).Error
+}
+
+// CompleteOIDCLogin removes and returns the login of a state if it has not expired; a login can only be
+// completed once, even by concurrent requests
+func CompleteOIDCLogin(state string) (OIDCLogin, error) {
+	var l OIDCLogin
+
+	db := GetDB()
+	err := db.Where("state_hash = ? AND expires_at > ?", hashSecret(state), time.Now()).First(&l).Error
+	if err != nil {
+		return l, err
+	}
+
+	result := db.Unscoped().Where("id = ?", l.ID).Delete(&OIDCLogin{})
+	if result.Error == nil && result.RowsAffected != 1 {
+		return l, gorm.ErrRecordNotFound
+	}
+	return l, result.Error
+}
@@ -0,0 +1,31 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package database
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SetDeletionTime makes all rows which are soft-deleted within the transaction tx share one deletion
+// time; rows deleted together are identified by their deletion time when restored from the trash
+func SetDeletionTime(tx *gorm.DB) {
+	now := gorm.NowFunc()
+	tx.SetNowFuncOverride(func() time.Time { return now })
+}
@@ -19,7 +19,12 @@ package api
 
 //lint:file-ignore U1000 Ignore all unused code, it's generated
 
-import "git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+import (
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	infrastructure_component "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/infrastructure-component"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/trash"
+)
 
 // This file defines the responses to any endpoint in the backend
 // The defined structures are only used for documentation purposes with swaggo and are NOT used in the code
@@ -29,11 +34,18 @@ type ResponseError struct {
 	message string
 }
 
-type ResponseAuthenticate struct {
+type ResponseSchemaError struct {
 	success bool
-	token   string
 	message string
-	user    database.User
+	errors  []helper.SchemaError
+}
+
+type ResponseAuthenticate struct {
+	success      bool
+	token        string
+	refreshToken string
+	message      string
+	user         database.User
 }
 
 type ResponseUsers struct {
@@ -48,6 +60,33 @@ type ResponseICs struct {
 	ics []database.InfrastructureComponent
 }
 
+type ResponseICActions struct {
+	actions []database.ICAction
+}
+
+type ResponseICAction struct {
+	action database.ICAction
+}
+
+type ResponseICHistory struct {
+	history      []database.ICStateSample
+	availability infrastructure_component.Availability
+}
+
+type ResponseReservations struct {
+	reservations []database.Reservation
+}
+
+type ResponseReservation struct {
+	reservation database.Reservation
+}
+
+type ResponseSentActions struct {
+	success bool
+	message string
+	actions []database.ICAction
+}
+
 type ResponseIC struct {
 	ic database.InfrastructureComponent
 }
@@ -115,3 +154,46 @@ type ResponseResults struct {
 type ResponseResult struct {
 	result database.Result
 }
+
+type ResponseJobs struct {
+	jobs []database.Job
+}
+
+type ResponseJob struct {
+	job database.Job
+}
+
+type ResponseScenarioRun struct {
+	job    database.Job
+	result database.Result
+}
+
+type ResponseAudit struct {
+	audit []database.AuditEntry
+}
+
+type ResponseScenarioMembers struct {
+	members []database.ScenarioMembership
+}
+
+type ResponseAPITokens struct {
+	tokens []database.APIToken
+}
+
+type ResponseAPIToken struct {
+	token database.APIToken
+}
+
+type ResponseNewAPIToken struct {
+	token  database.APIToken
+	secret string
+}
+
+type ResponseTrash struct {
+	trash []trash.Item
+}
+
+type ResponseRestored struct {
+	item     trash.Item
+	restored map[string]int
+}
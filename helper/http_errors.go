@@ -98,3 +98,10 @@ func ForbiddenError(c *gin.Context, err string) {
 		"message": fmt.Sprintf("%v", err),
 	})
 }
+
+func ConflictError(c *gin.Context, err string) {
+	c.JSON(http.StatusConflict, gin.H{
+		"success": false,
+		"message": fmt.Sprintf("%v", err),
+	})
+}
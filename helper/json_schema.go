@@ -0,0 +1,87 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// SchemaError describes a violation of a JSON schema by a field of a JSON document
+type SchemaError struct {
+	// Field that violates the schema in dot notation, "(root)" for the document itself
+	Field string `json:"field"`
+	// Type of the violation, e.g. required, invalid_type or enum
+	Type string `json:"type"`
+	// Human readable description of the violation
+	Message string `json:"message"`
+}
+
+// ValidateJSONSchema validates a JSON document against a JSON schema and
+// returns the violations of the schema. An empty schema accepts any document.
+// An error is returned if the schema itself is invalid.
+func ValidateJSONSchema(schema []byte, document []byte) ([]SchemaError, error) {
+	schema = bytes.TrimSpace(schema)
+	if len(schema) == 0 || bytes.Equal(schema, []byte("null")) {
+		return nil, nil
+	}
+
+	document = bytes.TrimSpace(document)
+	if len(document) == 0 {
+		document = []byte("null")
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate against JSON schema: %w", err)
+	}
+
+	var errs []SchemaError
+	for _, e := range result.Errors() {
+		field := e.Field()
+		if e.Type() == "required" {
+			// the field of a missing property is its parent
+			property := fmt.Sprint(e.Details()["property"])
+			if field == gojsonschema.STRING_CONTEXT_ROOT {
+				field = property
+			} else {
+				field = field + "." + property
+			}
+		}
+
+		errs = append(errs, SchemaError{
+			Field:   field,
+			Type:    e.Type(),
+			Message: e.Description(),
+		})
+	}
+
+	return errs, nil
+}
+
+func SchemaValidationError(c *gin.Context, err string, errs []SchemaError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"success": false,
+		"message": fmt.Sprintf("%v", err),
+		"errors":  errs,
+	})
+}
@@ -0,0 +1,268 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+)
+
+// States of a job
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+// DefaultWorkers is the number of workers used if jobs are submitted before Start is called
+const DefaultWorkers = 4
+
+// maximum number of jobs waiting for a worker
+const queueSize = 1024
+
+// Func is the work of a job; it is executed by one of the workers and
+// should return as soon as possible once ctx is cancelled
+type Func func(ctx context.Context, j *Job) error
+
+// Job is passed to a running Func to report its progress and result
+type Job struct {
+	database.Job
+}
+
+type task struct {
+	job *Job
+	fn  Func
+	ctx context.Context
+}
+
+var (
+	queue     chan task
+	startOnce sync.Once
+	active    sync.WaitGroup
+	mutex     sync.Mutex
+	cancels   = make(map[uint]context.CancelFunc) // key: job ID
+)
+
+// Start launches the worker pool; jobs left pending or running by a
+// previous instance of the backend are marked as failed since their work is lost
+func Start(workers int) {
+	startOnce.Do(func() {
+		if workers < 1 {
+			workers = DefaultWorkers
+		}
+
+		err := failInterrupted()
+		if err != nil {
+			log.Println("error marking interrupted jobs as failed:", err)
+		}
+
+		queue = make(chan task, queueSize)
+		for i := 0; i < workers; i++ {
+			go worker()
+		}
+
+		log.Printf("Started %d job workers", workers)
+	})
+}
+
+// Submit creates a new job and queues it for execution by a worker
+func Submit(jobType string, userID uint, scenarioID uint, fn Func) (database.Job, error) {
+	Start(DefaultWorkers)
+
+	j := &Job{}
+	j.Type = jobType
+	j.State = StatePending
+	j.UserID = userID
+	j.ScenarioID = scenarioID
+
+	db := database.GetDB()
+	err := db.Create(&j.Job).Error
+	if err != nil {
+		return j.Job, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mutex.Lock()
+	cancels[j.ID] = cancel
+	mutex.Unlock()
+
+	active.Add(1)
+	select {
+	case queue <- task{job: j, fn: fn, ctx: ctx}:
+	default:
+		active.Done()
+		release(j.ID)
+		j.finish(StateFailed, "job queue is full")
+		return j.Job, fmt.Errorf("job queue is full, cannot run %s job", jobType)
+	}
+
+	return j.Job, nil
+}
+
+// Cancel requests the cancellation of a pending or running job
+func Cancel(id uint) error {
+	mutex.Lock()
+	cancel, ok := cancels[id]
+	mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("job %d is not pending or running", id)
+	}
+
+	cancel()
+
+	// pending jobs are marked as cancelled right away, running jobs once their Func returned
+	db := database.GetDB()
+	now := time.Now()
+	return db.Model(&database.Job{}).Where("id = ? AND state = ?", id, StatePending).Updates(map[string]interface{}{
+		"State":      StateCancelled,
+		"FinishedAt": &now,
+	}).Error
+}
+
+// Wait blocks until all submitted jobs are finished
+func Wait() {
+	active.Wait()
+}
+
+// SetProgress stores the progress (in percent) and the description of the current step of the job
+func (j *Job) SetProgress(progress uint, message string) {
+	j.Progress = progress
+	j.Message = message
+
+	db := database.GetDB()
+	err := db.Model(&j.Job).Updates(map[string]interface{}{
+		"Progress": progress,
+		"Message":  message,
+	}).Error
+	if err != nil {
+		log.Printf("error updating progress of job %d: %s", j.ID, err)
+	}
+}
+
+// SetResult stores the JSON encoding of result as result of the job
+func (j *Job) SetResult(result interface{}) error {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	j.Result.RawMessage = raw
+
+	db := database.GetDB()
+	return db.Model(&j.Job).Update("Result", j.Result).Error
+}
+
+func (j *Job) finish(state string, errMsg string) {
+	now := time.Now()
+	j.State = state
+	j.Error = errMsg
+	j.FinishedAt = &now
+
+	updates := map[string]interface{}{
+		"State":      state,
+		"Error":      errMsg,
+		"FinishedAt": &now,
+	}
+	if state == StateSucceeded {
+		j.Progress = 100
+		updates["Progress"] = j.Progress
+	}
+
+	db := database.GetDB()
+	err := db.Model(&j.Job).Updates(updates).Error
+	if err != nil {
+		log.Printf("error updating state of job %d: %s", j.ID, err)
+	}
+}
+
+func worker() {
+	for t := range queue {
+		run(t)
+	}
+}
+
+func run(t task) {
+	defer active.Done()
+	defer release(t.job.ID)
+
+	if t.ctx.Err() != nil {
+		t.job.finish(StateCancelled, "")
+		return
+	}
+
+	now := time.Now()
+	t.job.State = StateRunning
+	t.job.StartedAt = &now
+	db := database.GetDB()
+	err := db.Model(&t.job.Job).Updates(map[string]interface{}{
+		"State":     StateRunning,
+		"StartedAt": &now,
+	}).Error
+	if err != nil {
+		log.Printf("error updating state of job %d: %s", t.job.ID, err)
+	}
+
+	err = execute(t)
+	if t.ctx.Err() != nil {
+		t.job.finish(StateCancelled, "")
+	} else if err != nil {
+		log.Printf("%s job %d failed: %s", t.job.Type, t.job.ID, err)
+		t.job.finish(StateFailed, err.Error())
+	} else {
+		t.job.finish(StateSucceeded, "")
+	}
+}
+
+// execute runs the Func of a task, a panic fails the job instead of the backend
+func execute(t task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return t.fn(t.ctx, t.job)
+}
+
+func release(id uint) {
+	mutex.Lock()
+	cancel, ok := cancels[id]
+	delete(cancels, id)
+	mutex.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+func failInterrupted() error {
+	db := database.GetDB()
+	now := time.Now()
+	return db.Model(&database.Job{}).Where("state IN (?)", []string{StatePending, StateRunning}).Updates(map[string]interface{}{
+		"State":      StateFailed,
+		"Error":      "interrupted by restart of backend",
+		"FinishedAt": &now,
+	}).Error
+}
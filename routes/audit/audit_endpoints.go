@@ -0,0 +1,111 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAuditEndpoints(r *gin.RouterGroup) {
+	r.GET("", getAuditEntries)
+}
+
+// getAuditEntries godoc
+// @Summary Get the audit log of mutating operations (admin only)
+// @ID getAuditEntries
+// @Produce  json
+// @Tags audit
+// @Success 200 {object} api.ResponseAudit "Audit log entries"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param userID query int false "Only return entries of operations performed by this user"
+// @Param model query string false "Only return entries of this model"
+// @Param scenarioID query int false "Only return entries of this scenario"
+// @Param operation query string false "Only return entries of this operation" Enums(create, update, delete, action, purge)
+// @Param from query string false "Only return entries recorded at or after this time (RFC3339)"
+// @Param to query string false "Only return entries recorded at or before this time (RFC3339)"
+// @Router /audit [get]
+// @Security Bearer
+func getAuditEntries(c *gin.Context) {
+
+	err := database.ValidateRole(c, database.ModelAudit, database.Read)
+	if err != nil {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	}
+
+	db := database.GetDB()
+	query := db.Order("ID asc")
+
+	if userID := c.Query("userID"); userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 0)
+		if err != nil {
+			helper.BadRequestError(c, "invalid userID: "+err.Error())
+			return
+		}
+		query = query.Where("user_id = ?", uint(id))
+	}
+
+	if model := c.Query("model"); model != "" {
+		query = query.Where("model_name = ?", model)
+	}
+
+	if scenarioID := c.Query("scenarioID"); scenarioID != "" {
+		id, err := strconv.ParseUint(scenarioID, 10, 0)
+		if err != nil {
+			helper.BadRequestError(c, "invalid scenarioID: "+err.Error())
+			return
+		}
+		query = query.Where("scenario_id = ?", uint(id))
+	}
+
+	if operation := c.Query("operation"); operation != "" {
+		query = query.Where("operation = ?", operation)
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			helper.BadRequestError(c, "invalid from time: "+err.Error())
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			helper.BadRequestError(c, "invalid to time: "+err.Error())
+			return
+		}
+		query = query.Where("created_at <= ?", t)
+	}
+
+	var entries []database.AuditEntry
+	err = query.Find(&entries).Error
+	if !helper.DBError(c, err) {
+		c.JSON(http.StatusOK, gin.H{"audit": entries})
+	}
+}
@@ -0,0 +1,171 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package audit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var router *gin.Engine
+
+// ID of user A added by database.AddTestUsers
+const userAID = 2
+
+type ScenarioRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+type UserRequest struct {
+	Mail string `json:"mail,omitempty"`
+}
+
+func TestMain(m *testing.M) {
+	err := configuration.InitConfig()
+	if err != nil {
+		panic(m)
+	}
+
+	err = database.InitDB(configuration.GlobalConfig, true)
+	if err != nil {
+		panic(m)
+	}
+	defer database.DBpool.Close()
+
+	router = gin.Default()
+	api := router.Group("/api/v2")
+
+	user.RegisterAuthenticate(api.Group("/authenticate"))
+	api.Use(user.Authentication())
+	scenario.RegisterScenarioEndpoints(api.Group("/scenarios"))
+	user.RegisterUserEndpoints(api.Group("/users"))
+	RegisterAuditEndpoints(api.Group("/audit"))
+
+	os.Exit(m.Run())
+}
+
+func TestGetAuditEntries(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as normal user
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	// create and rename a scenario as user A
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": ScenarioRequest{Name: "Scenario1"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	scenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v", scenarioID), "PUT", helper.KeyModels{"scenario": ScenarioRequest{Name: "Scenario2"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// try to read the audit log as normal user
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/audit", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// authenticate as admin
+	token, err = helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// get all entries of the scenario
+	numberOfEntries, err := helper.LengthOfResponse(router, token,
+		fmt.Sprintf("/api/v2/audit?scenarioID=%v", scenarioID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, numberOfEntries)
+
+	// get the update of the scenario
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/audit?model=scenario&operation=update&userID=%v", userAID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"audit": []map[string]interface{}{{
+		"userID":     userAID,
+		"role":       "User",
+		"operation":  "update",
+		"model":      "scenario",
+		"objectID":   scenarioID,
+		"scenarioID": scenarioID,
+		"diff": map[string]interface{}{
+			"name": map[string]interface{}{"before": "Scenario1", "after": "Scenario2"},
+		},
+	}}})
+	assert.NoError(t, err)
+
+	// no entries of other users
+	numberOfEntries, err = helper.LengthOfResponse(router, token,
+		"/api/v2/audit?userID=3", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, numberOfEntries)
+
+	// no entries recorded in the future
+	numberOfEntries, err = helper.LengthOfResponse(router, token,
+		"/api/v2/audit?from=2100-01-01T00:00:00Z", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, numberOfEntries)
+
+	// try to filter with an invalid time or ID
+	// should return bad request errors
+	for _, filter := range []string{"to=yesterday", "userID=abc", "scenarioID=-1"} {
+		code, resp, err = helper.TestEndpoint(router, token,
+			"/api/v2/audit?"+filter, "GET", nil)
+		assert.NoError(t, err)
+		assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+	}
+
+	// change the mail address of user A as admin
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/users/%v", userAID), "PUT", helper.KeyModels{"user": UserRequest{Mail: "new@example.com"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// the entry contains the mail address before the update
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/audit?model=user&operation=update", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"audit": []map[string]interface{}{{
+		"operation": "update",
+		"model":     "user",
+		"objectID":  userAID,
+		"diff": map[string]interface{}{
+			"mail": map[string]interface{}{"before": database.UserA.Mail, "after": "new@example.com"},
+		},
+	}}})
+	assert.NoError(t, err)
+}
@@ -72,7 +72,7 @@ func getConfigs(c *gin.Context) {
 // @Success 200 {object} api.ResponseConfig "Component configuration that was added"
 // @Failure 400 {object} api.ResponseError "Bad request"
 // @Failure 404 {object} api.ResponseError "Not found"
-// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 422 {object} api.ResponseSchemaError "Unprocessable entity, e.g. start parameters which do not match the schema of the IC"
 // @Failure 500 {object} api.ResponseError "Internal server error"
 // @Param inputConfig body component_configuration.addConfigRequest true "component configuration to be added incl. IDs of scenario and IC"
 // @Router /configs [post]
@@ -102,9 +102,15 @@ func addConfig(c *gin.Context) {
 		return
 	}
 
+	if errs := newConfig.validateStartParameters(); len(errs) > 0 {
+		helper.SchemaValidationError(c, "Start parameters do not match the schema of the IC", errs)
+		return
+	}
+
 	// add the new Component Configuration to the scenario
 	err = newConfig.addToScenario()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelComponentConfiguration, newConfig.ID, newConfig.ScenarioID, nil, newConfig.ComponentConfiguration)
 		c.JSON(http.StatusOK, gin.H{"config": newConfig.ComponentConfiguration})
 	}
 
@@ -119,7 +125,7 @@ func addConfig(c *gin.Context) {
 // @Success 200 {object} api.ResponseConfig "Component configuration that was added"
 // @Failure 400 {object} api.ResponseError "Bad request"
 // @Failure 404 {object} api.ResponseError "Not found"
-// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 422 {object} api.ResponseSchemaError "Unprocessable entity, e.g. start parameters which do not match the schema of the IC"
 // @Failure 500 {object} api.ResponseError "Internal server error"
 // @Param inputConfig body component_configuration.updateConfigRequest true "component configuration to be updated"
 // @Param configID path int true "Config ID"
@@ -152,9 +158,19 @@ func updateConfig(c *gin.Context) {
 	// Create the updateConfig from oldConfig
 	updatedConfig := req.updateConfig(oldConfig)
 
+	// start parameters are only validated if they or the IC change, the schema of the IC may have changed meanwhile
+	if updatedConfig.ICID != oldConfig.ICID ||
+		string(updatedConfig.StartParameters.RawMessage) != string(oldConfig.StartParameters.RawMessage) {
+		if errs := updatedConfig.validateStartParameters(); len(errs) > 0 {
+			helper.SchemaValidationError(c, "Start parameters do not match the schema of the IC", errs)
+			return
+		}
+	}
+
 	// Finally, update the Component Configuration
 	err = oldConfig.Update(updatedConfig)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelComponentConfiguration, oldConfig_r.ID, oldConfig_r.ScenarioID, oldConfig_r, updatedConfig.ComponentConfiguration)
 		c.JSON(http.StatusOK, gin.H{"config": updatedConfig.ComponentConfiguration})
 	}
 
@@ -208,6 +224,7 @@ func deleteConfig(c *gin.Context) {
 
 	err := m.delete()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelComponentConfiguration, m.ID, m.ScenarioID, m.ComponentConfiguration, nil)
 		c.JSON(http.StatusOK, gin.H{"config": m.ComponentConfiguration})
 	}
 }
@@ -22,6 +22,7 @@ import (
 	"log"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
 )
 
 type ComponentConfiguration struct {
@@ -75,6 +76,29 @@ func (m *ComponentConfiguration) addToScenario() error {
 	return err
 }
 
+// validateStartParameters returns the violations of the start parameter
+// schema of the IC by the start parameters of the component configuration
+func (m *ComponentConfiguration) validateStartParameters() []helper.SchemaError {
+	if m.ICID == 0 {
+		return nil
+	}
+
+	var ic database.InfrastructureComponent
+	err := database.GetDB().Find(&ic, m.ICID).Error
+	if err != nil {
+		// component configurations are not required to refer to an existing IC
+		return nil
+	}
+
+	errs, err := helper.ValidateJSONSchema(ic.StartParameterSchema.RawMessage, m.StartParameters.RawMessage)
+	if err != nil {
+		log.Printf("Cannot validate start parameters of component configuration %v against schema of IC %v (ID=%d): %v", m.Name, ic.Name, ic.ID, err)
+		return nil
+	}
+
+	return errs
+}
+
 func (m *ComponentConfiguration) Update(modifiedConfig ComponentConfiguration) error {
 	db := database.GetDB()
 
@@ -114,80 +138,62 @@ func (m *ComponentConfiguration) Update(modifiedConfig ComponentConfiguration) e
 	return err
 }
 
+// delete soft-deletes the component configuration and its signals at the same time, so that they can be restored from the trash
 func (m *ComponentConfiguration) delete() error {
 
-	db := database.GetDB()
-	var so database.Scenario
-	err := db.Find(&so, m.ScenarioID).Error
-	if err != nil {
-		return err
-	}
-
-	// remove association between ComponentConfiguration and Scenario
-	log.Println("DELETE ASSOCIATION to scenario ", so.ID, "(name="+so.Name+")")
-	err = db.Model(&so).Association("ComponentConfigurations").Delete(m).Error
-	if err != nil {
-		return err
-	}
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		database.SetDeletionTime(tx)
 
-	// Get Signals of InputMapping and delete them
-	var InputMappingSignals []database.Signal
-	err = db.Model(m).Related(&InputMappingSignals, "InputMapping").Error
-	if err != nil {
-		return err
-	}
-	for _, sig := range InputMappingSignals {
-		log.Println("DELETE signal ", sig.ID, "(name="+sig.Name+")")
-		err = db.Delete(&sig).Error
+		// Get Signals of InputMapping and delete them
+		var InputMappingSignals []database.Signal
+		err := tx.Model(m).Related(&InputMappingSignals, "InputMapping").Error
 		if err != nil {
 			return err
 		}
-	}
+		for _, sig := range InputMappingSignals {
+			log.Println("DELETE signal ", sig.ID, "(name="+sig.Name+")")
+			err = tx.Delete(&sig).Error
+			if err != nil {
+				return err
+			}
+		}
 
-	// Get Signals of OutputMapping and delete them
-	var OutputMappingSignals []database.Signal
-	err = db.Model(m).Related(&OutputMappingSignals, "OutputMapping").Error
-	if err != nil {
-		return err
-	}
-	for _, sig := range OutputMappingSignals {
-		log.Println("DELETE signal ", sig.ID, "(name="+sig.Name+")")
-		err = db.Delete(&sig).Error
+		// Get Signals of OutputMapping and delete them
+		var OutputMappingSignals []database.Signal
+		err = tx.Model(m).Related(&OutputMappingSignals, "OutputMapping").Error
 		if err != nil {
 			return err
 		}
-	}
+		for _, sig := range OutputMappingSignals {
+			log.Println("DELETE signal ", sig.ID, "(name="+sig.Name+")")
+			err = tx.Delete(&sig).Error
+			if err != nil {
+				return err
+			}
+		}
 
-	var ic database.InfrastructureComponent
-	err = db.Find(&ic, m.ICID).Error
-	if err == nil {
-		// remove association between Infrastructure component and config
-		log.Println("DELETE ASSOCIATION to IC ", ic.ID, "(name="+ic.Name+")")
-		err = db.Model(&ic).Association("ComponentConfigurations").Delete(m).Error
+		// delete component configuration
+		err = tx.Delete(m).Error
 		if err != nil {
 			return err
 		}
 
-		// if IC has state gone and there is no component configuration associated with it: delete IC
-		no_configs := db.Model(&ic).Association("ComponentConfigurations").Count()
-		if no_configs == 0 && ic.State == "gone" {
-			log.Println("DELETE IC with state gone, last component config deleted", ic.UUID)
-			err = db.Delete(&ic).Error
-			return err
-		}
-	} else {
+		var ic database.InfrastructureComponent
+		err = tx.Find(&ic, m.ICID).Error
 		if err == gorm.ErrRecordNotFound {
-			log.Printf("SKIPPING IC association removal, IC with id=%v not found\n", m.ICID)
-		} else {
+			log.Printf("SKIPPING IC deletion check, IC with id=%v not found\n", m.ICID)
+			return nil
+		} else if err != nil {
 			return err
 		}
-	}
 
-	// delete component configuration
-	err = db.Delete(m).Error
-	if err != nil {
-		return err
-	}
+		// if IC has state gone and there is no component configuration associated with it: delete IC
+		no_configs := tx.Model(&ic).Association("ComponentConfigurations").Count()
+		if no_configs == 0 && ic.State == "gone" {
+			log.Println("DELETE IC with state gone, last component config deleted", ic.UUID)
+			return tx.Delete(&ic).Error
+		}
 
-	return nil
+		return nil
+	})
 }
@@ -494,3 +494,115 @@ func TestGetAllConfigsOfScenario(t *testing.T) {
 	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
 
 }
+
+func TestStartParameterSchema(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	scenarioID, ICID := addScenarioAndIC()
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// add an IC with a JSON schema for its start parameters
+	newIC := ICRequest{
+		UUID:     "4854af30-325f-44a5-ad59-b67b2597de99",
+		Type:     "dpsim",
+		Name:     "Simulator with schema",
+		Category: "simulator",
+		State:    "idle",
+		StartParameterSchema: postgres.Jsonb{RawMessage: json.RawMessage(`{
+			"type": "object",
+			"required": ["timestep"],
+			"properties": {
+				"timestep": {"type": "number"},
+				"solver": {"enum": ["EMT", "DP"]}
+			}
+		}`)},
+		ManagedExternally: newFalse(),
+	}
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	schemaICID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// authenticate as normal user
+	token, err = helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	// try to POST a config with start parameters violating the schema
+	// should result in unprocessable entity with an error per field
+	invalidConfig := ConfigRequest{
+		Name:            "Invalid simulation",
+		ScenarioID:      scenarioID,
+		ICID:            uint(schemaICID),
+		StartParameters: postgres.Jsonb{RawMessage: json.RawMessage(`{"solver": "RMS"}`)},
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		baseAPIConfigs, "POST", helper.KeyModels{"config": invalidConfig})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	var schemaErrors struct {
+		Errors []helper.SchemaError `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &schemaErrors))
+	var fields []string
+	for _, e := range schemaErrors.Errors {
+		fields = append(fields, e.Field)
+	}
+	assert.ElementsMatch(t, []string{"timestep", "solver"}, fields)
+
+	// POST a config with valid start parameters
+	validConfig := invalidConfig
+	validConfig.Name = "Valid simulation"
+	validConfig.StartParameters = postgres.Jsonb{RawMessage: json.RawMessage(`{"timestep": 0.001, "solver": "EMT"}`)}
+	code, resp, err = helper.TestEndpoint(router, token,
+		baseAPIConfigs, "POST", helper.KeyModels{"config": validConfig})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	configID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// try to PUT start parameters violating the schema
+	// should result in unprocessable entity
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("%v/%v", baseAPIConfigs, configID), "PUT",
+		helper.KeyModels{"config": ConfigRequest{
+			StartParameters: postgres.Jsonb{RawMessage: json.RawMessage(`{"timestep": "fast"}`)},
+		}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// PUT a new name, the start parameters are not validated again
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("%v/%v", baseAPIConfigs, configID), "PUT",
+		helper.KeyModels{"config": ConfigRequest{Name: "Renamed simulation"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// the IC without schema accepts any start parameters
+	code, resp, err = helper.TestEndpoint(router, token,
+		baseAPIConfigs, "POST", helper.KeyModels{"config": ConfigRequest{
+			Name:            "Simulation on IC without schema",
+			ScenarioID:      scenarioID,
+			ICID:            ICID,
+			StartParameters: postgres.Jsonb{RawMessage: json.RawMessage(`{"solver": "RMS"}`)},
+		}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	otherConfigID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// try to move the config to the IC whose schema its start parameters violate
+	// should result in unprocessable entity
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("%v/%v", baseAPIConfigs, otherConfigID), "PUT",
+		helper.KeyModels{"config": ConfigRequest{ICID: uint(schemaICID)}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+}
@@ -35,8 +35,20 @@ type AuthenticationExternal struct {
 	LoginURL     string `json:"authorize_url"`
 }
 
+type AuthenticationOIDC struct {
+	Enabled      bool   `json:"enabled"`
+	ProviderName string `json:"provider_name"`
+	LoginURL     string `json:"authorize_url"`
+}
+
+type AuthenticationLDAP struct {
+	Enabled bool `json:"enabled"`
+}
+
 type Authentication struct {
 	External  AuthenticationExternal `json:"external"`
+	OIDC      AuthenticationOIDC     `json:"oidc"`
+	LDAP      AuthenticationLDAP     `json:"ldap"`
 	LogoutURL string                 `json:"logout_url"`
 }
 
@@ -88,6 +100,10 @@ func getConfig(c *gin.Context) {
 	resp.Authentication.External.Enabled, _ = cfg.Bool("auth.external.enabled")
 	resp.Authentication.External.LoginURL, _ = cfg.String("auth.external.login-url")
 	resp.Authentication.External.ProviderName, _ = cfg.String("auth.external.provider-name")
+	resp.Authentication.OIDC.Enabled, _ = cfg.Bool("auth.oidc.enabled")
+	resp.Authentication.OIDC.LoginURL = "/api/v2/authenticate/oidc"
+	resp.Authentication.OIDC.ProviderName, _ = cfg.String("auth.oidc.provider-name")
+	resp.Authentication.LDAP.Enabled, _ = cfg.Bool("auth.ldap.enabled")
 	resp.Title, _ = cfg.String("title")
 	resp.SubTitle, _ = cfg.String("sub-title")
 	resp.Contact.Name, _ = cfg.String("contact.name")
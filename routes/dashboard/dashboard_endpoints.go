@@ -105,6 +105,7 @@ func addDashboard(c *gin.Context) {
 	// add dashboard to DB and add association to scenario
 	err := newDashboard.addToScenario()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelDashboard, newDashboard.ID, newDashboard.ScenarioID, nil, newDashboard.Dashboard)
 		c.JSON(http.StatusOK, gin.H{"dashboard": newDashboard.Dashboard})
 	}
 
@@ -152,6 +153,7 @@ func updateDashboard(c *gin.Context) {
 	// update the dashboard in the DB
 	err := oldDashboard.update(updatedDashboard)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelDashboard, oldDashboard_r.ID, oldDashboard_r.ScenarioID, oldDashboard_r, updatedDashboard.Dashboard)
 		c.JSON(http.StatusOK, gin.H{"dashboard": updatedDashboard.Dashboard})
 	}
 
@@ -204,6 +206,7 @@ func deleteDashboard(c *gin.Context) {
 
 	err := dab.delete()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelDashboard, dab.ID, dab.ScenarioID, dab.Dashboard, nil)
 		c.JSON(http.StatusOK, gin.H{"dashboard": dab.Dashboard})
 	}
 
@@ -18,8 +18,10 @@
 package dashboard
 
 import (
-	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
 	"log"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"github.com/jinzhu/gorm"
 )
 
 type Dashboard struct {
@@ -74,39 +76,29 @@ func (d *Dashboard) update(modifiedDab Dashboard) error {
 	return err
 }
 
+// delete soft-deletes the dashboard and its widgets at the same time, so that they can be restored from the trash
 func (d *Dashboard) delete() error {
 
-	db := database.GetDB()
-	var sim database.Scenario
-	err := db.Find(&sim, d.ScenarioID).Error
-	if err != nil {
-		return err
-	}
-
-	// remove association between Dashboard and Scenario
-	err = db.Model(&sim).Association("Dashboards").Delete(d).Error
-	if err != nil {
-		return err
-	}
-
-	// get all widgets of the dashboard
-	var widgets []database.Widget
-	err = db.Order("ID asc").Model(d).Related(&widgets, "Widgets").Error
-	if err != nil {
-		return err
-	}
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		database.SetDeletionTime(tx)
 
-	// Delete widgets
-	for _, widget := range widgets {
-		log.Println("DELETE widget ", widget.ID, "(name="+widget.Name+")")
-		err = db.Delete(&widget).Error
+		// get all widgets of the dashboard
+		var widgets []database.Widget
+		err := tx.Order("ID asc").Model(d).Related(&widgets, "Widgets").Error
 		if err != nil {
 			return err
 		}
-	}
 
-	// Delete dashboard
-	err = db.Delete(d).Error
+		// Delete widgets
+		for _, widget := range widgets {
+			log.Println("DELETE widget ", widget.ID, "(name="+widget.Name+")")
+			err = tx.Delete(&widget).Error
+			if err != nil {
+				return err
+			}
+		}
 
-	return err
+		// Delete dashboard
+		return tx.Delete(d).Error
+	})
 }
@@ -76,7 +76,7 @@ func getFiles(c *gin.Context) {
 // @Accept model/x-cim
 // @Accept model/x-cim.zip
 // @Accept multipart/form-data
-// @Success 200 {object} api.ResponseFile "File that was added"
+// @Success 200 {object} api.ResponseFile "File that was added (incl. job uploading the file if S3 is used)"
 // @Failure 400 {object} api.ResponseError "Bad request"
 // @Failure 404 {object} api.ResponseError "Not found"
 // @Failure 422 {object} api.ResponseError "Unprocessable entity"
@@ -87,7 +87,7 @@ func getFiles(c *gin.Context) {
 // @Security Bearer
 func addFile(c *gin.Context) {
 
-	ok, so := database.CheckScenarioPermissions(c, database.Read, "query", -1)
+	ok, so := database.CheckScenarioPermissions(c, database.Update, "query", -1)
 	if !ok {
 		return
 	}
@@ -102,7 +102,8 @@ func addFile(c *gin.Context) {
 	var newFile File
 	err = newFile.Register(fileHeader, so.ID)
 	if !helper.DBError(c, err) {
-		c.JSON(http.StatusOK, gin.H{"file": newFile.File})
+		database.Audit(c, database.Create, database.ModelFile, newFile.ID, newFile.ScenarioID, nil, newFile.File)
+		c.JSON(http.StatusOK, fileResponse(newFile))
 	}
 
 }
@@ -145,6 +146,11 @@ func getFile(c *gin.Context) {
 	var f File
 	f.File = f_r
 
+	if !f.hasData() {
+		helper.NotFoundError(c, "The data of the file is not uploaded yet")
+		return
+	}
+
 	err := f.download(c)
 	helper.DBError(c, err)
 }
@@ -161,7 +167,7 @@ func getFile(c *gin.Context) {
 // @Accept model/x-cim
 // @Accept model/x-cim.zip
 // @Accept multipart/form-data
-// @Success 200 {object} api.ResponseFile "File that was updated"
+// @Success 200 {object} api.ResponseFile "File that was updated (incl. job uploading the file if S3 is used)"
 // @Failure 400 {object} api.ResponseError "Bad request"
 // @Failure 404 {object} api.ResponseError "Not found"
 // @Failure 422 {object} api.ResponseError "Unprocessable entity"
@@ -190,7 +196,8 @@ func updateFile(c *gin.Context) {
 
 	err = f.update(fileHeader)
 	if !helper.DBError(c, err) {
-		c.JSON(http.StatusOK, gin.H{"file": f.File})
+		database.Audit(c, database.Update, database.ModelFile, f_r.ID, f_r.ScenarioID, f_r, f.File)
+		c.JSON(http.StatusOK, fileResponse(f))
 	}
 }
 
@@ -220,7 +227,18 @@ func deleteFile(c *gin.Context) {
 
 	err := f.Delete()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelFile, f.ID, f.ScenarioID, f.File, nil)
 		c.JSON(http.StatusOK, gin.H{"file": f.File})
 	}
 
 }
+
+// fileResponse returns the response body for a file, including the job
+// uploading the file to the S3 object storage (if any)
+func fileResponse(f File) gin.H {
+	resp := gin.H{"file": f.File}
+	if job := f.UploadJob(); job != nil {
+		resp["job"] = job
+	}
+	return resp
+}
@@ -18,6 +18,7 @@
 package file
 
 import (
+	"context"
 	"fmt"
 	"image"
 	_ "image/gif"
@@ -26,19 +27,26 @@ import (
 	"io"
 	"log"
 	"mime/multipart"
-	"net/http"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
 )
 
 type File struct {
 	database.File
+	// job uploading the file to the S3 object storage (if any)
+	uploadJob *database.Job
+}
+
+// UploadJob returns the job uploading the file to the S3 object storage,
+// nil if the file is stored in the DB
+func (f *File) UploadJob() *database.Job {
+	return f.uploadJob
 }
 
 func (f *File) ByID(id uint) error {
@@ -58,23 +66,11 @@ func (f *File) save() error {
 }
 
 func (f *File) download(c *gin.Context) error {
-
-	if f.Key == "" {
-		// Seems this headers needed for some browsers (for example without this headers Chrome will download files as txt)
-		c.Header("Content-Description", "File Transfer")
-		c.Header("Content-Disposition", "attachment; filename="+f.Name)
-		c.Header("Expires", "")
-		c.Header("Cache-Control", "")
-		c.Data(http.StatusOK, f.Type, f.FileData)
-	} else {
-		url, err := f.getS3Url()
-		if err != nil {
-			return fmt.Errorf("failed to presign S3 request: %s", err)
-		}
-		c.Redirect(http.StatusFound, url)
+	s, err := f.storage()
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return s.Serve(c, f)
 }
 
 func (f *File) Register(fileHeader *multipart.FileHeader, scenarioID uint) error {
@@ -84,7 +80,6 @@ func (f *File) Register(fileHeader *multipart.FileHeader, scenarioID uint) error
 	f.Name = filepath.Base(fileHeader.Filename)
 	f.Size = uint(fileHeader.Size)
 	f.Date = time.Now().String()
-	f.ScenarioID = scenarioID
 
 	// set file data
 	fileContent, err := fileHeader.Open()
@@ -93,46 +88,130 @@ func (f *File) Register(fileHeader *multipart.FileHeader, scenarioID uint) error
 	}
 	defer fileContent.Close()
 
-	bucket, err := configuration.GlobalConfig.String("s3.bucket")
-	if err != nil || bucket == "" {
-		// s3 object storage not used, s3.bucket param is empty
-		// save file to postgres DB
-		f.FileData, err = io.ReadAll(fileContent)
-		if err != nil {
-			return err
-		}
-		f.Key = ""
-	} else {
-		err := f.putS3(fileContent)
-		if err != nil {
-			return fmt.Errorf("failed to upload to S3 bucket: %s", err)
-		}
-		log.Println("Saved new file in S3 object storage")
+	return f.store(fileContent, scenarioID)
+}
+
+// Import adds a file with the given content to a scenario,
+// name, type and date of the file have to be set by the caller
+func (f *File) Import(content io.ReadSeeker, scenarioID uint) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	f.Size = uint(size)
+
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	return f.store(content, scenarioID)
+}
+
+// Open returns a reader of the data of a file, no matter which storage driver keeps it;
+// the reader has to be closed by the caller
+func (f *File) Open(ctx context.Context) (io.ReadCloser, error) {
+	if !f.hasData() {
+		return nil, fmt.Errorf("the data of file %v is not stored yet", f.ID)
+	}
+
+	s, err := f.storage()
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, f)
+}
+
+// Content returns the data of a file, the data is read into memory
+func (f *File) Content() ([]byte, error) {
+	content, err := f.Open(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	return io.ReadAll(content)
+}
+
+// StoreData stores the content of a file under a new key in the configured storage without saving the file,
+// the content is stored synchronously by all drivers. The file has to be saved by the caller (e.g. in a
+// transaction), the data has to be deleted with DeleteData if the file is not saved.
+func (f *File) StoreData(ctx context.Context, content io.ReadSeeker) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	f.Size = uint(size)
+
+	err = f.setImageDimensions(content)
+	if err != nil {
+		return err
+	}
+
+	stored := *f
+	stored.Storage = configuredStorage()
+	stored.Key = uuid.New().String()
+	stored.FileData = nil
+
+	s, err := stored.storage()
+	if err != nil {
+		return err
+	}
+
+	err = s.Put(ctx, &stored, content)
+	if err != nil {
+		return err
+	}
+
+	*f = stored
+	return nil
+}
+
+// DeleteData deletes the data of a file which is not saved (anymore), unless it is referenced by other files
+func (f *File) DeleteData(ctx context.Context) error {
+	return deleteData(ctx, f)
+}
+
+// setImageDimensions decodes the dimensions of the content in case the file is an image,
+// the reader is set back to the start of the content
+func (f *File) setImageDimensions(fileContent io.ReadSeeker) error {
+	_, err := fileContent.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("error on setting file reader back to start of file: %v", err)
 	}
 
 	// Add image dimensions in case the file is an image
 	if strings.Contains(f.Type, "image") || strings.Contains(f.Type, "Image") {
-		// set the file reader back to the start of the file
-		_, err := fileContent.Seek(0, 0)
-		if err == nil {
-
-			imageConfig, _, err := image.DecodeConfig(fileContent)
-			if err != nil {
-				log.Println("unable to decode image configuration: Dimensions of image file are not set, using default size 512x512, error:", err)
-				f.ImageWidth = 512
-				f.ImageHeight = 512
-			} else {
-				f.ImageHeight = imageConfig.Height
-				f.ImageWidth = imageConfig.Width
-			}
-
+		imageConfig, _, err := image.DecodeConfig(fileContent)
+		if err != nil {
+			log.Println("unable to decode image configuration: Dimensions of image file are not set, using default size 512x512, error:", err)
+			f.ImageWidth = 512
+			f.ImageHeight = 512
 		} else {
-			return fmt.Errorf("error on setting file reader back to start of file, dimensions not updated: %v", err)
+			f.ImageHeight = imageConfig.Height
+			f.ImageWidth = imageConfig.Width
 		}
 	}
 
+	// set the file reader back to the start of the file
+	_, err = fileContent.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("error on setting file reader back to start of file: %v", err)
+	}
+	return nil
+}
+
+func (f *File) store(fileContent io.ReadSeeker, scenarioID uint) error {
+
+	f.ScenarioID = scenarioID
+
+	err := f.setImageDimensions(fileContent)
+	if err != nil {
+		return err
+	}
+
 	// Add File object with parameters to DB
-	err = f.save()
+	err = f.putContent(fileContent, nil)
 	if err != nil {
 		return err
 	}
@@ -146,9 +225,7 @@ func (f *File) Register(fileHeader *multipart.FileHeader, scenarioID uint) error
 		return err
 	}
 
-	err = db.Model(&so).Association("Files").Append(f).Error
-
-	return err
+	return db.Model(&so).Association("Files").Append(f).Error
 }
 
 func (f *File) update(fileHeader *multipart.FileHeader) error {
@@ -160,24 +237,6 @@ func (f *File) update(fileHeader *multipart.FileHeader) error {
 	}
 	defer fileContent.Close()
 
-	bucket, err := configuration.GlobalConfig.String("s3.bucket")
-	if err != nil || bucket == "" {
-		// s3 object storage not used, s3.bucket param is empty
-		// save file to postgres DB
-		f.FileData, err = io.ReadAll(fileContent)
-		if err != nil {
-			return err
-		}
-		f.Key = ""
-	} else {
-		err := f.putS3(fileContent)
-		if err != nil {
-			return fmt.Errorf("failed to upload to S3 bucket: %s", err)
-		}
-
-		log.Println("Updated file in S3 object storage")
-	}
-
 	f.Type = fileHeader.Header.Get("Content-Type")
 	f.Size = uint(fileHeader.Size)
 	f.Date = time.Now().String()
@@ -185,71 +244,42 @@ func (f *File) update(fileHeader *multipart.FileHeader) error {
 
 	// Update image dimensions in case the file is an image
 	if strings.Contains(f.Type, "image") || strings.Contains(f.Type, "Image") {
-		// set the file reader back to the start of the file
-		_, err := fileContent.Seek(0, 0)
-		if err == nil {
-			imageConfig, _, err := image.DecodeConfig(fileContent)
-			if err != nil {
-				log.Println("Unable to decode image configuration: Dimensions of image file are not updated.", err)
-			}
-
-			f.ImageHeight = imageConfig.Height
-			f.ImageWidth = imageConfig.Width
-		} else {
-			log.Println("Error on setting file reader back to start of file, dimensions not updated::", err)
+		imageConfig, _, err := image.DecodeConfig(fileContent)
+		if err != nil {
+			log.Println("Unable to decode image configuration: Dimensions of image file are not updated.", err)
 		}
+
+		f.ImageHeight = imageConfig.Height
+		f.ImageWidth = imageConfig.Width
 	} else {
 		f.ImageWidth = 0
 		f.ImageHeight = 0
 	}
 
-	// Add File object with parameters to DB
-	db := database.GetDB()
-	err = db.Model(f).Updates(map[string]interface{}{
+	// set the file reader back to the start of the file
+	_, err = fileContent.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("error on setting file reader back to start of file: %v", err)
+	}
+
+	// the data of the updated file is stored under a new key, the old data is deleted unless it is shared by copies of the file
+	return f.putContent(fileContent, map[string]interface{}{
 		"Size":        f.Size,
-		"FileData":    f.FileData,
 		"Date":        f.Date,
 		"Name":        f.Name,
 		"Type":        f.Type,
 		"ImageHeight": f.ImageHeight,
 		"ImageWidth":  f.ImageWidth,
-		"Key":         f.Key,
-	}).Error
-
-	return err
+	})
 }
 
 func (f *File) Delete() error {
 
 	db := database.GetDB()
 
-	// remove association between file and scenario
-	var so database.Scenario
-	err := db.Find(&so, f.ScenarioID).Error
-	if err != nil {
-		return err
-	}
-
-	// delete file from s3 bucket
-	if f.Key != "" {
-		// TODO we do not delete the file from s3 object storage
-		// to ensure that no data is lost if multiple File objects reference the same S3 data object
-		// This behavior should be replaced by a different file handling in the future
-		//err = f.deleteS3()
-		//if err != nil {
-		//	return err
-		//}
-		//log.Println("Deleted file in S3 object storage")
-		log.Printf("Did NOT delete file with Key %v in S3 object storage!\n", f.Key)
-	}
-
-	err = db.Model(&so).Association("Files").Delete(f).Error
-	if err != nil {
-		return err
-	}
-
-	// delete file from DB
-	err = db.Delete(f).Error
+	// delete file from DB, the scenario ID is kept to restore the file from the trash;
+	// the data of the file is kept as well and deleted from its storage when the file is purged from the trash
+	err := db.Delete(f).Error
 
 	return err
 }
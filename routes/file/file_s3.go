@@ -18,20 +18,22 @@
 package file
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"io"
+	"net/http"
 	"net/url"
 	"time"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"github.com/gin-gonic/gin"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/google/uuid"
 )
 
 // Global session
@@ -88,7 +90,42 @@ func createS3Session() (*session.Session, error) {
 	return sess, nil
 }
 
-func (f *File) putS3(fileContent io.Reader) error {
+// FileUploadJob is the type of the jobs uploading files to the S3 object storage
+const FileUploadJob = "file-upload"
+
+// s3Storage keeps the data of files in an S3 object storage
+type s3Storage struct{}
+
+func (s3Storage) JobType() string {
+	return FileUploadJob
+}
+
+func (s3Storage) Put(ctx context.Context, f *File, content io.Reader) error {
+	return uploadS3(ctx, f.Key, content)
+}
+
+func (s3Storage) Get(ctx context.Context, f *File) (io.ReadCloser, error) {
+	data, err := f.getS3(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from S3 bucket: %s", err)
+	}
+	return data, nil
+}
+
+func (s3Storage) Serve(c *gin.Context, f *File) error {
+	url, err := f.getS3Url()
+	if err != nil {
+		return fmt.Errorf("failed to presign S3 request: %s", err)
+	}
+	c.Redirect(http.StatusFound, url)
+	return nil
+}
+
+func (s3Storage) Delete(ctx context.Context, f *File) error {
+	return f.deleteS3(ctx)
+}
+
+func uploadS3(ctx context.Context, key string, fileContent io.Reader) error {
 
 	// The session the S3 Uploader will use
 	sess, bucket, err := getS3Session()
@@ -99,13 +136,10 @@ func (f *File) putS3(fileContent io.Reader) error {
 	// Create an uploader with the session and default options
 	uploader := s3manager.NewUploader(sess)
 
-	f.Key = uuid.New().String()
-	f.FileData = nil
-
 	// Upload the file to S3.
-	_, err = uploader.Upload(&s3manager.UploadInput{
+	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(bucket),
-		Key:    aws.String(f.Key),
+		Key:    aws.String(key),
 		Body:   fileContent,
 	})
 	if err != nil {
@@ -150,29 +184,45 @@ func (f *File) getS3Url() (string, error) {
 	return urlStr, nil
 }
 
-//lint:ignore U1000 will be used later
-func (f *File) deleteS3() error {
+func (f *File) getS3(ctx context.Context) (io.ReadCloser, error) {
 
-	// The session the S3 Uploader will use
+	// The session the S3 client will use
 	sess, bucket, err := getS3Session()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create S3 service client
 	svc := s3.New(sess)
 
-	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(f.Key),
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	return out.Body, nil
+}
+
+func (f *File) deleteS3(ctx context.Context) error {
+
+	// The session the S3 client will use
+	sess, bucket, err := getS3Session()
 	if err != nil {
 		return err
 	}
 
-	f.Key = ""
+	// Create S3 service client
+	svc := s3.New(sess)
 
-	return nil
+	_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(f.Key),
+	})
+
+	return err
 }
 
 // updateS3Request updates the request host to the public accessible S3
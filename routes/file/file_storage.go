@@ -0,0 +1,561 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// Names of the storage drivers which are always available
+const (
+	DBStorage    = "db"
+	S3Storage    = "s3"
+	LocalStorage = "local"
+)
+
+// Storage is a driver which keeps the data of files; the data of a file is identified by the key of
+// the file, copies of a file made by earlier versions of the backend may share the key and therefore the data
+type Storage interface {
+	// Put stores the content under the key of the file, drivers may set the data of the file
+	// which is saved to the DB by the caller
+	Put(ctx context.Context, f *File, content io.Reader) error
+	// Get returns a reader of the content of the file which has to be closed by the caller
+	Get(ctx context.Context, f *File) (io.ReadCloser, error)
+	// Serve responds to a request to download the file, e.g. with its content or with a redirect
+	Serve(c *gin.Context, f *File) error
+	// Delete removes the data stored under the key of the file
+	Delete(ctx context.Context, f *File) error
+}
+
+// JobStorage is implemented by drivers which store the content of uploaded files in a job
+// since storing takes a while (e.g. uploads to an object storage); the Put of these drivers
+// must not change the file since the file is already saved to the DB
+type JobStorage interface {
+	Storage
+	// JobType returns the type of the jobs storing the content
+	JobType() string
+}
+
+var storages = map[string]Storage{}
+
+// RegisterStorage makes a storage driver available under the given name,
+// the name is saved with the files stored by the driver
+func RegisterStorage(name string, s Storage) {
+	storages[name] = s
+}
+
+func init() {
+	RegisterStorage(DBStorage, dbStorage{})
+	RegisterStorage(S3Storage, s3Storage{})
+	RegisterStorage(LocalStorage, localStorage{})
+
+	database.SetFileStorage(fileStorage{})
+}
+
+func getStorage(name string) (Storage, error) {
+	s, ok := storages[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown file storage %v", name)
+	}
+	return s, nil
+}
+
+// configuredStorage returns the name of the driver storing new files, files are stored
+// in the S3 object storage if a bucket is configured and in the DB otherwise by default
+func configuredStorage() string {
+	name, _ := configuration.GlobalConfig.String("file.storage")
+	if name != "" {
+		return name
+	}
+
+	bucket, err := configuration.GlobalConfig.String("s3.bucket")
+	if err != nil || bucket == "" {
+		return DBStorage
+	}
+	return S3Storage
+}
+
+// storage returns the driver which keeps the data of the file
+func (f *File) storage() (Storage, error) {
+	return getStorage(f.Storage)
+}
+
+// hasData returns false for files whose content is not yet stored by a job
+func (f *File) hasData() bool {
+	return f.Key != "" || f.Storage == DBStorage
+}
+
+// putContent stores the content of the file under a new key in the configured storage and saves the file to
+// the DB, new files (without ID) are created and existing files are updated with the given columns; the data
+// replaced by the content is deleted. For drivers which store the content in a job the content is copied to a
+// temporary file and the key of the file is only saved once the job stored the content.
+func (f *File) putContent(content io.Reader, columns map[string]interface{}) error {
+	stored := *f
+	stored.Storage = configuredStorage()
+	stored.Key = uuid.New().String()
+	stored.FileData = nil
+
+	s, err := stored.storage()
+	if err != nil {
+		return err
+	}
+
+	if js, ok := s.(JobStorage); ok {
+		tmp, err := spool(content)
+		if err != nil {
+			return err
+		}
+
+		created := f.ID == 0
+		if created {
+			// the file is saved without key until its content is stored
+			f.Storage = stored.Storage
+			f.Key = ""
+			f.FileData = nil
+			err = f.save()
+			stored.ID = f.ID
+		}
+		if err == nil {
+			err = f.submitPut(js, tmp, stored, columns, created)
+		}
+		if err != nil {
+			os.Remove(tmp)
+		}
+		return err
+	}
+
+	ctx := context.Background()
+	err = s.Put(ctx, &stored, content)
+	if err != nil {
+		return err
+	}
+
+	if stored.ID == 0 {
+		err = stored.save()
+	} else {
+		err = stored.saveData(ctx, columns)
+	}
+	if err != nil {
+		// the stored content is not referenced by any file
+		if delErr := s.Delete(ctx, &stored); delErr != nil {
+			log.Printf("Failed to delete the data of file %v from %v storage: %v\n", f.Name, stored.Storage, delErr)
+		}
+		return err
+	}
+
+	*f = stored
+	return nil
+}
+
+// saveData saves the columns and the location of the data of the file and deletes the data which is replaced,
+// unless it is referenced by other files
+func (f *File) saveData(ctx context.Context, columns map[string]interface{}) error {
+	updates := map[string]interface{}{
+		"Storage":  f.Storage,
+		"Key":      f.Key,
+		"FileData": f.FileData,
+	}
+	for column, value := range columns {
+		updates[column] = value
+	}
+
+	var replaced File
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// the file is locked to know which data is replaced if the file is updated concurrently
+		err := tx.Unscoped().Set("gorm:query_option", "FOR UPDATE").Find(&replaced, f.ID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&database.File{}).Where("id = ?", f.ID).Updates(updates).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// the content is saved even if the replaced data cannot be deleted
+	err = deleteData(ctx, &replaced)
+	if err != nil {
+		log.Println(err)
+	}
+	return nil
+}
+
+// spool copies the content to a temporary file whose name is returned, the file has to be removed by the caller
+func spool(content io.Reader) (string, error) {
+	tmp, err := os.CreateTemp("", "villas-upload-*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to buffer the content of the file: %v", err)
+	}
+
+	return tmp.Name(), nil
+}
+
+// submitPut stores the content in the temporary file tmp under the key of the stored file in a job of the driver
+// and saves the stored file with the columns once the content is stored; a created file is deleted if the
+// content cannot be stored. The temporary file is removed by the job.
+func (f *File) submitPut(s JobStorage, tmp string, stored File, columns map[string]interface{}, created bool) error {
+	job, err := jobs.Submit(s.JobType(), 0, f.ScenarioID, func(ctx context.Context, j *jobs.Job) error {
+		defer os.Remove(tmp)
+
+		j.SetProgress(0, "uploading file "+stored.Name)
+		err := putFile(ctx, s, &stored, tmp)
+		if err != nil {
+			if created {
+				// the file is only deleted if its data was not stored by an update in the meantime
+				db := database.GetDB()
+				delErr := db.Unscoped().Where("id = ? AND key = ?", stored.ID, "").Delete(&database.File{}).Error
+				if delErr != nil {
+					log.Printf("Failed to delete file %v without data: %v\n", stored.ID, delErr)
+				}
+			}
+			return err
+		}
+
+		err = stored.saveData(ctx, columns)
+		if err != nil {
+			if delErr := s.Delete(ctx, &stored); delErr != nil {
+				log.Printf("Failed to delete the data of file %v from %v storage: %v\n", stored.ID, stored.Storage, delErr)
+			}
+			return err
+		}
+
+		log.Printf("Saved file %v in %v storage\n", stored.Name, stored.Storage)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	f.uploadJob = &job
+	return nil
+}
+
+// putFile stores the content of the file with the given name under the key of the file
+func putFile(ctx context.Context, s Storage, f *File, name string) error {
+	content, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	return s.Put(ctx, f, content)
+}
+
+// deleteData deletes the data of the file from its storage unless the data is referenced by another file,
+// e.g. by a copy of the file or by a file in the trash; the file must no longer be saved with the data
+func deleteData(ctx context.Context, f *File) error {
+	if f.Key == "" {
+		return nil
+	}
+
+	var references int
+	err := database.GetDB().Unscoped().Model(&database.File{}).
+		Where("storage = ? AND key = ?", f.Storage, f.Key).Count(&references).Error
+	if err != nil || references > 0 {
+		return err
+	}
+
+	s, err := f.storage()
+	if err != nil {
+		return err
+	}
+
+	err = s.Delete(ctx, f)
+	if err != nil {
+		return fmt.Errorf("failed to delete the data of file %v from %v storage: %v", f.ID, f.Storage, err)
+	}
+	return nil
+}
+
+// copyData stores a copy of the data of the file under a new key, the new key is set in the file
+func (f *File) copyData(ctx context.Context) error {
+	if !f.hasData() {
+		return fmt.Errorf("the data of file %v is not stored yet", f.ID)
+	}
+
+	s, err := f.storage()
+	if err != nil {
+		return err
+	}
+
+	content, err := s.Get(ctx, f)
+	if err != nil {
+		return fmt.Errorf("failed to get the data of file %v: %v", f.ID, err)
+	}
+	defer content.Close()
+
+	copied := *f
+	copied.Key = uuid.New().String()
+	err = s.Put(ctx, &copied, content)
+	if err != nil {
+		return fmt.Errorf("failed to copy the data of file %v: %v", f.ID, err)
+	}
+
+	*f = copied
+	return nil
+}
+
+// fileStorage gives packages which cannot import the file endpoints access to the data of files
+type fileStorage struct{}
+
+func (fileStorage) CopyData(ctx context.Context, f *database.File) error {
+	copied := File{File: *f}
+	err := copied.copyData(ctx)
+	if err != nil {
+		return err
+	}
+
+	*f = copied.File
+	return nil
+}
+
+func (fileStorage) DeleteData(ctx context.Context, f *database.File) error {
+	return deleteData(ctx, &File{File: *f})
+}
+
+// dbStorage keeps the data of files in the DB
+type dbStorage struct{}
+
+func (dbStorage) Put(ctx context.Context, f *File, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	f.FileData = data
+	return nil
+}
+
+func (dbStorage) Get(ctx context.Context, f *File) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(f.FileData)), nil
+}
+
+func (dbStorage) Serve(c *gin.Context, f *File) error {
+	// Seems this headers needed for some browsers (for example without this headers Chrome will download files as txt)
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", "attachment; filename="+f.Name)
+	c.Header("Expires", "")
+	c.Header("Cache-Control", "")
+	c.Data(http.StatusOK, f.Type, f.FileData)
+	return nil
+}
+
+func (dbStorage) Delete(ctx context.Context, f *File) error {
+	// the data is deleted together with the file
+	return nil
+}
+
+// localStorage keeps the data of files in a directory of the local filesystem
+type localStorage struct{}
+
+func (localStorage) path(f *File) (string, error) {
+	root, err := configuration.GlobalConfig.String("file.storage-path")
+	if err != nil || root == "" {
+		return "", fmt.Errorf("no directory of the local file storage configured")
+	}
+	if f.Key == "" || filepath.Base(f.Key) != f.Key {
+		return "", fmt.Errorf("invalid key %q of file %v", f.Key, f.ID)
+	}
+	return filepath.Join(root, f.Key), nil
+}
+
+func (s localStorage) Put(ctx context.Context, f *File, content io.Reader) error {
+	path, err := s.path(f)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return err
+	}
+
+	// the data is written to a temporary file first so that no partial data is ever served
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file %v: %v", f.ID, err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s localStorage) Get(ctx context.Context, f *File) (io.ReadCloser, error) {
+	path, err := s.path(f)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s localStorage) Serve(c *gin.Context, f *File) error {
+	path, err := s.path(f)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	info, err := data.Stat()
+	if err != nil {
+		return err
+	}
+
+	c.DataFromReader(http.StatusOK, info.Size(), f.Type, data, map[string]string{
+		"Content-Description": "File Transfer",
+		"Content-Disposition": "attachment; filename=" + f.Name,
+	})
+	return nil
+}
+
+func (s localStorage) Delete(ctx context.Context, f *File) error {
+	path, err := s.path(f)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// MigrateStorage moves the data of all files (including the files in the trash) which are kept by
+// other drivers to the given storage driver; it returns the number of moved files and the IDs of the
+// files which are skipped since their data is not stored yet (e.g. a pending upload to S3). The data
+// is deleted from the other drivers once it is no longer referenced by any file.
+func MigrateStorage(ctx context.Context, to string) (int, []uint, error) {
+	target, err := getStorage(to)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// files are loaded one by one since their data may be large
+	var ids []uint
+	db := database.GetDB()
+	err = db.Unscoped().Model(&database.File{}).Where("storage <> ?", to).Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return 0, nil, err
+	}
+
+	moved := 0
+	var skipped []uint
+	for _, id := range ids {
+		var f File
+		err = db.Unscoped().Find(&f, id).Error
+		if err != nil {
+			return moved, skipped, err
+		}
+
+		if !f.hasData() {
+			skipped = append(skipped, f.ID)
+			continue
+		}
+
+		err = f.moveData(ctx, target, to)
+		if err != nil {
+			return moved, skipped, err
+		}
+		moved++
+	}
+
+	return moved, skipped, nil
+}
+
+// moveData copies the data of the file to the target driver, saves the new location of the data
+// and deletes the data from the previous driver
+func (f *File) moveData(ctx context.Context, target Storage, to string) error {
+	source, err := f.storage()
+	if err != nil {
+		return err
+	}
+
+	content, err := source.Get(ctx, f)
+	if err != nil {
+		return fmt.Errorf("failed to get the data of file %v: %v", f.ID, err)
+	}
+	defer content.Close()
+
+	moved := *f
+	moved.Storage = to
+	moved.Key = uuid.New().String()
+	moved.FileData = nil
+	err = target.Put(ctx, &moved, content)
+	if err != nil {
+		return fmt.Errorf("failed to store the data of file %v: %v", f.ID, err)
+	}
+
+	// only the location of the data changes, the time of the last update of the file is kept
+	err = database.GetDB().Unscoped().Model(&moved).UpdateColumns(map[string]interface{}{
+		"Storage":  moved.Storage,
+		"Key":      moved.Key,
+		"FileData": moved.FileData,
+	}).Error
+	if err != nil {
+		if delErr := target.Delete(ctx, &moved); delErr != nil {
+			log.Printf("Failed to delete the data of file %v from %v storage: %v\n", f.ID, to, delErr)
+		}
+		return err
+	}
+	log.Printf("Moved file %v (%v) from %v to %v storage\n", f.ID, f.Name, f.Storage, to)
+
+	// the data is moved even if it cannot be deleted from the previous driver
+	err = deleteData(ctx, f)
+	if err != nil {
+		log.Println(err)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ package file
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,6 +27,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
@@ -178,6 +180,116 @@ func TestAddFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
 	assert.Equalf(t, string(c1), resp.String(), "Response body: \n%v\n", resp)
+
+	// add userB as viewer of the scenario
+	var userB database.User
+	assert.NoError(t, database.GetDB().Find(&userB, "username = ?", "User_B").Error)
+	assert.NoError(t, database.AddScenarioMember(uint(scenarioID), userB.ID, database.ScenarioViewer))
+
+	// try to POST a file as viewer of the scenario
+	// should return a 422 unprocessable entity error
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+	w = uploadFile(t, tokenB, "POST", fmt.Sprintf("/api/v2/files?scenarioID=%v", scenarioID), c1)
+	assert.Equalf(t, 422, w.Code, "Response body: \n%v\n", w.Body)
+}
+
+// uploadFile sends the content as multipart form to the files endpoint
+func uploadFile(t *testing.T, token string, method string, url string, content []byte) *httptest.ResponseRecorder {
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+	fileWriter, err := bodyWriter.CreateFormFile("file", "testuploadfile.txt")
+	assert.NoError(t, err, "writing to buffer")
+	_, err = fileWriter.Write(content)
+	assert.NoError(t, err)
+	bodyWriter.Close()
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest(method, url, bodyBuf)
+	assert.NoError(t, err, "create request")
+	req.Header.Set("Content-Type", bodyWriter.FormDataContentType())
+	req.Header.Add("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLocalStorage(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// store the data of new files in a local directory
+	t.Setenv("FILE_STORAGE", LocalStorage)
+	t.Setenv("FILE_STORAGE_PATH", t.TempDir())
+
+	scenarioID := addScenario()
+
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	// test POST files
+	c1 := []byte("This is my testfile\n")
+	w := uploadFile(t, token, "POST", fmt.Sprintf("/api/v2/files?scenarioID=%v", scenarioID), c1)
+	assert.Equalf(t, 200, w.Code, "Response body: \n%v\n", w.Body)
+
+	var created struct {
+		File database.File `json:"file"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, LocalStorage, created.File.Storage)
+
+	// the data is kept in the directory, not in the database
+	stored, err := os.ReadFile(filepath.Join(os.Getenv("FILE_STORAGE_PATH"), created.File.Key))
+	assert.NoError(t, err)
+	assert.Equal(t, c1, stored)
+
+	var f database.File
+	assert.NoError(t, database.GetDB().Find(&f, created.File.ID).Error)
+	assert.Empty(t, f.FileData)
+
+	// Get the new file
+	code, resp, err := helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/files/%v", created.File.ID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	assert.Equalf(t, string(c1), resp.String(), "Response body: \n%v\n", resp)
+
+	// update the file, the replaced data is deleted from the directory
+	c2 := []byte("This is my updated testfile\n")
+	w = uploadFile(t, token, "PUT", fmt.Sprintf("/api/v2/files/%v", created.File.ID), c2)
+	assert.Equalf(t, 200, w.Code, "Response body: \n%v\n", w.Body)
+
+	var updated struct {
+		File database.File `json:"file"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.NotEqual(t, created.File.Key, updated.File.Key)
+
+	_, err = os.Stat(filepath.Join(os.Getenv("FILE_STORAGE_PATH"), created.File.Key))
+	assert.True(t, os.IsNotExist(err))
+	stored, err = os.ReadFile(filepath.Join(os.Getenv("FILE_STORAGE_PATH"), updated.File.Key))
+	assert.NoError(t, err)
+	assert.Equal(t, c2, stored)
+
+	// a file whose upload is still pending
+	pending := database.File{Name: "pending", Storage: LocalStorage, ScenarioID: uint(scenarioID)}
+	assert.NoError(t, database.GetDB().Create(&pending).Error)
+
+	// move the data to the database, the pending file is skipped
+	moved, skipped, err := MigrateStorage(context.Background(), DBStorage)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	assert.Equal(t, []uint{pending.ID}, skipped)
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/files/%v", updated.File.ID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	assert.Equalf(t, string(c2), resp.String(), "Response body: \n%v\n", resp)
+
+	// the data is no longer kept in the directory
+	_, err = os.Stat(filepath.Join(os.Getenv("FILE_STORAGE_PATH"), updated.File.Key))
+	assert.True(t, os.IsNotExist(err))
 }
 
 func TestUpdateFile(t *testing.T) {
@@ -0,0 +1,387 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+package infrastructure_component
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// States of actions sent to ICs
+const (
+	ActionScheduled    = "scheduled"
+	ActionSent         = "sent"
+	ActionAcknowledged = "acknowledged"
+	ActionRunning      = "running"
+	ActionCompleted    = "completed"
+	ActionFailed       = "failed"
+	ActionTimedOut     = "timeout"
+	ActionCancelled    = "cancelled"
+)
+
+// states of actions which are still awaiting a reply of the IC
+var pendingActionStates = []string{ActionSent, ActionAcknowledged, ActionRunning}
+
+// order in which the states of an action progress, actions never move back to an earlier state
+var actionStateRank = map[string]int{
+	ActionScheduled:    0,
+	ActionSent:         1,
+	ActionAcknowledged: 2,
+	ActionRunning:      3,
+	ActionCompleted:    4,
+	ActionFailed:       4,
+	ActionTimedOut:     4,
+	ActionCancelled:    4,
+}
+
+// states which an IC may report in a reply to an action
+var replyActionStates = []string{ActionAcknowledged, ActionRunning, ActionCompleted, ActionFailed}
+
+// actionTransition maps the states of an IC reported in status updates to the state of an action.
+// Actions with running states are only completed once the IC leaves the running state.
+type actionTransition struct {
+	acknowledged []string
+	running      []string
+	completed    []string
+}
+
+var actionTransitions = map[string]actionTransition{
+	"start":    {acknowledged: []string{"starting"}, running: []string{"running"}, completed: []string{"stopped", "idle"}},
+	"stop":     {acknowledged: []string{"stopping"}, completed: []string{"stopped", "idle"}},
+	"pause":    {acknowledged: []string{"pausing"}, completed: []string{"paused"}},
+	"resume":   {acknowledged: []string{"resuming"}, completed: []string{"running"}},
+	"reset":    {acknowledged: []string{"resetting"}, completed: []string{"idle"}},
+	"shutdown": {acknowledged: []string{"shuttingdown"}, completed: []string{"shutdown", "gone"}},
+}
+
+// next returns the state of an action after the IC reported the given state (empty if unchanged)
+func (t actionTransition) next(action database.ICAction, icState string) string {
+	switch {
+	case contains(t.acknowledged, icState):
+		return ActionAcknowledged
+	case contains(t.running, icState):
+		return ActionRunning
+	case contains(t.completed, icState) && (len(t.running) == 0 || action.State == ActionRunning):
+		return ActionCompleted
+	}
+	return ""
+}
+
+// SendAction sends an action to an IC on behalf of a user (0 for the backend) and tracks its state;
+// actions whose time lies in the future are scheduled instead of being sent
+func SendAction(userID uint, ic database.InfrastructureComponent, action Action) (database.ICAction, error) {
+	tracked, err := trackAction(userID, ic, &action)
+	if err != nil || tracked.State == ActionScheduled {
+		return tracked, err
+	}
+
+	err = sendActionAMQP(action, ic.UUID)
+	if err != nil {
+		_ = setActionState(&tracked, ActionFailed, err.Error())
+		return tracked, fmt.Errorf("unable to send %v action to IC %v: %v", action.Act, ic.UUID, err)
+	}
+
+	return tracked, nil
+}
+
+// WaitForActions blocks until all actions reached one of the given states and fails as
+// soon as one of the actions is finished in another state (e.g. failed or timed out)
+func WaitForActions(ctx context.Context, actions []database.ICAction, states []string) error {
+	for {
+		if err := expireActions(); err != nil {
+			log.Println("AMQP: Unable to expire actions:", err)
+		}
+
+		done := 0
+		for _, a := range actions {
+			var current database.ICAction
+			err := database.GetDB().Find(&current, a.ID).Error
+			if err != nil {
+				return err
+			}
+
+			if contains(states, current.State) {
+				done++
+			} else if actionStateRank[current.State] == actionStateRank[ActionCompleted] {
+				msg := fmt.Sprintf("%v action %v of IC %v is %v", current.Action, current.UUID, current.ICID, current.State)
+				if current.Message != "" {
+					msg += ": " + current.Message
+				}
+				return fmt.Errorf("%s", msg)
+			}
+		}
+		if done == len(actions) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// trackAction persists an action before it is sent to an IC; the UUID of the
+// persisted action is set in the action so that replies can be correlated.
+// Actions whose time lies in the future are scheduled instead of being sent.
+func trackAction(userID uint, ic database.InfrastructureComponent, action *Action) (database.ICAction, error) {
+	timeout, err := actionTimeout()
+	if err != nil {
+		return database.ICAction{}, err
+	}
+
+	action.ID = uuid.New().String()
+	payload, err := json.Marshal(action)
+	if err != nil {
+		return database.ICAction{}, err
+	}
+
+	now := time.Now()
+	a := database.ICAction{
+		UUID:       action.ID,
+		ICID:       ic.ID,
+		Action:     action.Act,
+		When:       action.When,
+		Parameters: postgres.Jsonb{RawMessage: action.Parameters},
+		Payload:    postgres.Jsonb{RawMessage: payload},
+		State:      ActionSent,
+		UserID:     userID,
+		SentAt:     now,
+		TimeoutAt:  now.Add(timeout),
+	}
+	if when := time.Unix(action.When, 0); when.After(now) {
+		a.State = ActionScheduled
+		a.TimeoutAt = when.Add(timeout)
+	}
+
+	err = database.GetDB().Create(&a).Error
+	return a, err
+}
+
+func actionTimeout() (time.Duration, error) {
+	timeoutStr, _ := configuration.GlobalConfig.StringOr("amqp.action-timeout", "1m")
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid backend configuration: amqp.action-timeout")
+	}
+	return timeout, nil
+}
+
+// setActionState updates the state of an action, changes to earlier states are ignored
+func setActionState(action *database.ICAction, state string, message string) error {
+	if actionStateRank[action.State] == actionStateRank[ActionCompleted] {
+		// the action is already finished
+		return nil
+	}
+	if actionStateRank[state] < actionStateRank[action.State] || (state == action.State && message == "") {
+		return nil
+	}
+
+	updates := map[string]interface{}{"State": state}
+	if message != "" {
+		updates["Message"] = message
+	}
+	if actionStateRank[state] == actionStateRank[ActionCompleted] {
+		now := time.Now()
+		updates["FinishedAt"] = &now
+	}
+
+	return database.GetDB().Model(action).Updates(updates).Error
+}
+
+// processActionReply updates the state of an action according to the reply of an IC
+func processActionReply(reply ICActionReply, ICUUID string) error {
+	if !contains(replyActionStates, reply.State) {
+		return fmt.Errorf("AMQP: Invalid state %v in reply to action %v", reply.State, reply.ID)
+	}
+
+	var action database.ICAction
+	err := database.GetDB().Find(&action, "UUID = ?", reply.ID).Error
+	if err != nil {
+		return fmt.Errorf("AMQP: Reply to unknown action %v: %v", reply.ID, err)
+	}
+
+	if ICUUID != "" {
+		var ic InfrastructureComponent
+		err = ic.ByID(action.ICID)
+		if err == nil && ic.UUID != ICUUID && ic.UUID != "" {
+			return fmt.Errorf("AMQP: IC %v replied to action %v which was sent to IC %v", ICUUID, reply.ID, ic.UUID)
+		}
+	}
+
+	return setActionState(&action, reply.State, reply.Message)
+}
+
+// trackActionsByState updates the pending actions of an IC according to the state reported in a status update
+func trackActionsByState(icID uint, icState string) error {
+	var actions []database.ICAction
+	err := database.GetDB().Where("ic_id = ? AND state IN (?)", icID, pendingActionStates).Order("ID asc").Find(&actions).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range actions {
+		state := ""
+		message := ""
+		if icState == "error" {
+			state = ActionFailed
+			message = "IC reported error state"
+		} else if t, ok := actionTransitions[actions[i].Action]; ok {
+			state = t.next(actions[i], icState)
+		}
+
+		if state == "" {
+			continue
+		}
+		err = setActionState(&actions[i], state, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expireActions marks all actions as timed out which were not acknowledged in time
+func expireActions() error {
+	now := time.Now()
+	return database.GetDB().Model(&database.ICAction{}).
+		Where("state IN (?) AND timeout_at < ?", []string{ActionSent, ActionAcknowledged}, now).
+		Updates(map[string]interface{}{"State": ActionTimedOut, "FinishedAt": &now}).Error
+}
+
+// getActions returns the actions sent to an IC, the most recent action first;
+// only actions in the given state are returned if state is not empty
+func (s *InfrastructureComponent) getActions(state string) ([]database.ICAction, error) {
+	if err := expireActions(); err != nil {
+		log.Println("AMQP: Unable to expire actions:", err)
+	}
+
+	query := database.GetDB().Where("ic_id = ?", s.ID)
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	var actions []database.ICAction
+	err := query.Order("ID desc").Find(&actions).Error
+	return actions, err
+}
+
+// ScheduleActions checks every d for scheduled actions which are due and sends them to their ICs
+// and for sent actions which were not acknowledged in time and marks them as timed out.
+// Since scheduled actions are persisted, actions which became due while the backend was down are sent late.
+func ScheduleActions(d time.Duration) {
+
+	go func() {
+
+		for range time.Tick(d) {
+			err := expireActions()
+			if err != nil {
+				log.Println("AMQP: Unable to expire actions:", err)
+			}
+
+			err = dispatchScheduledActions(time.Now())
+			if err != nil {
+				log.Println("AMQP: Unable to dispatch scheduled actions:", err)
+			}
+		}
+	}()
+}
+
+func dispatchScheduledActions(now time.Time) error {
+	timeout, err := actionTimeout()
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	var due []database.ICAction
+	err = db.Where(`state = ? AND "when" <= ?`, ActionScheduled, now.Unix()).Order(`"when" asc, id asc`).Find(&due).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range due {
+		// claim the action so that it is not sent twice (e.g. if it was cancelled in the meantime)
+		claim := db.Model(&database.ICAction{}).Where("id = ? AND state = ?", due[i].ID, ActionScheduled).
+			Updates(map[string]interface{}{"State": ActionSent, "SentAt": now, "TimeoutAt": now.Add(timeout)})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		due[i].State = ActionSent
+
+		err = sendScheduledAction(due[i])
+		if err != nil {
+			log.Printf("AMQP: Unable to send scheduled action %v: %v", due[i].UUID, err)
+			_ = setActionState(&due[i], ActionFailed, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func sendScheduledAction(a database.ICAction) error {
+	var ic InfrastructureComponent
+	err := ic.ByID(a.ICID)
+	if err != nil {
+		return fmt.Errorf("IC %v of action not found: %v", a.ICID, err)
+	}
+
+	var action Action
+	err = json.Unmarshal(a.Payload.RawMessage, &action)
+	if err != nil {
+		return err
+	}
+
+	// the IC may have been reserved by someone else since the action was scheduled
+	err = CheckReservation(a.UserID, ic.InfrastructureComponent, action)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("AMQP: Sending scheduled %v action %v to IC %v", action.Act, action.ID, ic.UUID)
+	return sendActionAMQP(action, ic.UUID)
+}
+
+// cancelAction cancels a scheduled action, actions which have already been sent cannot be cancelled
+func cancelAction(action *database.ICAction) (bool, error) {
+	now := time.Now()
+	cancel := database.GetDB().Model(action).Where("state = ?", ActionScheduled).
+		Updates(map[string]interface{}{"State": ActionCancelled, "FinishedAt": &now})
+	return cancel.RowsAffected > 0, cancel.Error
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -29,6 +29,7 @@ import (
 )
 
 type Action struct {
+	ID         string          `json:"id,omitempty"`
 	Act        string          `json:"action"`
 	When       int64           `json:"when"`
 	Parameters json.RawMessage `json:"parameters,omitempty"`
@@ -60,12 +61,23 @@ type ICSchema struct {
 	CreateParametersSchema json.RawMessage `json:"create"`
 }
 
+// ICActionReply is sent by an IC to report the progress of an action
+type ICActionReply struct {
+	// ID of the action sent by the backend
+	ID string `json:"id"`
+	// State of the action (acknowledged, running, completed or failed)
+	State string `json:"state"`
+	// Optional message, e.g. the reason of a failure
+	Message string `json:"message"`
+}
+
 type ICUpdate struct {
-	Status     ICStatus     `json:"status"`
-	Properties ICProperties `json:"properties"`
-	Schema     ICSchema     `json:"schema"`
-	When       float64      `json:"when"`
-	Action     string       `json:"action"`
+	Status     ICStatus       `json:"status"`
+	Properties ICProperties   `json:"properties"`
+	Schema     ICSchema       `json:"schema"`
+	When       float64        `json:"when"`
+	Action     string         `json:"action"`
+	Reply      *ICActionReply `json:"reply,omitempty"`
 }
 
 func ProcessMessage(message amqp.Delivery) {
@@ -76,6 +88,14 @@ func ProcessMessage(message amqp.Delivery) {
 		log.Printf("AMQP: Could not unmarshal message to JSON: %v err: %v", string(message.Body), err)
 	}
 
+	if payload.Reply != nil {
+		// the message replies to an action sent by the backend
+		err = processActionReply(*payload.Reply, payload.Properties.UUID)
+		if err != nil {
+			log.Println(err.Error())
+		}
+	}
+
 	if payload.Action != "" {
 		// if a message contains an action, it is not intended for the backend
 		//log.Println("AMQP: Ignoring action message ", payload)
@@ -98,6 +118,13 @@ func ProcessMessage(message amqp.Delivery) {
 		// database error
 		err = fmt.Errorf("AMQP: Database error for IC %v DB error message: %v", ICUUID, err)
 	} else {
+		// track the pending actions of the IC before the update since the IC may be deleted
+		if payload.Status.State != "" {
+			err = trackActionsByState(sToBeUpdated.ID, payload.Status.State)
+			if err != nil {
+				log.Printf("AMQP: Unable to track actions of IC %v: %v", ICUUID, err)
+			}
+		}
 		// update record based on payload
 		err = sToBeUpdated.updateExternalIC(payload, message.Body)
 	}
@@ -158,6 +185,7 @@ func createExternalIC(payload ICUpdate, ICUUID string, body []byte) error {
 	if err != nil {
 		return fmt.Errorf("AMQP: Saving new IC to DB failed: %v", err)
 	}
+	newIC.recordStateOrLog("")
 
 	log.Println("AMQP: Created IC with UUID ", newIC.UUID)
 
@@ -219,10 +247,12 @@ func (s *InfrastructureComponent) updateExternalIC(payload ICUpdate, body []byte
 	updatedIC := updatedICReq.updatedIC(*s)
 
 	// Finally update the IC in the DB
+	previousState := s.State
 	err = s.update(updatedIC)
 	if err != nil {
 		return fmt.Errorf("AMQP: Unable to update IC %v in DB: %v", s.Name, err)
 	}
+	s.recordStateOrLog(previousState)
 
 	log.Println("AMQP: Updated IC with UUID ", s.UUID)
 	return err
@@ -18,173 +18,269 @@
 package infrastructure_component
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/metrics"
 	"github.com/go-resty/resty/v2"
 	"github.com/jinzhu/gorm/dialects/postgres"
 )
 
-func QueryICAPIs(d time.Duration) {
+// client is shared by all pollers, timeouts are set per request
+var client = resty.New()
 
-	go func() {
+// defaultPollWorkers is the number of concurrent queries if no valid number is configured
+const defaultPollWorkers = 8
 
-		for range time.Tick(d) {
-			//log.Println("Querying IC APIs at time:", x)
-			var err error
+// pollSchedule is the time of the next query of an IC
+type pollSchedule struct {
+	next     time.Time
+	failures int
+	inFlight bool
+	// labels of the metrics of the IC
+	uuid string
+	name string
+}
 
-			db := database.GetDB()
-			var ics []database.InfrastructureComponent
-			err = db.Order("ID asc").Find(&ics).Error
-			if err != nil {
-				log.Println("Error getting ICs from DB:", err.Error())
-				continue
-			}
+var (
+	schedules = map[uint]*pollSchedule{}
+	// time at which all ICs were loaded from the database the last time
+	schedulesLoaded time.Time
+	schedulesMux    sync.Mutex
+	// limits the number of concurrent queries
+	pollSlots = make(chan struct{}, defaultPollWorkers)
+	// queries which have not finished yet
+	polls sync.WaitGroup
+)
+
+// QueryICAPIs queries the APIs of ICs which are not managed via AMQP for status updates with
+// up to workers concurrent queries until ctx is cancelled; d is the interval between two queries
+// of ICs without a configured interval. The returned channel is closed once all queries finished.
+func QueryICAPIs(ctx context.Context, d time.Duration, workers int) <-chan struct{} {
+	if workers < 1 {
+		workers = defaultPollWorkers
+	}
+	pollSlots = make(chan struct{}, workers)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
 
-			// iterate over ICs in DB
-			for _, ic := range ics {
-				err := queryIC(&ic)
+		ticker := time.NewTicker(pollTick(d))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				polls.Wait()
+				return
+			case now := <-ticker.C:
+				err := pollICs(ctx, now, d)
 				if err != nil {
-					fmt.Println(err)
+					log.Println("Error querying IC APIs:", err.Error())
 				}
 			}
 		}
 	}()
+
+	return done
 }
 
-func queryIC(ic *database.InfrastructureComponent) error {
-	if ic.ManagedExternally || ic.APIURL == "" || (!strings.HasPrefix(ic.APIURL, "http://") && !strings.HasPrefix(ic.APIURL, "https://")) {
-		return nil
+// pollTick returns the resolution in which the APIs of ICs are queried
+func pollTick(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d
 	}
+	return time.Second
+}
 
-	if ic.Category == "gateway" {
-		if ic.Type == "villas-node" {
-			err := queryVillasNodeGateway(ic)
-			if err != nil {
-				return err
-			}
-		} else if ic.Type == "villas-relay" {
-			err := queryVillasRelayGateway(ic)
-			if err != nil {
-				return err
-			}
+// pollICs starts the queries of the APIs of all ICs which are due at the time now
+// and not queried already; it does not wait for the queries to finish. Only the ICs which are
+// due are loaded from the database, all ICs are loaded once per defaultInterval to pick up
+// ICs which were added or changed.
+func pollICs(ctx context.Context, now time.Time, defaultInterval time.Duration) error {
+	schedulesMux.Lock()
+	loadAll := now.Sub(schedulesLoaded) >= defaultInterval
+	due := map[uint]bool{}
+	var dueIDs []uint
+	for id, schedule := range schedules {
+		if !schedule.inFlight && !now.Before(schedule.next) {
+			due[id] = true
+			dueIDs = append(dueIDs, id)
 		}
 	}
+	schedulesMux.Unlock()
 
-	return nil
-}
-
-func queryVillasNodeGateway(ic *database.InfrastructureComponent) error {
-	client := resty.New()
+	if !loadAll && len(dueIDs) == 0 {
+		return nil
+	}
 
-	log.Println("External API: checking for villas-node gateway", ic.Name)
-	statusResponse, err := client.R().SetHeader("Accept", "application/json").Get(ic.APIURL + "/status")
-	if err != nil {
-		return fmt.Errorf("failed to query the status of %s: %w", ic.Name, err)
+	query := database.GetDB().Order("ID asc")
+	if !loadAll {
+		query = query.Where("id IN (?)", dueIDs)
 	}
-	var status map[string]interface{}
-	err = json.Unmarshal(statusResponse.Body(), &status)
+	var ics []database.InfrastructureComponent
+	err := query.Find(&ics).Error
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal status of %s: %w", ic.Name, err)
+		return err
 	}
 
-	parts := strings.Split(ic.WebsocketURL, "/")
-	if len(parts) > 0 && parts[len(parts)-1] != "" {
+	schedulesMux.Lock()
+	defer schedulesMux.Unlock()
+
+	if loadAll {
+		schedulesLoaded = now
+	}
 
-		configResponse, _ := client.R().SetHeader("Accept", "application/json").Get(ic.APIURL + "/node/" + parts[len(parts)-1])
-		statsResponse, _ := client.R().SetHeader("Accept", "application/json").Get(ic.APIURL + "/node/" + parts[len(parts)-1] + "/stats")
+	polled := map[uint]bool{}
+	for i := range ics {
+		ic := &ics[i]
+		poller, settings, err := pollSettings(ic, defaultInterval)
+		if err != nil {
+			log.Printf("Error querying API of IC %v (%v): %v", ic.Name, ic.UUID, err)
+			continue
+		}
+		if poller == nil {
+			continue
+		}
 
-		var config map[string]interface{}
-		err = json.Unmarshal(configResponse.Body(), &config)
-		if err == nil {
-			status["config"] = config
+		polled[ic.ID] = true
+		schedule, ok := schedules[ic.ID]
+		if !ok {
+			schedule = &pollSchedule{next: now}
+			schedules[ic.ID] = schedule
 		}
-		var stats map[string]interface{}
-		err = json.Unmarshal(statsResponse.Body(), &stats)
-		if err == nil {
-			status["statistics"] = stats
+		if schedule.inFlight || now.Before(schedule.next) {
+			continue
 		}
+		if schedule.uuid != ic.UUID || schedule.name != ic.Name {
+			schedule.deleteMetrics()
+			schedule.uuid, schedule.name = ic.UUID, ic.Name
+		}
+
+		schedule.inFlight = true
+		polls.Add(1)
+		go poll(ctx, now, ic, poller, settings, schedule)
 	}
 
-	var updatedIC UpdateICRequest
-	statusRaw, _ := json.Marshal(status)
-	updatedIC.InfrastructureComponent.StatusUpdateRaw = postgres.Jsonb{RawMessage: statusRaw}
-	updatedIC.InfrastructureComponent.State = fmt.Sprintf("%v", status["state"])
-	updatedIC.InfrastructureComponent.UUID = fmt.Sprintf("%v", status["uuid"])
-	timeNow, err := strconv.ParseFloat(fmt.Sprintf("%v", status["time_now"]), 64)
-	if err != nil {
-		return fmt.Errorf("failed to parse time_now to float: %w", err)
+	// forget ICs which are no longer queried
+	for id, schedule := range schedules {
+		if (loadAll || due[id]) && !polled[id] && !schedule.inFlight {
+			schedule.deleteMetrics()
+			delete(schedules, id)
+		}
 	}
-	timeStarted, err := strconv.ParseFloat(fmt.Sprintf("%v", status["time_started"]), 64)
-	if err != nil {
-		return fmt.Errorf("failed to parse time_started to float: %w", err)
+
+	return nil
+}
+
+// poll queries the API of an IC once a slot is free and schedules its next query relative to now
+func poll(ctx context.Context, now time.Time, ic *database.InfrastructureComponent, poller Poller, settings PollSettings, schedule *pollSchedule) {
+	defer polls.Done()
+
+	select {
+	case pollSlots <- struct{}{}:
+		defer func() { <-pollSlots }()
+	case <-ctx.Done():
+		schedulesMux.Lock()
+		schedule.inFlight = false
+		schedulesMux.Unlock()
+		return
 	}
-	uptime := timeNow - timeStarted
-	updatedIC.InfrastructureComponent.Uptime = uptime
 
-	// validate the update
-	err = updatedIC.validate()
+	started := time.Now()
+	err := queryIC(ctx, ic, poller, settings)
+	metrics.ICPollDuration.WithLabelValues(ic.UUID, ic.Name).Observe(time.Since(started).Seconds())
+
+	schedulesMux.Lock()
+	defer schedulesMux.Unlock()
+
 	if err != nil {
-		return fmt.Errorf("failed to validate updated villas-node gateway: %s (%s): %w", ic.Name, ic.UUID, err)
+		metrics.ICPollFailures.WithLabelValues(ic.UUID, ic.Name).Inc()
+		if schedule.failures == 0 {
+			log.Printf("IC %v (%v) is unreachable: %v", ic.Name, ic.UUID, err)
+		}
+	} else if schedule.failures > 0 {
+		log.Printf("IC %v (%v) is reachable again after %d failed queries", ic.Name, ic.UUID, schedule.failures)
 	}
 
-	// create the update and update IC in DB
-	var x InfrastructureComponent
-	err = x.ByID(ic.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get villas-node gateway by ID %s (%s): %w", ic.Name, ic.UUID, err)
+	schedule.inFlight = false
+	schedule.update(now, settings, err)
+}
+
+// deleteMetrics removes the metrics of an IC which is no longer queried
+func (s *pollSchedule) deleteMetrics() {
+	if s.uuid == "" {
+		return
 	}
-	u := updatedIC.updatedIC(x)
-	err = x.update(u)
-	if err != nil {
-		return fmt.Errorf("failed to update villas-node gateway %s (%s): %w", ic.Name, ic.UUID, err)
+	metrics.ICPollDuration.DeleteLabelValues(s.uuid, s.name)
+	metrics.ICPollFailures.DeleteLabelValues(s.uuid, s.name)
+}
+
+// update schedules the next query of an IC after a query finished with err,
+// the interval is doubled for every consecutive failure up to the maximum backoff
+func (s *pollSchedule) update(now time.Time, settings PollSettings, err error) {
+	if err == nil {
+		s.failures = 0
+		s.next = now.Add(settings.interval)
+		return
 	}
 
-	return nil
+	s.failures++
+	backoff := settings.interval
+	for i := 0; i < s.failures && backoff < settings.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > settings.maxBackoff {
+		backoff = settings.maxBackoff
+	}
+	s.next = now.Add(backoff)
 }
 
-func queryVillasRelayGateway(ic *database.InfrastructureComponent) error {
-	client := resty.New()
+// queryIC queries the API of the IC with its poller and updates the IC with the status
+func queryIC(ctx context.Context, ic *database.InfrastructureComponent, poller Poller, settings PollSettings) error {
+	ctx, cancel := context.WithTimeout(ctx, settings.timeout)
+	defer cancel()
 
-	log.Println("External API: checking for villas-relay manager", ic.Name)
-	statusResponse, err := client.R().SetHeader("Accept", "application/json").Get(ic.APIURL)
+	status, err := poller.Poll(ctx, ic, settings)
 	if err != nil {
-		return fmt.Errorf("failed querying API of %s (%s): %w", ic.Name, ic.UUID, err)
+		return err
 	}
 
-	var status map[string]interface{}
-	err = json.Unmarshal(statusResponse.Body(), &status)
+	var updatedIC UpdateICRequest
+	statusRaw, err := json.Marshal(status.Raw)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal status villas-relay manager %s (%s): %w", ic.Name, ic.UUID, err)
+		return fmt.Errorf("failed to marshal status of %s (%s): %w", ic.Name, ic.UUID, err)
 	}
-
-	var updatedIC UpdateICRequest
-	statusRaw, _ := json.Marshal(status)
 	updatedIC.InfrastructureComponent.StatusUpdateRaw = postgres.Jsonb{RawMessage: statusRaw}
-	updatedIC.InfrastructureComponent.UUID = fmt.Sprintf("%v", status["uuid"])
+	updatedIC.InfrastructureComponent.State = status.State
+	updatedIC.InfrastructureComponent.UUID = status.UUID
+	updatedIC.InfrastructureComponent.Uptime = status.Uptime
 
 	// validate the update
 	err = updatedIC.validate()
 	if err != nil {
-		return fmt.Errorf("failed to validate updated villas-relay manager %s (%s): %w", ic.Name, ic.UUID, err)
+		return fmt.Errorf("failed to validate status update of %s (%s): %w", ic.Name, ic.UUID, err)
 	}
 
 	// create the update and update IC in DB
 	var x InfrastructureComponent
 	err = x.ByID(ic.ID)
 	if err != nil {
-		return fmt.Errorf("failed to get villas-relay manager by ID %s (%s): %w", ic.Name, ic.UUID, err)
+		return fmt.Errorf("failed to get IC by ID %s (%s): %w", ic.Name, ic.UUID, err)
 	}
 	u := updatedIC.updatedIC(x)
+	previousState := x.State
 	err = x.update(u)
 	if err != nil {
-		return fmt.Errorf("failed to update villas-relay manager %s (%s): %w", ic.Name, ic.UUID, err)
+		return fmt.Errorf("failed to update IC %s (%s): %w", ic.Name, ic.UUID, err)
 	}
+	x.recordStateOrLog(previousState)
 
 	return nil
 }
@@ -18,11 +18,11 @@
 package infrastructure_component
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
-	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
 	"github.com/gin-gonic/gin"
@@ -30,12 +30,20 @@ import (
 
 func RegisterICEndpoints(r *gin.RouterGroup) {
 	r.GET("", getICs)
+	r.GET("/stream", streamICs)
 	r.POST("", addIC)
 	r.PUT("/:ICID", updateIC)
 	r.GET("/:ICID", getIC)
 	r.DELETE("/:ICID", deleteIC)
 	r.GET("/:ICID/configs", getConfigsOfIC)
 	r.POST("/:ICID/action", sendActionToIC)
+	r.GET("/:ICID/actions", getActionsOfIC)
+	r.DELETE("/:ICID/actions/:actionID", cancelActionOfIC)
+	r.GET("/:ICID/reservations", getReservationsOfIC)
+	r.GET("/:ICID/reservations.ics", getReservationCalendarOfIC)
+	r.POST("/:ICID/reservations", addReservationToIC)
+	r.DELETE("/:ICID/reservations/:reservationID", deleteReservationOfIC)
+	r.GET("/:ICID/history", getHistoryOfIC)
 }
 
 var session *helper.AMQPsession
@@ -125,6 +133,7 @@ func addIC(c *gin.Context) {
 		}
 	}
 
+	database.Audit(c, database.Create, database.ModelInfrastructureComponent, newIC.ID, 0, nil, newIC.InfrastructureComponent)
 	c.JSON(http.StatusOK, gin.H{"ic": newIC.InfrastructureComponent})
 }
 
@@ -177,6 +186,7 @@ func updateIC(c *gin.Context) {
 	// Finally update the IC in the DB
 	err = oldIC.update(updatedIC)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelInfrastructureComponent, oldIC_r.ID, 0, oldIC_r, updatedIC.InfrastructureComponent)
 		c.JSON(http.StatusOK, gin.H{"ic": updatedIC.InfrastructureComponent})
 	}
 
@@ -231,15 +241,14 @@ func deleteIC(c *gin.Context) {
 	// Check if IC is managed externally
 	if s.ManagedExternally {
 
-		staleICTime, _ := configuration.GlobalConfig.String("staleictime")
-		staleDuration, err := time.ParseDuration(staleICTime)
+		staleDuration, err := staleICDuration()
 		if err != nil {
-			helper.InternalServerError(c, "deleting externally managed IC not possible, no or erroneous stale IC time parameter provided in API config")
+			helper.InternalServerError(c, "deleting externally managed IC not possible, "+err.Error())
 			return
 		}
 
 		// check if external IC is stale
-		if time.Since(s.UpdatedAt).Seconds() < staleDuration.Seconds() {
+		if !s.isStale(time.Now(), staleDuration) {
 			// IC is NOT stale, refuse deletion
 			helper.BadRequestError(c, "delete for externally managed non-stale IC not possible with this endpoint - use /ic/{ICID}/action endpoint instead to request deletion of the component")
 			return
@@ -249,6 +258,7 @@ func deleteIC(c *gin.Context) {
 	// Delete the IC
 	err := s.delete()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelInfrastructureComponent, s_r.ID, 0, s_r, nil)
 		c.JSON(http.StatusOK, gin.H{"ic": s.InfrastructureComponent})
 	}
 }
@@ -286,14 +296,16 @@ func getConfigsOfIC(c *gin.Context) {
 
 // sendActionToIC godoc
 // @Summary Send an action to IC (only available if backend server is started with -amqp parameter)
+// @Description Actions whose time (when) lies in the future are scheduled and sent by the backend at that time.
 // @ID sendActionToIC
 // @Tags infrastructure-components
 // @Produce json
 // @Param inputAction query string true "Action for IC"
-// @Success 200 {object} api.ResponseError "Action sent successfully"
+// @Success 200 {object} api.ResponseSentActions "Actions sent successfully, their state can be tracked via /ic/{ICID}/actions"
 // @Failure 400 {object} api.ResponseError "Bad request"
 // @Failure 404 {object} api.ResponseError "Not found"
-// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 409 {object} api.ResponseError "Conflict, a start or reset action while the IC is reserved by someone else"
+// @Failure 422 {object} api.ResponseSchemaError "Unprocessable entity, e.g. parameters which do not match the schema of the IC"
 // @Failure 500 {object} api.ResponseError "Internal server error"
 // @Param ICID path int true "InfrastructureComponent ID"
 // @Router /ic/{ICID}/action [post]
@@ -312,20 +324,386 @@ func sendActionToIC(c *gin.Context) {
 		return
 	}
 
-	for _, action := range actions {
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	var userID uint
+	if id, exists := c.Get(database.UserIDCtx); exists {
+		userID = id.(uint)
+	}
+
+	// validate all actions before sending any of them
+	for i, action := range actions {
 		if (action.Act == "delete" || action.Act == "create") && s.Category != "manager" {
 			helper.BadRequestError(c, "cannot send a delete or create action to an IC of category "+s.Category)
+			return
+		}
+		if errs := action.ValidateParameters(s); len(errs) > 0 {
+			helper.SchemaValidationError(c, fmt.Sprintf("Parameters of %v action %d do not match the schema of the IC", action.Act, i), errs)
+			return
 		}
-		err = sendActionAMQP(action, s.UUID)
+		err := CheckReservation(userID, s, action)
+		if _, ok := err.(*ReservationConflict); ok {
+			helper.ConflictError(c, fmt.Sprintf("Cannot send %v action: %v", action.Act, err))
+			return
+		} else if helper.DBError(c, err) {
+			return
+		}
+	}
+
+	var sent []database.ICAction
+	for _, action := range actions {
+		tracked, err := SendAction(userID, s, action)
 		if err != nil {
 			helper.InternalServerError(c, "Unable to send actions to IC: "+err.Error())
 			return
 		}
+		action.ID = tracked.UUID
+		database.AuditICAction(c, s.ID, action)
+		sent = append(sent, tracked)
 	}
 	log.Println("AMQP: Sending actions:", actions)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "OK.",
+		"actions": sent,
 	})
 }
+
+// getActionsOfIC godoc
+// @Summary Get all actions sent to the infrastructure component and their state
+// @ID getActionsOfIC
+// @Tags infrastructure-components
+// @Produce json
+// @Success 200 {object} api.ResponseICActions "Actions sent to the IC, the most recent action first"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param ICID path int true "Infrastructure Component ID"
+// @Param state query string false "Only return actions in this state (e.g. scheduled)"
+// @Router /ic/{ICID}/actions [get]
+// @Security Bearer
+func getActionsOfIC(c *gin.Context) {
+
+	ok, s_r := database.CheckICPermissions(c, database.ModelInfrastructureComponentAction, database.Read, true)
+	if !ok {
+		return
+	}
+
+	var s InfrastructureComponent
+	s.InfrastructureComponent = s_r
+
+	actions, err := s.getActions(c.Query("state"))
+	if !helper.DBError(c, err) {
+		c.JSON(http.StatusOK, gin.H{"actions": actions})
+	}
+}
+
+// cancelActionOfIC godoc
+// @Summary Cancel a scheduled action of the infrastructure component
+// @ID cancelActionOfIC
+// @Tags infrastructure-components
+// @Produce json
+// @Success 200 {object} api.ResponseICAction "Action that was cancelled"
+// @Failure 400 {object} api.ResponseError "Bad request, e.g. the action has already been sent"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity, e.g. the action was scheduled by another user"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param ICID path int true "Infrastructure Component ID"
+// @Param actionID path int true "Action ID"
+// @Router /ic/{ICID}/actions/{actionID} [delete]
+// @Security Bearer
+func cancelActionOfIC(c *gin.Context) {
+
+	ok, s := database.CheckICPermissions(c, database.ModelInfrastructureComponentAction, database.Update, true)
+	if !ok {
+		return
+	}
+
+	actionID, err := helper.GetIDOfElement(c, "actionID", "path", -1)
+	if err != nil {
+		return
+	}
+
+	var action database.ICAction
+	err = database.GetDB().Where("ic_id = ?", s.ID).Find(&action, actionID).Error
+	if helper.DBError(c, err) {
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+	role, _ := c.Get(database.UserRoleCtx)
+	if action.UserID != userID.(uint) && role != "Admin" {
+		helper.UnprocessableEntityError(c, "Access denied (only the user who scheduled an action and admins may cancel it)")
+		return
+	}
+
+	state := action.State
+	cancelled, err := cancelAction(&action)
+	if helper.DBError(c, err) {
+		return
+	}
+	if !cancelled {
+		helper.BadRequestError(c, fmt.Sprintf("Only scheduled actions can be cancelled, the action is %v", state))
+		return
+	}
+
+	database.AuditICAction(c, s.ID, map[string]interface{}{"cancel": action.UUID})
+	c.JSON(http.StatusOK, gin.H{"action": action})
+}
+
+// getReservationsOfIC godoc
+// @Summary Get the reservations of the infrastructure component
+// @ID getReservationsOfIC
+// @Tags infrastructure-components
+// @Produce json
+// @Success 200 {object} api.ResponseReservations "Reservations of the IC ordered by their start"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param ICID path int true "Infrastructure Component ID"
+// @Param from query string false "Only return reservations which end after this time (RFC 3339)"
+// @Param to query string false "Only return reservations which start before this time (RFC 3339)"
+// @Router /ic/{ICID}/reservations [get]
+// @Security Bearer
+func getReservationsOfIC(c *gin.Context) {
+
+	ok, s_r := database.CheckICPermissions(c, database.ModelInfrastructureComponent, database.Read, true)
+	if !ok {
+		return
+	}
+
+	var s InfrastructureComponent
+	s.InfrastructureComponent = s_r
+
+	from, to, ok := timeWindow(c)
+	if !ok {
+		return
+	}
+
+	reservations, err := s.getReservations(from, to)
+	if !helper.DBError(c, err) {
+		c.JSON(http.StatusOK, gin.H{"reservations": reservations})
+	}
+}
+
+// getReservationCalendarOfIC godoc
+// @Summary Get the reservations of the infrastructure component as iCalendar feed
+// @Description Calendar clients which cannot send an Authorization header may pass a read-only API token in the token query parameter.
+// @ID getReservationCalendarOfIC
+// @Tags infrastructure-components
+// @Produce text/calendar
+// @Success 200 {string} string "iCalendar file with an event per reservation"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param ICID path int true "Infrastructure Component ID"
+// @Param from query string false "Only include reservations which end after this time (RFC 3339)"
+// @Param to query string false "Only include reservations which start before this time (RFC 3339)"
+// @Router /ic/{ICID}/reservations.ics [get]
+// @Security Bearer
+func getReservationCalendarOfIC(c *gin.Context) {
+
+	ok, s_r := database.CheckICPermissions(c, database.ModelInfrastructureComponent, database.Read, true)
+	if !ok {
+		return
+	}
+
+	var s InfrastructureComponent
+	s.InfrastructureComponent = s_r
+
+	from, to, ok := timeWindow(c)
+	if !ok {
+		return
+	}
+
+	reservations, err := s.getReservations(from, to)
+	if !helper.DBError(c, err) {
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"ic-%d-reservations.ics\"", s.ID))
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(s.reservationCalendar(reservations)))
+	}
+}
+
+// addReservationToIC godoc
+// @Summary Reserve the infrastructure component for a time window
+// @Description While the IC is reserved, only the user who reserved it and the members of the scenario of the reservation may send start and reset actions to it.
+// @ID addReservationToIC
+// @Tags infrastructure-components
+// @Accept json
+// @Produce json
+// @Success 200 {object} api.ResponseReservation "Reservation that was added"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 409 {object} api.ResponseError "Conflict, the time window overlaps another reservation"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param ICID path int true "Infrastructure Component ID"
+// @Param inputReservation body infrastructure_component.addReservationRequest true "Reservation to be added"
+// @Router /ic/{ICID}/reservations [post]
+// @Security Bearer
+func addReservationToIC(c *gin.Context) {
+
+	ok, s_r := database.CheckICPermissions(c, database.ModelInfrastructureComponentAction, database.Update, true)
+	if !ok {
+		return
+	}
+
+	var s InfrastructureComponent
+	s.InfrastructureComponent = s_r
+
+	var req addReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.BadRequestError(c, "Error binding form data to JSON: "+err.Error())
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		helper.BadRequestError(c, err.Error())
+		return
+	}
+
+	// the user has to be member of the scenario whose members shall hold the reservation
+	if req.Reservation.ScenarioID != 0 {
+		ok, _ := database.CheckScenarioPermissions(c, database.Read, "body", int(req.Reservation.ScenarioID))
+		if !ok {
+			return
+		}
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+
+	reservation := req.createReservation(userID.(uint))
+	err := s.addReservation(&reservation)
+	if conflict, ok := err.(*ReservationConflict); ok {
+		helper.ConflictError(c, conflict.Error())
+		return
+	}
+	if !helper.DBError(c, err) {
+		database.AuditICAction(c, s.ID, gin.H{"reserve": reservation})
+		c.JSON(http.StatusOK, gin.H{"reservation": reservation})
+	}
+}
+
+// deleteReservationOfIC godoc
+// @Summary Delete a reservation of the infrastructure component
+// @Description Only the user who reserved the IC and admins may delete a reservation.
+// @ID deleteReservationOfIC
+// @Tags infrastructure-components
+// @Produce json
+// @Success 200 {object} api.ResponseReservation "Reservation that was deleted"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param ICID path int true "Infrastructure Component ID"
+// @Param reservationID path int true "Reservation ID"
+// @Router /ic/{ICID}/reservations/{reservationID} [delete]
+// @Security Bearer
+func deleteReservationOfIC(c *gin.Context) {
+
+	ok, s := database.CheckICPermissions(c, database.ModelInfrastructureComponentAction, database.Update, true)
+	if !ok {
+		return
+	}
+
+	reservationID, err := helper.GetIDOfElement(c, "reservationID", "path", -1)
+	if err != nil {
+		return
+	}
+
+	db := database.GetDB()
+	var reservation database.Reservation
+	err = db.Where("ic_id = ?", s.ID).Find(&reservation, reservationID).Error
+	if helper.DBError(c, err) {
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+	role, _ := c.Get(database.UserRoleCtx)
+	if reservation.UserID != userID.(uint) && role != "Admin" {
+		helper.UnprocessableEntityError(c, "Access denied (only the holder of a reservation and admins may delete it)")
+		return
+	}
+
+	err = db.Delete(&reservation).Error
+	if !helper.DBError(c, err) {
+		database.AuditICAction(c, s.ID, gin.H{"unreserve": reservation})
+		c.JSON(http.StatusOK, gin.H{"reservation": reservation})
+	}
+}
+
+// getHistoryOfIC godoc
+// @Summary Get the state history and availability of the infrastructure component
+// @ID getHistoryOfIC
+// @Tags infrastructure-components
+// @Produce json
+// @Success 200 {object} api.ResponseICHistory "State samples of the IC ordered by their time and availability of the IC"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param ICID path int true "Infrastructure Component ID"
+// @Param from query string false "Start of the time window (RFC 3339), defaults to 24 hours before its end"
+// @Param to query string false "End of the time window (RFC 3339), defaults to now"
+// @Router /ic/{ICID}/history [get]
+// @Security Bearer
+func getHistoryOfIC(c *gin.Context) {
+
+	ok, s_r := database.CheckICPermissions(c, database.ModelInfrastructureComponent, database.Read, true)
+	if !ok {
+		return
+	}
+
+	var s InfrastructureComponent
+	s.InfrastructureComponent = s_r
+
+	from, to, ok := timeWindow(c)
+	if !ok {
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	if !from.Before(to) {
+		helper.BadRequestError(c, "The from query parameter must be before the to query parameter")
+		return
+	}
+
+	history, err := s.getHistory(from, to)
+	if helper.DBError(c, err) {
+		return
+	}
+
+	availability, err := s.getAvailability(from, to, history)
+	if !helper.DBError(c, err) {
+		c.JSON(http.StatusOK, gin.H{"history": history, "availability": availability})
+	}
+}
+
+// timeWindow parses the optional from and to query parameters of requests for reservations or history
+func timeWindow(c *gin.Context) (time.Time, time.Time, bool) {
+	var times [2]time.Time
+	for i, param := range []string{"from", "to"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			helper.BadRequestError(c, fmt.Sprintf("Invalid %v query parameter, expected RFC 3339 time: %v", param, err))
+			return times[0], times[1], false
+		}
+		times[i] = t
+	}
+
+	return times[0], times[1], true
+}
@@ -17,7 +17,10 @@
 
 package infrastructure_component
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type DeletionPostponed struct {
 	References int
@@ -26,3 +29,13 @@ type DeletionPostponed struct {
 func (e *DeletionPostponed) Error() string {
 	return fmt.Sprintf("deletion of IC postponed, %d config(s) associated to it", e.References)
 }
+
+type ReservationConflict struct {
+	ReservationID uint
+	Start         time.Time
+	End           time.Time
+}
+
+func (e *ReservationConflict) Error() string {
+	return fmt.Sprintf("IC is reserved from %v until %v (reservation %d)", e.Start.Format(time.RFC3339), e.End.Format(time.RFC3339), e.ReservationID)
+}
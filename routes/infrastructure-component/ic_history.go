@@ -0,0 +1,156 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+package infrastructure_component
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// states in which an IC is not considered available
+var unavailableStates = []string{"error", "gone", "unknown", "shuttingdown", "shutdown", StateStale}
+
+// Availability summarizes the state history of an IC within a time window
+type Availability struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Percentage of the time window in which the IC was available
+	Available float64 `json:"available"`
+	// Percentage of the time window spent in each state; the time before the first
+	// known sample is accounted to the unknown state
+	States map[string]float64 `json:"states"`
+}
+
+// recordState adds the current state and uptime of the IC to its state history;
+// previousState is the state of the IC before the status update
+func (s *InfrastructureComponent) recordState(previousState string) error {
+	sample := database.ICStateSample{
+		ICID:       s.ID,
+		State:      s.State,
+		Uptime:     s.Uptime,
+		Transition: s.State != previousState,
+	}
+	if sample.Transition {
+		sample.StatusUpdateRaw = s.StatusUpdateRaw
+	} else {
+		sample.StatusUpdateRaw = postgres.Jsonb{RawMessage: []byte("{}")}
+	}
+
+	return database.GetDB().Create(&sample).Error
+}
+
+// recordStateOrLog records the state of the IC and logs errors instead of returning them,
+// the history must not prevent status updates from being applied
+func (s *InfrastructureComponent) recordStateOrLog(previousState string) {
+	err := s.recordState(previousState)
+	if err != nil {
+		log.Printf("Error recording state of IC %v: %v", s.UUID, err)
+	}
+}
+
+// PruneHistory deletes the state samples which are older than the IC history retention time every d
+func PruneHistory(d time.Duration) {
+
+	go func() {
+
+		for range time.Tick(d) {
+			err := pruneHistory(time.Now())
+			if err != nil {
+				log.Println("Error pruning the state history of ICs:", err.Error())
+			}
+		}
+	}()
+}
+
+func pruneHistory(now time.Time) error {
+	retention, err := historyRetention()
+	if err != nil || retention <= 0 {
+		return err
+	}
+
+	return database.GetDB().Unscoped().Where("created_at < ?", now.Add(-retention)).
+		Delete(database.ICStateSample{}).Error
+}
+
+func historyRetention() (time.Duration, error) {
+	retention, _ := configuration.GlobalConfig.String("ichistoryretention")
+	if retention == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(retention)
+	if err != nil {
+		return 0, fmt.Errorf("erroneous IC history retention parameter provided in API config")
+	}
+	return d, nil
+}
+
+// getHistory returns the state samples of the IC between from and to ordered by their time
+func (s *InfrastructureComponent) getHistory(from time.Time, to time.Time) ([]database.ICStateSample, error) {
+	var samples []database.ICStateSample
+	err := database.GetDB().Where("ic_id = ? AND created_at >= ? AND created_at <= ?", s.ID, from, to).
+		Order("created_at asc").Find(&samples).Error
+	return samples, err
+}
+
+// getAvailability computes the share of the time window spent in each state from the samples
+// within the window and the last sample before it
+func (s *InfrastructureComponent) getAvailability(from time.Time, to time.Time, samples []database.ICStateSample) (Availability, error) {
+	availability := Availability{From: from, To: to, States: map[string]float64{}}
+
+	state := "unknown"
+	var before database.ICStateSample
+	err := database.GetDB().Where("ic_id = ? AND created_at < ?", s.ID, from).
+		Order("created_at desc").First(&before).Error
+	if err == nil {
+		state = before.State
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return availability, err
+	}
+
+	window := to.Sub(from)
+	if window <= 0 {
+		return availability, nil
+	}
+
+	durations := map[string]time.Duration{}
+	last := from
+	for _, sample := range samples {
+		durations[state] += sample.CreatedAt.Sub(last)
+		state = sample.State
+		last = sample.CreatedAt
+	}
+	durations[state] += to.Sub(last)
+
+	for state, d := range durations {
+		if d <= 0 {
+			continue
+		}
+		percentage := 100 * float64(d) / float64(window)
+		availability.States[state] = percentage
+		if !contains(unavailableStates, state) {
+			availability.Available += percentage
+		}
+	}
+
+	return availability, nil
+}
@@ -28,6 +28,9 @@ type InfrastructureComponent struct {
 func (s *InfrastructureComponent) save() error {
 	db := database.GetDB()
 	err := db.Create(s).Error
+	if err == nil {
+		stream.publish(EventCreate, s.InfrastructureComponent)
+	}
 	return err
 }
 
@@ -45,6 +48,8 @@ func (s *InfrastructureComponent) byUUID(uuid string) error {
 
 func (s *InfrastructureComponent) update(updatedIC InfrastructureComponent) error {
 
+	old := s.InfrastructureComponent
+
 	db := database.GetDB()
 	err := db.Model(s).Updates(updatedIC).Error
 	if err != nil {
@@ -53,8 +58,26 @@ func (s *InfrastructureComponent) update(updatedIC InfrastructureComponent) erro
 
 	// extra update for bool ManagedExternally since it is ignored if false
 	err = db.Model(s).Updates(map[string]interface{}{"ManagedExternally": updatedIC.ManagedExternally}).Error
+	if err != nil {
+		return err
+	}
 
-	return err
+	stream.publishIfChanged(old, s.InfrastructureComponent)
+	return nil
+}
+
+func (s *InfrastructureComponent) updateState(state string) error {
+
+	old := s.InfrastructureComponent
+
+	db := database.GetDB()
+	err := db.Model(s).Update("State", state).Error
+	if err != nil {
+		return err
+	}
+
+	stream.publishIfChanged(old, s.InfrastructureComponent)
+	return nil
 }
 
 func (s *InfrastructureComponent) delete() error {
@@ -68,6 +91,9 @@ func (s *InfrastructureComponent) delete() error {
 
 	// delete InfrastructureComponent from DB (does NOT remain as dangling)
 	err := db.Delete(s).Error
+	if err == nil {
+		stream.publish(EventDelete, s.InfrastructureComponent)
+	}
 	return err
 }
 
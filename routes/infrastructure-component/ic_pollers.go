@@ -0,0 +1,378 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package infrastructure_component
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+)
+
+// PolledStatus is the status of an IC obtained by querying its API;
+// empty fields leave the corresponding properties of the IC unchanged
+type PolledStatus struct {
+	State  string
+	UUID   string
+	Uptime float64
+	// Raw status which is saved as the raw status update of the IC
+	Raw interface{}
+}
+
+// Poller queries the API of an IC for its status
+type Poller interface {
+	Poll(ctx context.Context, ic *database.InfrastructureComponent, settings PollSettings) (PolledStatus, error)
+}
+
+// PollerFunc adapts a function to the Poller interface
+type PollerFunc func(ctx context.Context, ic *database.InfrastructureComponent, settings PollSettings) (PolledStatus, error)
+
+// Poll calls f
+func (f PollerFunc) Poll(ctx context.Context, ic *database.InfrastructureComponent, settings PollSettings) (PolledStatus, error) {
+	return f(ctx, ic, settings)
+}
+
+// PollSettings configure how the API of an IC is queried, they are stored as JSON in the
+// poll settings of the IC; durations use the format of time.ParseDuration
+type PollSettings struct {
+	// Name of the poller, defaults to the poller registered for the category and type of the IC
+	Poller string `json:"poller,omitempty"`
+	// Interval between two queries, defaults to the API update interval
+	Interval string `json:"interval,omitempty"`
+	// Timeout of a query
+	Timeout string `json:"timeout,omitempty"`
+	// Maximum time between two queries after failed queries
+	MaxBackoff string `json:"maxBackoff,omitempty"`
+	// Path of the status endpoint relative to the API URL of the IC
+	Path string `json:"path,omitempty"`
+	// Dot separated paths of the state, uptime and UUID in JSON status responses,
+	// the uptime field of the Prometheus poller is the name of a metric
+	StateField  string `json:"stateField,omitempty"`
+	UptimeField string `json:"uptimeField,omitempty"`
+	UUIDField   string `json:"uuidField,omitempty"`
+
+	interval   time.Duration
+	timeout    time.Duration
+	maxBackoff time.Duration
+}
+
+const (
+	defaultPollTimeout    = 5 * time.Second
+	defaultPollMaxBackoff = 5 * time.Minute
+)
+
+var pollers = map[string]Poller{}
+
+// RegisterPoller registers a poller by name; pollers named "<category>/<type>"
+// are used for all ICs of this category and type without an explicit poller
+func RegisterPoller(name string, p Poller) {
+	pollers[name] = p
+}
+
+func init() {
+	RegisterPoller("gateway/villas-node", PollerFunc(pollVillasNodeGateway))
+	RegisterPoller("gateway/villas-relay", PollerFunc(pollVillasRelayGateway))
+	RegisterPoller("manager/villas-controller", PollerFunc(pollVillasController))
+	RegisterPoller("prometheus", PollerFunc(pollPrometheus))
+	RegisterPoller("json", PollerFunc(pollJSON))
+}
+
+// parsePollSettings parses the poll settings of an IC, durations which are not set are zero
+func parsePollSettings(raw []byte) (PollSettings, error) {
+	var settings PollSettings
+	if len(raw) == 0 || string(raw) == "null" {
+		return settings, nil
+	}
+
+	err := json.Unmarshal(raw, &settings)
+	if err != nil {
+		return settings, fmt.Errorf("invalid poll settings: %w", err)
+	}
+
+	if settings.Poller != "" {
+		if _, ok := pollers[settings.Poller]; !ok {
+			return settings, fmt.Errorf("invalid poll settings: unknown poller %v", settings.Poller)
+		}
+	}
+
+	for _, d := range []struct {
+		value  string
+		name   string
+		target *time.Duration
+	}{
+		{settings.Interval, "interval", &settings.interval},
+		{settings.Timeout, "timeout", &settings.timeout},
+		{settings.MaxBackoff, "maxBackoff", &settings.maxBackoff},
+	} {
+		if d.value == "" {
+			continue
+		}
+		*d.target, err = time.ParseDuration(d.value)
+		if err != nil || *d.target <= 0 {
+			return settings, fmt.Errorf("invalid poll settings: %v has to be a positive duration", d.name)
+		}
+	}
+
+	return settings, nil
+}
+
+// pollSettings returns the poll settings of the IC and its poller with defaults applied;
+// the poller is nil if the API of the IC is not queried
+func pollSettings(ic *database.InfrastructureComponent, defaultInterval time.Duration) (Poller, PollSettings, error) {
+	if ic.ManagedExternally || ic.APIURL == "" || (!strings.HasPrefix(ic.APIURL, "http://") && !strings.HasPrefix(ic.APIURL, "https://")) {
+		return nil, PollSettings{}, nil
+	}
+
+	settings, err := parsePollSettings(ic.PollSettings.RawMessage)
+	if err != nil {
+		return nil, settings, err
+	}
+
+	name := settings.Poller
+	if name == "" {
+		name = ic.Category + "/" + ic.Type
+	}
+	poller, ok := pollers[name]
+	if !ok {
+		return nil, settings, nil
+	}
+
+	if settings.interval == 0 {
+		settings.interval = defaultInterval
+	}
+	if settings.timeout == 0 {
+		settings.timeout = defaultPollTimeout
+	}
+	if settings.maxBackoff == 0 {
+		settings.maxBackoff = defaultPollMaxBackoff
+	}
+
+	return poller, settings, nil
+}
+
+// getStatus returns the body of the response to a GET request for the url
+func getStatus(ctx context.Context, url string) ([]byte, error) {
+	resp, err := client.R().SetContext(ctx).SetHeader("Accept", "application/json").Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("GET %v returned status %v", url, resp.Status())
+	}
+	return resp.Body(), nil
+}
+
+func pollVillasNodeGateway(ctx context.Context, ic *database.InfrastructureComponent, settings PollSettings) (PolledStatus, error) {
+	var polled PolledStatus
+
+	body, err := getStatus(ctx, ic.APIURL+"/status")
+	if err != nil {
+		return polled, fmt.Errorf("failed to query the status of %s: %w", ic.Name, err)
+	}
+	var status map[string]interface{}
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		return polled, fmt.Errorf("failed to unmarshal status of %s: %w", ic.Name, err)
+	}
+
+	parts := strings.Split(ic.WebsocketURL, "/")
+	if len(parts) > 0 && parts[len(parts)-1] != "" {
+		node := ic.APIURL + "/node/" + parts[len(parts)-1]
+
+		var config map[string]interface{}
+		configBody, err := getStatus(ctx, node)
+		if err == nil && json.Unmarshal(configBody, &config) == nil {
+			status["config"] = config
+		}
+		var stats map[string]interface{}
+		statsBody, err := getStatus(ctx, node+"/stats")
+		if err == nil && json.Unmarshal(statsBody, &stats) == nil {
+			status["statistics"] = stats
+		}
+	}
+
+	timeNow, err := strconv.ParseFloat(fmt.Sprintf("%v", status["time_now"]), 64)
+	if err != nil {
+		return polled, fmt.Errorf("failed to parse time_now to float: %w", err)
+	}
+	timeStarted, err := strconv.ParseFloat(fmt.Sprintf("%v", status["time_started"]), 64)
+	if err != nil {
+		return polled, fmt.Errorf("failed to parse time_started to float: %w", err)
+	}
+
+	polled.State, _ = status["state"].(string)
+	polled.UUID, _ = status["uuid"].(string)
+	polled.Uptime = timeNow - timeStarted
+	polled.Raw = status
+	return polled, nil
+}
+
+func pollVillasRelayGateway(ctx context.Context, ic *database.InfrastructureComponent, settings PollSettings) (PolledStatus, error) {
+	var polled PolledStatus
+
+	body, err := getStatus(ctx, ic.APIURL)
+	if err != nil {
+		return polled, fmt.Errorf("failed querying API of %s (%s): %w", ic.Name, ic.UUID, err)
+	}
+	var status map[string]interface{}
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		return polled, fmt.Errorf("failed to unmarshal status villas-relay manager %s (%s): %w", ic.Name, ic.UUID, err)
+	}
+
+	polled.UUID, _ = status["uuid"].(string)
+	polled.Raw = status
+	return polled, nil
+}
+
+// pollVillasController queries the HTTP API of VILLAScontroller, which responds with
+// the same status as sent via AMQP
+func pollVillasController(ctx context.Context, ic *database.InfrastructureComponent, settings PollSettings) (PolledStatus, error) {
+	var polled PolledStatus
+
+	path := settings.Path
+	if path == "" {
+		path = "/status"
+	}
+	body, err := getStatus(ctx, ic.APIURL+path)
+	if err != nil {
+		return polled, fmt.Errorf("failed querying API of villas-controller %s (%s): %w", ic.Name, ic.UUID, err)
+	}
+
+	var update ICUpdate
+	err = json.Unmarshal(body, &update)
+	if err != nil {
+		return polled, fmt.Errorf("failed to unmarshal status of villas-controller %s (%s): %w", ic.Name, ic.UUID, err)
+	}
+
+	polled.State = update.Status.State
+	polled.UUID = update.Properties.UUID
+	polled.Uptime = update.Status.Uptime
+	polled.Raw = json.RawMessage(body)
+	return polled, nil
+}
+
+// pollPrometheus scrapes a Prometheus metrics endpoint; the IC is running if the endpoint can be
+// scraped and its uptime is taken from the configured metric or the start time of its process
+func pollPrometheus(ctx context.Context, ic *database.InfrastructureComponent, settings PollSettings) (PolledStatus, error) {
+	var polled PolledStatus
+
+	path := settings.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	body, err := getStatus(ctx, ic.APIURL+path)
+	if err != nil {
+		return polled, fmt.Errorf("failed to scrape metrics of %s (%s): %w", ic.Name, ic.UUID, err)
+	}
+
+	metrics := parseMetrics(body)
+	if settings.UptimeField != "" {
+		polled.Uptime = metrics[settings.UptimeField]
+	} else if started, ok := metrics["process_start_time_seconds"]; ok {
+		polled.Uptime = float64(time.Now().Unix()) - started
+	}
+
+	polled.State = "running"
+	polled.Raw = metrics
+	return polled, nil
+}
+
+// parseMetrics returns the values of the samples in a Prometheus text exposition,
+// labelled samples are keyed by their name including the labels
+func parseMetrics(body []byte) map[string]float64 {
+	metrics := map[string]float64{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the name may contain labels with spaces, the value follows the name
+		end := strings.LastIndex(line, "}")
+		if end < 0 {
+			end = strings.Index(line, " ")
+			if end < 0 {
+				continue
+			}
+		} else {
+			end++
+		}
+
+		fields := strings.Fields(line[end:])
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		metrics[line[:end]] = value
+	}
+
+	return metrics
+}
+
+// pollJSON queries a generic JSON status endpoint and takes the state, uptime and UUID
+// of the IC from the configured fields of the response
+func pollJSON(ctx context.Context, ic *database.InfrastructureComponent, settings PollSettings) (PolledStatus, error) {
+	var polled PolledStatus
+
+	body, err := getStatus(ctx, ic.APIURL+settings.Path)
+	if err != nil {
+		return polled, fmt.Errorf("failed querying API of %s (%s): %w", ic.Name, ic.UUID, err)
+	}
+	var status interface{}
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		return polled, fmt.Errorf("failed to unmarshal status of %s (%s): %w", ic.Name, ic.UUID, err)
+	}
+
+	field := func(path string, fallback string) interface{} {
+		if path == "" {
+			path = fallback
+		}
+		value := status
+		for _, key := range strings.Split(path, ".") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = object[key]
+		}
+		return value
+	}
+
+	if state, ok := field(settings.StateField, "state").(string); ok {
+		polled.State = state
+	}
+	if uptime, ok := field(settings.UptimeField, "uptime").(float64); ok {
+		polled.Uptime = uptime
+	}
+	polled.UUID, _ = field(settings.UUIDField, "uuid").(string)
+	polled.Raw = status
+	return polled, nil
+}
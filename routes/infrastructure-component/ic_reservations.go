@@ -0,0 +1,174 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+package infrastructure_component
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"github.com/jinzhu/gorm"
+)
+
+// actions which may only be sent by the holders of a reservation while the IC is reserved
+var reservedActions = []string{"start", "reset"}
+
+// format of date-times in iCalendar files (UTC)
+const icalTimeFormat = "20060102T150405Z"
+
+// addReservation books the IC for the time window of r, the IC is locked
+// while checking for conflicts so that concurrent bookings cannot overlap
+func (s *InfrastructureComponent) addReservation(r *database.Reservation) error {
+	r.ICID = s.ID
+
+	tx := database.GetDB().Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var locked database.InfrastructureComponent
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Find(&locked, s.ID).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var conflict database.Reservation
+	err = tx.Where("ic_id = ? AND start < ? AND \"end\" > ?", s.ID, r.End, r.Start).Order("start asc").First(&conflict).Error
+	if err == nil {
+		tx.Rollback()
+		return &ReservationConflict{ReservationID: conflict.ID, Start: conflict.Start, End: conflict.End}
+	} else if !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Create(r).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// getReservations returns the reservations of the IC which overlap the time window
+// between from and to ordered by their start; zero times leave the window open
+func (s *InfrastructureComponent) getReservations(from time.Time, to time.Time) ([]database.Reservation, error) {
+	query := database.GetDB().Where("ic_id = ?", s.ID)
+	if !from.IsZero() {
+		query = query.Where("\"end\" > ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("start < ?", to)
+	}
+
+	var reservations []database.Reservation
+	err := query.Order("start asc").Find(&reservations).Error
+	return reservations, err
+}
+
+// CheckReservation returns a ReservationConflict if the action is a start or reset action
+// and the IC is reserved by someone else than the user at the time of the action;
+// scheduled actions are checked again when they are sent
+func CheckReservation(userID uint, ic database.InfrastructureComponent, action Action) error {
+	if !contains(reservedActions, action.Act) {
+		return nil
+	}
+
+	at := time.Now()
+	if when := time.Unix(action.When, 0); when.After(at) {
+		at = when
+	}
+
+	var r database.Reservation
+	err := database.GetDB().Where("ic_id = ? AND start <= ? AND \"end\" > ?", ic.ID, at, at).First(&r).Error
+	if gorm.IsRecordNotFoundError(err) {
+		// the IC is not reserved
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if r.UserID == userID {
+		return nil
+	}
+	if r.ScenarioID != 0 {
+		if _, err := database.GetScenarioMembership(r.ScenarioID, userID); err == nil {
+			return nil
+		}
+	}
+
+	return &ReservationConflict{ReservationID: r.ID, Start: r.Start, End: r.End}
+}
+
+// reservationCalendar renders the reservations of the IC as iCalendar file (RFC 5545)
+func (s *InfrastructureComponent) reservationCalendar(reservations []database.Reservation) string {
+	db := database.GetDB()
+
+	var b strings.Builder
+	writeICalLine(&b, "BEGIN:VCALENDAR")
+	writeICalLine(&b, "VERSION:2.0")
+	writeICalLine(&b, "PRODID:-//VILLASweb//Reservations//EN")
+	writeICalLine(&b, "CALSCALE:GREGORIAN")
+	writeICalLine(&b, "X-WR-CALNAME:"+escapeICalText("Reservations of "+s.Name))
+
+	for _, r := range reservations {
+		holder := fmt.Sprintf("user %d", r.UserID)
+		var u database.User
+		if db.Find(&u, r.UserID).Error == nil {
+			holder = u.Username
+		}
+
+		writeICalLine(&b, "BEGIN:VEVENT")
+		writeICalLine(&b, fmt.Sprintf("UID:reservation-%d-%s", r.ID, s.UUID))
+		writeICalLine(&b, "DTSTAMP:"+r.CreatedAt.UTC().Format(icalTimeFormat))
+		writeICalLine(&b, "LAST-MODIFIED:"+r.UpdatedAt.UTC().Format(icalTimeFormat))
+		writeICalLine(&b, "DTSTART:"+r.Start.UTC().Format(icalTimeFormat))
+		writeICalLine(&b, "DTEND:"+r.End.UTC().Format(icalTimeFormat))
+		writeICalLine(&b, "SUMMARY:"+escapeICalText(s.Name+" reserved by "+holder))
+		if r.Description != "" {
+			writeICalLine(&b, "DESCRIPTION:"+escapeICalText(r.Description))
+		}
+		writeICalLine(&b, "END:VEVENT")
+	}
+
+	writeICalLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// writeICalLine writes a content line terminated by CRLF, lines longer than 75 octets are folded
+func writeICalLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		// do not split multi-byte UTF-8 characters
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// the space which starts folded lines counts towards their length
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+func escapeICalText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
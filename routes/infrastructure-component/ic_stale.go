@@ -0,0 +1,128 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+package infrastructure_component
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+)
+
+// StateStale is the state of ICs which did not send a status update for longer than the stale IC time
+const StateStale = "stale"
+
+// DetectStaleICs checks every d for ICs whose last status update is older than the stale IC time,
+// marks them as stale and deletes stale externally managed ICs if configured
+func DetectStaleICs(d time.Duration) {
+
+	go func() {
+
+		for range time.Tick(d) {
+			err := markStaleICs(time.Now())
+			if err != nil {
+				log.Println("Error detecting stale ICs:", err.Error())
+			}
+		}
+	}()
+}
+
+func staleICDuration() (time.Duration, error) {
+	staleICTime, _ := configuration.GlobalConfig.String("staleictime")
+	staleDuration, err := time.ParseDuration(staleICTime)
+	if err != nil {
+		return 0, fmt.Errorf("no or erroneous stale IC time parameter provided in API config")
+	}
+	return staleDuration, nil
+}
+
+func markStaleICs(now time.Time) error {
+	staleDuration, err := staleICDuration()
+	if err != nil {
+		return err
+	}
+	deleteStale, _ := configuration.GlobalConfig.Bool("staleicdelete")
+
+	db := database.GetDB()
+	var ics []InfrastructureComponent
+	err = db.Order("ID asc").Where("state <> ?", "gone").Find(&ics).Error
+	if err != nil {
+		return err
+	}
+
+	for _, ic := range ics {
+		if !ic.receivesStatusUpdates() {
+			continue
+		}
+
+		if ic.State != StateStale {
+			if !ic.isStale(now, staleDuration) {
+				continue
+			}
+
+			log.Printf("IC %v (%v) is stale, last status update at %v", ic.Name, ic.UUID, ic.lastStateUpdate())
+			previousState := ic.State
+			err = ic.updateState(StateStale)
+			if err != nil {
+				log.Printf("Error marking IC %v as stale: %v", ic.UUID, err)
+				continue
+			}
+			ic.recordStateOrLog(previousState)
+		}
+
+		if deleteStale && ic.ManagedExternally {
+			err = ic.delete()
+			if _, ok := err.(*DeletionPostponed); ok {
+				// the IC is kept as long as component configurations use it
+				continue
+			} else if err != nil {
+				log.Printf("Error deleting stale IC %v: %v", ic.UUID, err)
+				continue
+			}
+			log.Printf("Deleted stale IC %v (%v)", ic.Name, ic.UUID)
+		}
+	}
+
+	return nil
+}
+
+// receivesStatusUpdates returns true for ICs which are managed via AMQP or whose API is queried for
+// status updates; other ICs never update their state and can therefore not become stale
+func (s *InfrastructureComponent) receivesStatusUpdates() bool {
+	if s.ManagedExternally {
+		return true
+	}
+
+	poller, _, err := pollSettings(&s.InfrastructureComponent, 0)
+	return err == nil && poller != nil
+}
+
+// lastStateUpdate returns the time of the last status update of the IC
+func (s *InfrastructureComponent) lastStateUpdate() time.Time {
+	t, err := time.Parse(time.RFC1123Z, s.StateUpdateAt)
+	if err != nil {
+		return s.CreatedAt
+	}
+	return t
+}
+
+// isStale returns true if the last status update of the IC is older than staleDuration
+func (s *InfrastructureComponent) isStale(now time.Time, staleDuration time.Duration) bool {
+	return s.State == StateStale || now.Sub(s.lastStateUpdate()) > staleDuration
+}
@@ -0,0 +1,176 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package infrastructure_component
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"github.com/gin-gonic/gin"
+)
+
+// Events pushed to the clients of the IC stream
+const (
+	EventCreate = "create"
+	EventUpdate = "update"
+	EventDelete = "delete"
+)
+
+// number of events buffered per client before events are dropped for that client
+const streamBufferSize = 64
+
+// interval of keep-alive events sent to idle clients
+var streamKeepAlive = 30 * time.Second
+
+type icEvent struct {
+	name string
+	ic   database.InfrastructureComponent
+}
+
+// icStream distributes IC events to all connected clients
+type icStream struct {
+	mutex   sync.Mutex
+	clients map[chan icEvent]struct{}
+	// closed to end the streams of all clients
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var stream = newICStream()
+
+func newICStream() *icStream {
+	return &icStream{
+		clients: make(map[chan icEvent]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// CloseStreams ends the streams of all connected clients when the server shuts down,
+// since the server does not wait for connections which are never idle
+func CloseStreams() {
+	stream.closeOnce.Do(func() {
+		close(stream.done)
+	})
+}
+
+func (s *icStream) subscribe() chan icEvent {
+	ch := make(chan icEvent, streamBufferSize)
+
+	s.mutex.Lock()
+	s.clients[ch] = struct{}{}
+	s.mutex.Unlock()
+
+	return ch
+}
+
+func (s *icStream) unsubscribe(ch chan icEvent) {
+	s.mutex.Lock()
+	delete(s.clients, ch)
+	s.mutex.Unlock()
+}
+
+// publish sends an event to all clients without blocking;
+// the event is dropped for clients which do not keep up
+func (s *icStream) publish(name string, ic database.InfrastructureComponent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for ch := range s.clients {
+		select {
+		case ch <- icEvent{name: name, ic: ic}:
+		default:
+			log.Printf("IC stream: dropping %s event of IC %v for slow client", name, ic.UUID)
+		}
+	}
+}
+
+// publishIfChanged publishes an update event if the state or the raw status of the IC changed
+func (s *icStream) publishIfChanged(old database.InfrastructureComponent, ic database.InfrastructureComponent) {
+	if old.State != ic.State || !bytes.Equal(old.StatusUpdateRaw.RawMessage, ic.StatusUpdateRaw.RawMessage) {
+		s.publish(EventUpdate, ic)
+	}
+}
+
+// streamICs godoc
+// @Summary Stream state changes of infrastructure components as server-sent events
+// @Description Events are named create, update and delete and contain the IC in their data.
+// @Description A ping event is sent if the stream was idle for some time.
+// @ID streamICs
+// @Tags infrastructure-components
+// @Produce text/event-stream
+// @Success 200 {object} api.ResponseIC "Stream of IC events"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Param ic query []int false "Only stream events of these ICs" collectionFormat(multi)
+// @Router /ic/stream [get]
+// @Security Bearer
+func streamICs(c *gin.Context) {
+
+	// READ access to ICs is independent of the IC, so only the role of the user has to be checked
+	ok, _ := database.CheckICPermissions(c, database.ModelInfrastructureComponent, database.Read, false)
+	if !ok {
+		return
+	}
+
+	filter := make(map[uint]bool)
+	for _, id := range c.QueryArray("ic") {
+		icID, err := strconv.Atoi(id)
+		if err != nil || icID < 0 {
+			helper.BadRequestError(c, "Bad IC ID: "+id)
+			return
+		}
+		filter[uint(icID)] = true
+	}
+
+	events := stream.subscribe()
+	defer stream.unsubscribe(events)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	// send the headers right away so that clients know that the stream is established
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-stream.done:
+			return false
+		case ev := <-events:
+			if len(filter) > 0 && !filter[ev.ic.ID] {
+				return true
+			}
+			c.SSEvent(ev.name, gin.H{"ic": ev.ic})
+		case <-keepAlive.C:
+			c.SSEvent("ping", gin.H{"time": time.Now().Unix()})
+		}
+		return true
+	})
+}
@@ -18,16 +18,24 @@
 package infrastructure_component
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
 	component_configuration "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/component-configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/metrics"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario"
 	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/gin-gonic/gin"
@@ -55,6 +63,7 @@ type ICRequest struct {
 	CreateParameterSchema postgres.Jsonb `json:"createparameterschema,omitempty"`
 	ManagedExternally     *bool          `json:"managedexternally"`
 	Manager               string         `json:"manager,omitempty"`
+	PollSettings          postgres.Jsonb `json:"pollsettings,omitempty"`
 }
 
 type ScenarioRequest struct {
@@ -596,6 +605,809 @@ func TestSendActionToIC(t *testing.T) {
 		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", action1)
 	assert.NoError(t, err)
 	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	// add an IC with a JSON schema for its start parameters
+	schemaIC := newIC2
+	schemaIC.StartParameterSchema = postgres.Jsonb{RawMessage: json.RawMessage(
+		`{"type": "object", "required": ["timestep"], "properties": {"timestep": {"type": "number"}}}`)}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": schemaIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	schemaICID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// try to send a start action with parameters violating the schema
+	// should result in unprocessable entity
+	action1.Parameters = json.RawMessage(`{"timestep": "fast"}`)
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", schemaICID), "POST", []Action{action1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// send a start action with valid parameters
+	action1.Parameters = json.RawMessage(`{"timestep": 0.001}`)
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", schemaICID), "POST", []Action{action1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// try to send a create action to an IC which is no manager
+	// should result in bad request
+	createAction := Action{Act: "create", When: time.Now().Unix()}
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", schemaICID), "POST", []Action{createAction})
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+}
+
+func TestSendCreateActionToManager(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// add a manager with a JSON schema for the ICs it creates
+	manager := newIC1
+	manager.UUID = "4854af30-325f-44a5-ad59-b67b2597deed"
+	manager.Category = "manager"
+	manager.Type = "generic"
+	manager.CreateParameterSchema = postgres.Jsonb{RawMessage: json.RawMessage(`{
+		"type": "object",
+		"required": ["name", "category", "type"],
+		"properties": {
+			"name": {"type": "string"},
+			"category": {"enum": ["simulator", "gateway"]},
+			"type": {"type": "string"}
+		}
+	}`)}
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": manager})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	managerID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// try to send a create action with parameters violating the schema
+	// should result in unprocessable entity with an error per field
+	createAction := Action{
+		Act:        "create",
+		When:       time.Now().Unix(),
+		Parameters: json.RawMessage(`{"name": "New IC", "category": "database"}`),
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", managerID), "POST", []Action{createAction})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	var schemaErrors struct {
+		Errors []helper.SchemaError `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &schemaErrors))
+	var fields []string
+	for _, e := range schemaErrors.Errors {
+		fields = append(fields, e.Field)
+	}
+	assert.ElementsMatch(t, []string{"category", "type"}, fields)
+
+	// send a create action with valid parameters
+	createAction.Parameters = json.RawMessage(`{"name": "New IC", "category": "simulator", "type": "dpsim"}`)
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", managerID), "POST", []Action{createAction})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+}
+
+func TestTrackActionsOfIC(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// test POST ic/ $newICA
+	newIC1.ManagedExternally = newFalse()
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	newICID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	getActions := func() []database.ICAction {
+		code, resp, err := helper.TestEndpoint(router, token,
+			fmt.Sprintf("/api/v2/ic/%v/actions", newICID), "GET", nil)
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+		var actions struct {
+			Actions []database.ICAction `json:"actions"`
+		}
+		assert.NoError(t, json.Unmarshal(resp.Bytes(), &actions))
+		return actions.Actions
+	}
+
+	// send a start action to the IC
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", []Action{{Act: "start", When: time.Now().Unix()}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	var sent struct {
+		Actions []database.ICAction `json:"actions"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &sent))
+	assert.Equal(t, 1, len(sent.Actions))
+	startID := sent.Actions[0].UUID
+
+	actions := getActions()
+	assert.Equal(t, 1, len(actions))
+	assert.Equal(t, startID, actions[0].UUID)
+	assert.Equal(t, "start", actions[0].Action)
+	assert.Equal(t, ActionSent, actions[0].State)
+	assert.Equal(t, uint(1), actions[0].UserID)
+
+	err = session.CheckConnection()
+	assert.NoError(t, err)
+
+	// fake status updates of the IC
+	var update ICUpdate
+	update.Properties.Name = newIC1.Name
+	update.Properties.Category = newIC1.Category
+	update.Properties.Type = newIC1.Type
+	update.Properties.UUID = newIC1.UUID
+	update.Status.ManagedBy = newIC1.Manager
+	sendStatus := func(state string) {
+		update.Status.State = state
+		payload, err := json.Marshal(update)
+		assert.NoError(t, err)
+		err = session.Send(payload, newIC1.Manager)
+		assert.NoError(t, err)
+		time.Sleep(waitingTime * time.Second)
+	}
+
+	sendStatus("starting")
+	actions = getActions()
+	assert.Equal(t, ActionAcknowledged, actions[0].State)
+
+	sendStatus("running")
+	actions = getActions()
+	assert.Equal(t, ActionRunning, actions[0].State)
+
+	// send a stop action which is rejected by the IC
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", []Action{{Act: "stop", When: time.Now().Unix()}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	actions = getActions()
+	assert.Equal(t, 2, len(actions))
+	stopID := actions[0].UUID
+	assert.NotEqual(t, startID, stopID)
+
+	var reply ICUpdate
+	reply.Properties.UUID = newIC1.UUID
+	reply.Action = "stop"
+	reply.Reply = &ICActionReply{ID: stopID, State: ActionFailed, Message: "Simulation cannot be stopped"}
+	payload, err := json.Marshal(reply)
+	assert.NoError(t, err)
+	err = session.Send(payload, newIC1.Manager)
+	assert.NoError(t, err)
+	time.Sleep(waitingTime * time.Second)
+
+	actions = getActions()
+	assert.Equal(t, ActionFailed, actions[0].State)
+	assert.Equal(t, "Simulation cannot be stopped", actions[0].Message)
+	assert.NotNil(t, actions[0].FinishedAt)
+	assert.Equal(t, ActionRunning, actions[1].State)
+
+	// the start action is completed once the simulation has finished
+	sendStatus("idle")
+	actions = getActions()
+	assert.Equal(t, ActionFailed, actions[0].State)
+	assert.Equal(t, ActionCompleted, actions[1].State)
+	assert.NotNil(t, actions[1].FinishedAt)
+
+	// actions which are not acknowledged in time time out
+	t.Setenv("AMQP_ACTION_TIMEOUT", "1ms")
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", []Action{{Act: "reset", When: time.Now().Unix()}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	time.Sleep(10 * time.Millisecond)
+
+	actions = getActions()
+	assert.Equal(t, 3, len(actions))
+	assert.Equal(t, ActionTimedOut, actions[0].State)
+
+	// guests are not allowed to see the actions of an IC
+	guestToken, err := helper.AuthenticateForTest(router, database.GuestCredentials)
+	assert.NoError(t, err)
+	code, resp, err = helper.TestEndpoint(router, guestToken,
+		fmt.Sprintf("/api/v2/ic/%v/actions", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+}
+
+func TestScheduleActions(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// test POST ic/ $newICA
+	newIC1.ManagedExternally = newFalse()
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	newICID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// schedule a start action for tomorrow and a stop action in the near future
+	now := time.Now()
+	actions := []Action{
+		{Act: "start", When: now.Add(24 * time.Hour).Unix()},
+		{Act: "stop", When: now.Add(time.Minute).Unix()},
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", actions)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	var sent struct {
+		Actions []database.ICAction `json:"actions"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &sent))
+	assert.Equal(t, 2, len(sent.Actions))
+	for _, a := range sent.Actions {
+		assert.Equal(t, ActionScheduled, a.State)
+	}
+	startID := sent.Actions[0].ID
+	stopID := sent.Actions[1].ID
+
+	// list the scheduled actions
+	number, err := helper.LengthOfResponse(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions?state=scheduled", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, number)
+
+	// dispatch the actions which are due in two minutes
+	err = dispatchScheduledActions(now.Add(2 * time.Minute))
+	assert.NoError(t, err)
+
+	number, err = helper.LengthOfResponse(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions?state=scheduled", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, number)
+	number, err = helper.LengthOfResponse(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions?state=sent", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, number)
+
+	// try to cancel the action which has already been sent
+	// should result in bad request
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions/%v", newICID, stopID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	// cancel the scheduled start action
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions/%v", newICID, startID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"action": map[string]interface{}{"state": ActionCancelled}})
+	assert.NoError(t, err)
+
+	// cancelled actions are never sent
+	err = dispatchScheduledActions(now.Add(48 * time.Hour))
+	assert.NoError(t, err)
+	number, err = helper.LengthOfResponse(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions?state=cancelled", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, number)
+
+	// try to cancel an action which does not exist
+	// should result in not found
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions/%v", newICID, startID+10), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 404, code, "Response body: \n%v\n", resp)
+
+	// user A schedules a start action
+	tokenA, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", []Action{{Act: "start", When: now.Add(24 * time.Hour).Unix()}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &sent))
+	assert.Equal(t, 1, len(sent.Actions))
+	startAID := sent.Actions[0].ID
+
+	// user B tries to cancel the action of user A
+	// should result in unprocessable entity
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/actions/%v", newICID, startAID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/ic/%v/actions/%v", newICID, startAID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+}
+
+func TestReservations(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// test POST ic/ $newICA
+	newIC1.ManagedExternally = newFalse()
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	newICID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	tokenA, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+
+	// user A adds a scenario
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": map[string]string{"name": "Experiment"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	scenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// user A reserves the IC for the scenario from now on
+	now := time.Now()
+	reservationA := map[string]interface{}{
+		"scenarioID":  scenarioID,
+		"start":       now.Add(-time.Hour),
+		"end":         now.Add(2 * time.Hour),
+		"description": "Experiment; part 1",
+	}
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/ic/%v/reservations", newICID), "POST", helper.KeyModels{"reservation": reservationA})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	reservationAID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// user B tries to reserve the IC for an overlapping time window
+	// should result in conflict
+	reservationB := map[string]interface{}{
+		"start": now.Add(time.Hour),
+		"end":   now.Add(3 * time.Hour),
+	}
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/reservations", newICID), "POST", helper.KeyModels{"reservation": reservationB})
+	assert.NoError(t, err)
+	assert.Equalf(t, 409, code, "Response body: \n%v\n", resp)
+
+	// user B tries to reserve the IC for a time window which ends before it starts
+	// should result in bad request
+	reservationB["start"] = now.Add(4 * time.Hour)
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/reservations", newICID), "POST", helper.KeyModels{"reservation": reservationB})
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	// user B reserves the IC right after the reservation of user A
+	reservationB["start"] = now.Add(2 * time.Hour)
+	reservationB["end"] = now.Add(4 * time.Hour)
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/reservations", newICID), "POST", helper.KeyModels{"reservation": reservationB})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// user B tries to start the IC during the reservation of user A
+	// should result in conflict
+	start := []Action{{Act: "start", When: now.Unix()}}
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", start)
+	assert.NoError(t, err)
+	assert.Equalf(t, 409, code, "Response body: \n%v\n", resp)
+
+	// other actions are not restricted by reservations
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", []Action{{Act: "stop", When: now.Unix()}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// user B may start the IC during the own reservation
+	start[0].When = now.Add(3 * time.Hour).Unix()
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", start)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// user A and the members of the scenario may start the IC during the reservation of user A
+	start[0].When = now.Unix()
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", start)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/scenarios/%v/user?username=User_B", scenarioID), "PUT", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", start)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// list the reservations
+	number, err := helper.LengthOfResponse(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/reservations", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, number)
+
+	number, err = helper.LengthOfResponse(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/reservations?from=%v", newICID, url.QueryEscape(now.Add(3*time.Hour).Format(time.RFC3339))), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, number)
+
+	// get the reservations as iCalendar feed
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/reservations.ics", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	calendar := resp.String()
+	assert.True(t, strings.HasPrefix(calendar, "BEGIN:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(calendar, "BEGIN:VEVENT\r\n"))
+	assert.Contains(t, calendar, "SUMMARY:"+newIC1.Name+" reserved by "+database.UserA.Username)
+	assert.Contains(t, calendar, `DESCRIPTION:Experiment\; part 1`)
+
+	// user B tries to delete the reservation of user A
+	// should result in unprocessable entity
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/reservations/%v", newICID, reservationAID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/ic/%v/reservations/%v", newICID, reservationAID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	number, err = helper.LengthOfResponse(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/reservations", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, number)
+}
+
+func TestStaleICs(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// a gateway whose API is queried, two externally managed simulators
+	// and an IC which never receives status updates
+	usedIC := newIC2
+	usedIC.UUID = "4854af30-325f-44a5-ad59-b67b2597dead"
+	manualIC := newIC1
+	manualIC.UUID = "7be0322d-354e-431e-84bd-ae4c96331111"
+	manualIC.APIURL = ""
+	manualIC.Type = "generic"
+	otherIC := newIC2
+	otherIC.UUID = "4854af30-325f-44a5-ad59-b67b25972222"
+	newIC1.ManagedExternally = newFalse()
+
+	var icIDs []int
+	for _, ic := range []ICRequest{newIC1, newIC2, usedIC, manualIC, otherIC} {
+		code, resp, err := helper.TestEndpoint(router, token,
+			"/api/v2/ic", "POST", helper.KeyModels{"ic": ic})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+		id, err := helper.GetResponseID(resp)
+		assert.NoError(t, err)
+		icIDs = append(icIDs, id)
+	}
+
+	// use one of the simulators in a component configuration
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": ScenarioRequest{Name: "ScenarioA"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	scenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	newConfig := ConfigRequest{
+		Name:       "ConfigA",
+		ScenarioID: uint(scenarioID),
+		ICID:       uint(icIDs[2]),
+		FileIDs:    []int64{},
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/configs", "POST", helper.KeyModels{"config": newConfig})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	states := func() []string {
+		var result []string
+		for _, id := range icIDs {
+			var ic database.InfrastructureComponent
+			if database.GetDB().Find(&ic, id).Error != nil {
+				result = append(result, "deleted")
+			} else {
+				result = append(result, ic.State)
+			}
+		}
+		return result
+	}
+
+	// ICs with recent status updates are not stale
+	err = markStaleICs(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"idle", "running", "running", "idle", "running"}, states())
+
+	// the last status update of all ICs was two hours ago
+	err = database.GetDB().Model(&database.InfrastructureComponent{}).
+		Update("StateUpdateAt", time.Now().Add(-2*time.Hour).Format(time.RFC1123Z)).Error
+	assert.NoError(t, err)
+
+	err = markStaleICs(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{StateStale, StateStale, StateStale, "idle", StateStale}, states())
+
+	// stale externally managed ICs can be deleted via the API
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v", icIDs[4]), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// stale externally managed ICs which are not used by component configurations are deleted if configured
+	t.Setenv("STALEICDELETE", "true")
+	err = markStaleICs(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{StateStale, "deleted", StateStale, "idle", "deleted"}, states())
+}
+
+func TestICHistory(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	newICID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	var ic InfrastructureComponent
+	assert.NoError(t, ic.ByID(uint(newICID)))
+
+	// the IC was running for an hour, in error for half an hour and idle afterwards
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	for _, s := range []struct {
+		offset time.Duration
+		state  string
+	}{
+		{0, "running"},
+		{30 * time.Minute, "running"},
+		{time.Hour, "error"},
+		{90 * time.Minute, "idle"},
+	} {
+		previousState := ic.State
+		assert.NoError(t, ic.updateState(s.state))
+		assert.NoError(t, ic.recordState(previousState))
+		err = database.GetDB().Model(&database.ICStateSample{}).Where("id = (SELECT MAX(id) FROM ic_state_samples)").
+			Update("created_at", start.Add(s.offset)).Error
+		assert.NoError(t, err)
+	}
+
+	// invalid time windows are rejected
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/history?from=yesterday", newICID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	query := url.Values{}
+	query.Set("from", start.Add(-time.Hour).Format(time.RFC3339))
+	query.Set("to", start.Add(-2*time.Hour).Format(time.RFC3339))
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/history?%v", newICID, query.Encode()), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	// get the history of two hours starting half an hour after the first sample
+	query.Set("from", start.Add(30*time.Minute).Format(time.RFC3339))
+	query.Set("to", start.Add(150*time.Minute).Format(time.RFC3339))
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/history?%v", newICID, query.Encode()), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	var history struct {
+		History      []database.ICStateSample `json:"history"`
+		Availability Availability             `json:"availability"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &history))
+	assert.Equal(t, 3, len(history.History))
+	assert.False(t, history.History[0].Transition)
+	assert.True(t, history.History[1].Transition)
+	assert.Equal(t, "error", history.History[1].State)
+	assert.InDelta(t, 25.0, history.Availability.States["running"], 0.001)
+	assert.InDelta(t, 25.0, history.Availability.States["error"], 0.001)
+	assert.InDelta(t, 50.0, history.Availability.States["idle"], 0.001)
+	assert.InDelta(t, 75.0, history.Availability.Available, 0.001)
+
+	// the time before the first sample is unknown
+	query.Set("from", start.Add(-time.Hour).Format(time.RFC3339))
+	query.Set("to", start.Add(time.Hour).Format(time.RFC3339))
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/history?%v", newICID, query.Encode()), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &history))
+	assert.InDelta(t, 50.0, history.Availability.States["unknown"], 0.001)
+	assert.InDelta(t, 50.0, history.Availability.Available, 0.001)
+
+	// samples older than the retention time are deleted
+	t.Setenv("ICHISTORYRETENTION", "100m")
+	assert.NoError(t, pruneHistory(time.Now()))
+	samples, err := ic.getHistory(start, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, "idle", samples[0].State)
+
+	// the history of non-existing ICs cannot be requested
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/history", newICID+1), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 404, code, "Response body: \n%v\n", resp)
+}
+
+func TestPollICs(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+	schedules = map[uint]*pollSchedule{}
+	schedulesLoaded = time.Time{}
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"info": {"state": "paused", "uptime": 42}}`)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# TYPE uptime_seconds gauge\nuptime_seconds 17\nrequests_total{code=\"200\"} 3\n")
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/hanging", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	newIC := func(uuid string, settings string) ICRequest {
+		ic := newIC2
+		ic.UUID = uuid
+		ic.APIURL = server.URL
+		ic.Type = "generic"
+		ic.ManagedExternally = newFalse()
+		ic.PollSettings = postgres.Jsonb{RawMessage: json.RawMessage(settings)}
+		return ic
+	}
+
+	// invalid poll settings are rejected
+	for _, settings := range []string{`{"poller": "unknown"}`, `{"interval": "soon"}`, `{"timeout": "-1s"}`} {
+		code, resp, err := helper.TestEndpoint(router, token,
+			"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC("4854af30-325f-44a5-ad59-b67b25970000", settings)})
+		assert.NoError(t, err)
+		assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+	}
+
+	var icIDs []uint
+	for _, ic := range []ICRequest{
+		newIC("4854af30-325f-44a5-ad59-b67b25970001",
+			`{"poller": "json", "path": "/status", "stateField": "info.state", "uptimeField": "info.uptime", "interval": "1m"}`),
+		newIC("4854af30-325f-44a5-ad59-b67b25970002",
+			`{"poller": "prometheus", "uptimeField": "uptime_seconds"}`),
+		newIC("4854af30-325f-44a5-ad59-b67b25970003",
+			`{"poller": "json", "path": "/broken", "interval": "10s", "maxBackoff": "30s"}`),
+		newIC("4854af30-325f-44a5-ad59-b67b25970004", `{}`),
+		newIC("4854af30-325f-44a5-ad59-b67b25970005",
+			`{"poller": "json", "path": "/hanging", "timeout": "500ms"}`),
+	} {
+		code, resp, err := helper.TestEndpoint(router, token,
+			"/api/v2/ic", "POST", helper.KeyModels{"ic": ic})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+		id, err := helper.GetResponseID(resp)
+		assert.NoError(t, err)
+		icIDs = append(icIDs, uint(id))
+	}
+
+	// a hanging IC does not delay the queries of the other ICs
+	now := time.Now()
+	started := time.Now()
+	assert.NoError(t, pollICs(context.Background(), now, 10*time.Second))
+	polls.Wait()
+	assert.Less(t, time.Since(started), 5*time.Second)
+	assert.Equal(t, 1, schedules[icIDs[4]].failures)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.ICPollFailures.WithLabelValues("4854af30-325f-44a5-ad59-b67b25970005", newIC2.Name)))
+
+	var ic database.InfrastructureComponent
+	assert.NoError(t, database.GetDB().Find(&ic, icIDs[0]).Error)
+	assert.Equal(t, "paused", ic.State)
+	assert.Equal(t, 42.0, ic.Uptime)
+	assert.Equal(t, now.Add(time.Minute), schedules[icIDs[0]].next)
+
+	assert.NoError(t, database.GetDB().Find(&ic, icIDs[1]).Error)
+	assert.Equal(t, "running", ic.State)
+	assert.Equal(t, 17.0, ic.Uptime)
+	assert.Equal(t, now.Add(10*time.Second), schedules[icIDs[1]].next)
+
+	// failed queries leave the IC unchanged and are retried with backoff
+	assert.NoError(t, database.GetDB().Find(&ic, icIDs[2]).Error)
+	assert.Equal(t, "running", ic.State)
+	assert.Equal(t, now.Add(20*time.Second), schedules[icIDs[2]].next)
+
+	assert.NoError(t, pollICs(context.Background(), now.Add(20*time.Second), 10*time.Second))
+	polls.Wait()
+	assert.Equal(t, 2, schedules[icIDs[2]].failures)
+	assert.Equal(t, now.Add(50*time.Second), schedules[icIDs[2]].next)
+
+	// ICs without poller for their category and type are not queried
+	_, ok := schedules[icIDs[3]]
+	assert.False(t, ok)
+
+	// added ICs are queried once all ICs are loaded again
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC("4854af30-325f-44a5-ad59-b67b25970006",
+			`{"poller": "prometheus", "uptimeField": "uptime_seconds"}`)})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	id, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	assert.NoError(t, pollICs(context.Background(), now.Add(25*time.Second), 10*time.Second))
+	polls.Wait()
+	_, ok = schedules[uint(id)]
+	assert.False(t, ok)
+
+	assert.NoError(t, pollICs(context.Background(), now.Add(30*time.Second), 10*time.Second))
+	polls.Wait()
+	assert.Equal(t, now.Add(40*time.Second), schedules[uint(id)].next)
 }
 
 func TestCreateUpdateViaAMQPRecv(t *testing.T) {
@@ -789,3 +1601,168 @@ func TestDeleteICViaAMQPRecv(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 0, number)
 }
+
+// readEvent reads the next server-sent event from the IC stream
+func readEvent(reader *bufio.Reader) (string, map[string]database.InfrastructureComponent, error) {
+	var name string
+	var data map[string]database.InfrastructureComponent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			return name, data, nil
+		}
+		if strings.HasPrefix(line, "event:") {
+			name = strings.TrimPrefix(line, "event:")
+		} else if strings.HasPrefix(line, "data:") {
+			err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &data)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+	}
+}
+
+func TestStreamICs(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// authenticate as guest
+	guestToken, err := helper.AuthenticateForTest(router, database.GuestCredentials)
+	assert.NoError(t, err)
+
+	// connect to the IC stream as guest
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/v2/ic/stream", nil)
+	assert.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+guestToken)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// add an IC
+	code, body, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", body)
+	newICID, err := helper.GetResponseID(body)
+	assert.NoError(t, err)
+
+	name, data, err := readEvent(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, EventCreate, name)
+	assert.Equal(t, newIC1.UUID, data["ic"].UUID)
+
+	// updates which do not change the state are not pushed
+	updatedIC := ICRequest{Description: "A new description", ManagedExternally: newFalse()}
+	code, body, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v", newICID), "PUT", helper.KeyModels{"ic": updatedIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", body)
+
+	// change the state of the IC
+	updatedIC = ICRequest{State: "running", ManagedExternally: newFalse()}
+	code, body, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v", newICID), "PUT", helper.KeyModels{"ic": updatedIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", body)
+
+	name, data, err = readEvent(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, EventUpdate, name)
+	assert.Equal(t, "running", data["ic"].State)
+	assert.Equal(t, "A new description", data["ic"].Description)
+
+	// delete the IC
+	code, body, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/ic/%v", newICID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", body)
+
+	name, data, err = readEvent(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, EventDelete, name)
+	assert.Equal(t, uint(newICID), data["ic"].ID)
+
+	// the stream ends when the server shuts down
+	defer func() { stream = newICStream() }()
+	CloseStreams()
+	_, _, err = readEvent(reader)
+	assert.Error(t, err)
+
+	// try to connect with an invalid IC filter
+	// should return a bad request error
+	code, body, err = helper.TestEndpoint(router, token,
+		"/api/v2/ic/stream?ic=abc", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", body)
+}
+
+func TestScheduledActionOfReservedIC(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	newIC1.ManagedExternally = newFalse()
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	newICID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	tokenA, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+
+	// user B schedules a start action while the IC is not reserved
+	now := time.Now()
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/ic/%v/action", newICID), "POST", []Action{{Act: "start", When: now.Add(time.Hour).Unix()}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// user A reserves the IC for the time of the action afterwards
+	reservation := map[string]interface{}{
+		"start": now,
+		"end":   now.Add(2 * time.Hour),
+	}
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/ic/%v/reservations", newICID), "POST", helper.KeyModels{"reservation": reservation})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// the action of user B is not sent but fails once it is due
+	err = dispatchScheduledActions(now.Add(90 * time.Minute))
+	assert.NoError(t, err)
+
+	number, err := helper.LengthOfResponse(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions?state=%v", newICID, ActionFailed), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, number)
+	number, err = helper.LengthOfResponse(router, token,
+		fmt.Sprintf("/api/v2/ic/%v/actions?state=%v", newICID, ActionSent), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, number)
+}
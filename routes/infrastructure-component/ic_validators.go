@@ -18,9 +18,13 @@
 package infrastructure_component
 
 import (
+	"fmt"
+	"log"
 	"math"
 	"time"
 
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm/dialects/postgres"
 	"gopkg.in/go-playground/validator.v9"
@@ -41,6 +45,7 @@ type validNewIC struct {
 	StartParameterSchema  postgres.Jsonb `form:"StartParameterSchema" validate:"omitempty"`
 	CreateParameterSchema postgres.Jsonb `form:"CreateParameterSchema" validate:"omitempty"`
 	StatusUpdateRaw       postgres.Jsonb `form:"StatusUpdateRaw" validate:"omitempty"`
+	PollSettings          postgres.Jsonb `form:"PollSettings" validate:"omitempty"`
 	ManagedExternally     *bool          `form:"ManagedExternally" validate:"required"`
 	Manager               string         `form:"Manager" validate:"omitempty"`
 	Uptime                float64        `form:"Uptime" validate:"omitempty"`
@@ -59,10 +64,22 @@ type validUpdatedIC struct {
 	StartParameterSchema  postgres.Jsonb `form:"StartParameterSchema" validate:"omitempty"`
 	CreateParameterSchema postgres.Jsonb `form:"CreateParameterSchema" validate:"omitempty"`
 	StatusUpdateRaw       postgres.Jsonb `form:"StatusUpdateRaw" validate:"omitempty"`
+	PollSettings          postgres.Jsonb `form:"PollSettings" validate:"omitempty"`
 	Manager               string         `form:"Manager" validate:"omitempty"`
 	Uptime                float64        `form:"Uptime" validate:"omitempty"`
 }
 
+type validNewReservation struct {
+	ScenarioID  uint      `form:"ScenarioID" validate:"omitempty"`
+	Start       time.Time `form:"Start" validate:"required"`
+	End         time.Time `form:"End" validate:"required"`
+	Description string    `form:"Description" validate:"omitempty"`
+}
+
+type addReservationRequest struct {
+	Reservation validNewReservation `json:"reservation"`
+}
+
 type AddICRequest struct {
 	InfrastructureComponent validNewIC `json:"ic"`
 }
@@ -92,6 +109,8 @@ func (r *AddICRequest) validate() error {
 		}
 	}
 
+	// check if poll settings are valid
+	_, errs = parsePollSettings(r.InfrastructureComponent.PollSettings.RawMessage)
 	return errs
 }
 
@@ -110,6 +129,8 @@ func (r *UpdateICRequest) validate() error {
 		}
 	}
 
+	// check if poll settings are valid
+	_, errs = parsePollSettings(r.InfrastructureComponent.PollSettings.RawMessage)
 	return errs
 }
 
@@ -128,6 +149,7 @@ func (r *AddICRequest) createIC() (InfrastructureComponent, error) {
 	s.StartParameterSchema = r.InfrastructureComponent.StartParameterSchema
 	s.CreateParameterSchema = r.InfrastructureComponent.CreateParameterSchema
 	s.StatusUpdateRaw = r.InfrastructureComponent.StatusUpdateRaw
+	s.PollSettings = r.InfrastructureComponent.PollSettings
 	s.ManagedExternally = *r.InfrastructureComponent.ManagedExternally
 	s.Manager = r.InfrastructureComponent.Manager
 	s.Uptime = math.Round(r.InfrastructureComponent.Uptime) // round required for backward compatibility of data model
@@ -159,8 +181,59 @@ func (r *UpdateICRequest) updatedIC(oldIC InfrastructureComponent) Infrastructur
 	s.StartParameterSchema = r.InfrastructureComponent.StartParameterSchema
 	s.CreateParameterSchema = r.InfrastructureComponent.CreateParameterSchema
 	s.StatusUpdateRaw = r.InfrastructureComponent.StatusUpdateRaw
+	s.PollSettings = r.InfrastructureComponent.PollSettings
 
 	// set last update time
 	s.StateUpdateAt = time.Now().Format(time.RFC1123Z)
 	return s
 }
+
+// ValidateParameters returns the violations of the schema of the IC by the
+// parameters of the action. Start actions are validated against the start
+// parameter schema and create actions against the create parameter schema.
+func (a *Action) ValidateParameters(ic database.InfrastructureComponent) []helper.SchemaError {
+	var schema []byte
+	switch a.Act {
+	case "start":
+		schema = ic.StartParameterSchema.RawMessage
+	case "create":
+		schema = ic.CreateParameterSchema.RawMessage
+	default:
+		return nil
+	}
+
+	errs, err := helper.ValidateJSONSchema(schema, a.Parameters)
+	if err != nil {
+		log.Printf("Cannot validate parameters of %v action against schema of IC %v (ID=%d): %v", a.Act, ic.Name, ic.ID, err)
+		return nil
+	}
+
+	return errs
+}
+
+func (r *addReservationRequest) validate() error {
+	validate = validator.New()
+	errs := validate.Struct(r)
+	if errs != nil {
+		return errs
+	}
+
+	if !r.Reservation.End.After(r.Reservation.Start) {
+		return fmt.Errorf("end of reservation has to be after its start")
+	}
+	if r.Reservation.End.Before(time.Now()) {
+		return fmt.Errorf("reservation lies in the past")
+	}
+
+	return nil
+}
+
+func (r *addReservationRequest) createReservation(userID uint) database.Reservation {
+	return database.Reservation{
+		UserID:      userID,
+		ScenarioID:  r.Reservation.ScenarioID,
+		Start:       r.Reservation.Start,
+		End:         r.Reservation.End,
+		Description: r.Reservation.Description,
+	}
+}
@@ -0,0 +1,135 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package job
+
+import (
+	"net/http"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterJobEndpoints(r *gin.RouterGroup) {
+	r.GET("", getJobs)
+	r.GET("/:jobID", getJob)
+	r.POST("/:jobID/cancel", cancelJob)
+}
+
+// getJobs godoc
+// @Summary Get all jobs of the user and of the scenarios of the user (all jobs for admins)
+// @ID getJobs
+// @Produce  json
+// @Tags jobs
+// @Success 200 {object} api.ResponseJobs "Jobs of the user"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param state query string false "Only return jobs in this state" Enums(pending, running, succeeded, failed, cancelled)
+// @Param type query string false "Only return jobs of this type"
+// @Router /jobs [get]
+// @Security Bearer
+func getJobs(c *gin.Context) {
+
+	ok, _ := database.CheckJobPermissions(c, database.Read, "none", -1)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	query := db.Order("ID asc")
+
+	userRole, _ := c.Get(database.UserRoleCtx)
+	if userRole != "Admin" {
+		// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+		userID, _ := c.Get(database.UserIDCtx)
+		// jobs started by the user and jobs operating on scenarios of the user
+		scenarioIDs := db.Table("user_scenarios").Select("scenario_id").Where("user_id = ?", userID.(uint)).SubQuery()
+		query = query.Where("user_id = ? OR scenario_id IN ?", userID.(uint), scenarioIDs)
+	}
+
+	if state := c.Query("state"); state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	if jobType := c.Query("type"); jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var jobList []database.Job
+	err := query.Find(&jobList).Error
+	if !helper.DBError(c, err) {
+		c.JSON(http.StatusOK, gin.H{"jobs": jobList})
+	}
+}
+
+// getJob godoc
+// @Summary Get a job, including its state, progress and error
+// @ID getJob
+// @Produce  json
+// @Tags jobs
+// @Success 200 {object} api.ResponseJob "Job that was requested"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param jobID path int true "Job ID"
+// @Router /jobs/{jobID} [get]
+// @Security Bearer
+func getJob(c *gin.Context) {
+
+	ok, j := database.CheckJobPermissions(c, database.Read, "path", -1)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": j})
+}
+
+// cancelJob godoc
+// @Summary Cancel a pending or running job
+// @ID cancelJob
+// @Produce  json
+// @Tags jobs
+// @Success 200 {object} api.ResponseJob "Job that was cancelled"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param jobID path int true "Job ID"
+// @Router /jobs/{jobID}/cancel [post]
+// @Security Bearer
+func cancelJob(c *gin.Context) {
+
+	ok, j := database.CheckJobPermissions(c, database.Update, "path", -1)
+	if !ok {
+		return
+	}
+
+	err := jobs.Cancel(j.ID)
+	if err != nil {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	}
+
+	db := database.GetDB()
+	err = db.Find(&j, j.ID).Error
+	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelJob, j.ID, j.ScenarioID, nil, gin.H{"cancelled": true})
+		c.JSON(http.StatusOK, gin.H{"job": j})
+	}
+}
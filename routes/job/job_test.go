@@ -0,0 +1,220 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package job
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var router *gin.Engine
+
+// ID of user A added by database.AddTestUsers
+const userAID = 2
+
+func TestMain(m *testing.M) {
+	err := configuration.InitConfig()
+	if err != nil {
+		panic(m)
+	}
+
+	err = database.InitDB(configuration.GlobalConfig, true)
+	if err != nil {
+		panic(m)
+	}
+	defer database.DBpool.Close()
+
+	router = gin.Default()
+	api := router.Group("/api/v2")
+
+	user.RegisterAuthenticate(api.Group("/authenticate"))
+	api.Use(user.Authentication())
+	RegisterJobEndpoints(api.Group("/jobs"))
+
+	os.Exit(m.Run())
+}
+
+func TestGetJobs(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// submit a succeeding, a failing and a panicking job for user A
+	succeeding, err := jobs.Submit("test", userAID, 0, func(ctx context.Context, j *jobs.Job) error {
+		j.SetProgress(50, "half way")
+		return j.SetResult(map[string]string{"answer": "42"})
+	})
+	assert.NoError(t, err)
+	failing, err := jobs.Submit("test", userAID, 0, func(ctx context.Context, j *jobs.Job) error {
+		return fmt.Errorf("something went wrong")
+	})
+	assert.NoError(t, err)
+	_, err = jobs.Submit("test", userAID, 0, func(ctx context.Context, j *jobs.Job) error {
+		panic("something went really wrong")
+	})
+	assert.NoError(t, err)
+
+	jobs.Wait()
+
+	// authenticate as normal user
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	// get all jobs of user A
+	numberOfJobs, err := helper.LengthOfResponse(router, token,
+		"/api/v2/jobs", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, numberOfJobs)
+
+	// get failed jobs of user A
+	numberOfJobs, err = helper.LengthOfResponse(router, token,
+		"/api/v2/jobs?state=failed", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, numberOfJobs)
+
+	// get the succeeded job
+	code, resp, err := helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/jobs/%v", succeeding.ID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"job": map[string]interface{}{
+		"state":    jobs.StateSucceeded,
+		"progress": 100,
+		"message":  "half way",
+		"result":   map[string]string{"answer": "42"},
+	}})
+	assert.NoError(t, err)
+
+	// get the failed job
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/jobs/%v", failing.ID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"job": map[string]interface{}{
+		"state": jobs.StateFailed,
+		"error": "something went wrong",
+	}})
+	assert.NoError(t, err)
+
+	// authenticate as user B
+	token, err = helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+
+	// user B has no jobs
+	numberOfJobs, err = helper.LengthOfResponse(router, token,
+		"/api/v2/jobs", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, numberOfJobs)
+
+	// try to get a job of user A as user B
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/jobs/%v", succeeding.ID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// try to get a job that does not exist
+	// should return a not found error
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/jobs/100", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 404, code, "Response body: \n%v\n", resp)
+
+	// authenticate as admin
+	token, err = helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// admin sees all jobs
+	numberOfJobs, err = helper.LengthOfResponse(router, token,
+		"/api/v2/jobs", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, numberOfJobs)
+}
+
+func TestCancelJob(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// submit a job for user A which runs until it is cancelled
+	started := make(chan struct{})
+	blocking, err := jobs.Submit("test", userAID, 0, func(ctx context.Context, j *jobs.Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.NoError(t, err)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not started")
+	}
+
+	// authenticate as user B
+	token, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+
+	// try to cancel the job of user A as user B
+	// should return an unprocessable entity error
+	code, resp, err := helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/jobs/%v/cancel", blocking.ID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// authenticate as user A
+	token, err = helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	// cancel the job
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/jobs/%v/cancel", blocking.ID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	jobs.Wait()
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/jobs/%v", blocking.ID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"job": map[string]interface{}{
+		"state": jobs.StateCancelled,
+	}})
+	assert.NoError(t, err)
+
+	// try to cancel the job again
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/jobs/%v/cancel", blocking.ID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+}
@@ -67,6 +67,22 @@ var (
 			Help: "A counter for the total number of dashboards",
 		},
 	)
+
+	ICPollDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "infrastructure_component_poll_duration_seconds",
+			Help: "Latency of queries of the APIs of infrastructure components",
+		},
+		[]string{"uuid", "name"},
+	)
+
+	ICPollFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "infrastructure_component_poll_failures_total",
+			Help: "A counter for the failed queries of the APIs of infrastructure components",
+		},
+		[]string{"uuid", "name"},
+	)
 )
 
 // RegisterMetricsEndpoint godoc
@@ -104,6 +120,8 @@ func RegisterMetricsEndpoint(rg *gin.RouterGroup) {
 		ScenarioCounter,
 		UserCounter,
 		DashboardCounter,
+		ICPollDuration,
+		ICPollFailures,
 	)
 }
 
@@ -30,17 +30,23 @@ import (
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/audit"
 	component_configuration "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/component-configuration"
 	config_route "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/config"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/dashboard"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/file"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/healthz"
 	infrastructure_component "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/infrastructure-component"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/job"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/metrics"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/openapi"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/result"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario"
+	scenario_run "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario-run"
+	scenario_transfer "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario-transfer"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/signal"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/token"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/trash"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/usergroup"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/widget"
@@ -84,6 +90,8 @@ func RegisterEndpoints(router *gin.Engine, api *gin.RouterGroup) {
 	api.Use(user.Authentication())
 
 	scenario.RegisterScenarioEndpoints(api.Group("/scenarios"))
+	scenario_transfer.RegisterScenarioTransferEndpoints(api.Group("/scenarios"))
+	scenario_run.RegisterScenarioRunEndpoints(api.Group("/scenarios"))
 	usergroup.RegisterUserGroupEndpoints(api.Group("/usergroups"))
 	component_configuration.RegisterComponentConfigurationEndpoints(api.Group("/configs"))
 	signal.RegisterSignalEndpoints(api.Group("/signals"))
@@ -93,6 +101,10 @@ func RegisterEndpoints(router *gin.Engine, api *gin.RouterGroup) {
 	user.RegisterUserEndpoints(api.Group("/users"))
 	infrastructure_component.RegisterICEndpoints(api.Group("/ic"))
 	result.RegisterResultEndpoints(api.Group("/results"))
+	job.RegisterJobEndpoints(api.Group("/jobs"))
+	audit.RegisterAuditEndpoints(api.Group("/audit"))
+	token.RegisterAPITokenEndpoints(api.Group("/tokens"))
+	trash.RegisterTrashEndpoints(api.Group("/trash"))
 
 	metrics.InitCounters()
 
@@ -18,11 +18,13 @@
 package result
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/file"
 	"github.com/gin-gonic/gin"
 )
@@ -35,6 +37,7 @@ func RegisterResultEndpoints(r *gin.RouterGroup) {
 	r.DELETE("/:resultID", deleteResult)
 	r.POST("/:resultID/file", addResultFile)
 	r.DELETE("/:resultID/file/:fileID", deleteResultFile)
+	r.POST("/:resultID/archive", archiveResult)
 }
 
 // getResults godoc
@@ -105,6 +108,7 @@ func addResult(c *gin.Context) {
 	// add result to DB and add association to scenario
 	err := newResult.addToScenario()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelResult, newResult.ID, newResult.ScenarioID, nil, newResult.Result)
 		c.JSON(http.StatusOK, gin.H{"result": newResult.Result})
 	}
 
@@ -152,6 +156,7 @@ func updateResult(c *gin.Context) {
 	// update the Result in the DB
 	err := oldResult.update(updatedResult)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelResult, oldResult_r.ID, oldResult_r.ScenarioID, oldResult_r, updatedResult.Result)
 		c.JSON(http.StatusOK, gin.H{"result": updatedResult.Result})
 	}
 
@@ -210,6 +215,7 @@ func deleteResult(c *gin.Context) {
 
 	err := result.delete()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelResult, result.ID, result.ScenarioID, result.Result, nil)
 		c.JSON(http.StatusOK, gin.H{"result": result.Result})
 	}
 
@@ -272,6 +278,8 @@ func addResultFile(c *gin.Context) {
 	// add file ID to ResultFileIDs of Result
 	err = result.addResultFileID(newFile.File.ID)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelFile, newFile.ID, newFile.ScenarioID, nil, newFile.File)
+		database.Audit(c, database.Update, database.ModelResult, result.ID, result.ScenarioID, result_r, result.Result)
 		c.JSON(http.StatusOK, gin.H{"result": result.Result})
 	}
 
@@ -325,7 +333,47 @@ func deleteResultFile(c *gin.Context) {
 	// Delete the file
 	err = f.Delete()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelResult, result.ID, result.ScenarioID, result_r, result.Result)
+		database.Audit(c, database.Delete, database.ModelFile, f.ID, f.ScenarioID, f.File, nil)
 		c.JSON(http.StatusOK, gin.H{"result": result.Result})
 	}
 
 }
+
+// archiveResult godoc
+// @Summary Start a job that bundles all files of a result into a zip file which is added to the scenario
+// @ID archiveResult
+// @Tags results
+// @Produce json
+// @Success 200 {object} api.ResponseJob "Job creating the archive, its result contains the ID of the archive file"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param resultID path int true "Result ID"
+// @Router /results/{resultID}/archive [post]
+// @Security Bearer
+func archiveResult(c *gin.Context) {
+	ok, result_r := database.CheckResultPermissions(c, database.Update, "path", -1)
+	if !ok {
+		return
+	}
+
+	var result Result
+	result.Result = result_r
+
+	if len(result.ResultFileIDs) == 0 {
+		helper.UnprocessableEntityError(c, "Result has no files to archive")
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+
+	job, err := jobs.Submit(ResultArchiveJob, userID.(uint), result.ScenarioID, func(ctx context.Context, j *jobs.Job) error {
+		return result.archive(ctx, j)
+	})
+	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelJob, job.ID, job.ScenarioID, nil, job)
+		c.JSON(http.StatusOK, gin.H{"job": job})
+	}
+}
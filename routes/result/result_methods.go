@@ -18,12 +18,22 @@
 package result
 
 import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"time"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/file"
 )
 
+// ResultArchiveJob is the type of the jobs archiving the files of a result
+const ResultArchiveJob = "result-archive"
+
 type Result struct {
 	database.Result
 }
@@ -79,17 +89,6 @@ func (r *Result) update(modifiedResult Result) error {
 func (r *Result) delete() error {
 
 	db := database.GetDB()
-	var sco database.Scenario
-	err := db.Find(&sco, r.ScenarioID).Error
-	if err != nil {
-		return err
-	}
-
-	// remove association between Result and Scenario
-	err = db.Model(&sco).Association("Results").Delete(r).Error
-	if err != nil {
-		return err
-	}
 
 	// Delete result files
 	for _, fileid := range r.ResultFileIDs {
@@ -105,8 +104,8 @@ func (r *Result) delete() error {
 		}
 	}
 
-	// Delete result
-	err = db.Delete(r).Error
+	// Delete result, the scenario ID is kept to restore the result from the trash
+	err := db.Delete(r).Error
 
 	return err
 }
@@ -144,3 +143,71 @@ func (r *Result) removeResultFileID(fileID uint) error {
 
 	return err
 }
+
+// archive bundles all files of the result into a zip file which is added to the scenario of the result
+func (r *Result) archive(ctx context.Context, j *jobs.Job) error {
+
+	// the zip file is written to a temporary file since the result files may be large
+	tmp, err := os.CreateTemp("", "villas-result-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+
+	for i, fileID := range r.ResultFileIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		j.SetProgress(uint(90*i/len(r.ResultFileIDs)), fmt.Sprintf("adding file %d of %d", i+1, len(r.ResultFileIDs)))
+
+		var f file.File
+		err := f.ByID(uint(fileID))
+		if err != nil {
+			return fmt.Errorf("result file %d: %w", fileID, err)
+		}
+
+		err = addToArchive(ctx, zw, &f)
+		if err != nil {
+			return fmt.Errorf("result file %d: %w", fileID, err)
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	j.SetProgress(90, "saving archive")
+
+	var archive file.File
+	archive.Name = fmt.Sprintf("result-%d.zip", r.ID)
+	archive.Type = "application/zip"
+	archive.Date = time.Now().String()
+	err = archive.Import(tmp, r.ScenarioID)
+	if err != nil {
+		return err
+	}
+
+	return j.SetResult(map[string]uint{"fileID": archive.ID})
+}
+
+// addToArchive copies the data of the file into the zip file
+func addToArchive(ctx context.Context, zw *zip.Writer, f *file.File) error {
+	data, err := f.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	// prefix names with the file ID since names of result files are not unique
+	w, err := zw.Create(fmt.Sprintf("%d_%s", f.ID, f.Name))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, data)
+	return err
+}
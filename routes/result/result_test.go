@@ -31,6 +31,7 @@ import (
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/file"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
@@ -483,3 +484,91 @@ func TestAddDeleteResultFile(t *testing.T) {
 	assert.Equal(t, 0, finalNumber)
 
 }
+
+func TestArchiveResult(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// prepare the content of the DB for testing
+	// by adding a scenario
+	scenarioID := addScenario()
+
+	newResult.ScenarioID = scenarioID
+	newResult.ConfigSnapshots = postgres.Jsonb{RawMessage: json.RawMessage(`{"configs": []}`)}
+	// authenticate as normal user
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		baseAPIResults, "POST", helper.KeyModels{"result": newResult})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	newResultID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// try to archive a result without files
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("%v/%v/archive", baseAPIResults, newResultID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// add a result file
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+	fileWriter, err := bodyWriter.CreateFormFile("file", "testuploadfile.csv")
+	assert.NoError(t, err, "writing to buffer")
+	_, err = io.Copy(fileWriter, bytes.NewBufferString("a,few,values\n1,2,3\n"))
+	assert.NoError(t, err, "IO copy")
+	contentType := bodyWriter.FormDataContentType()
+	bodyWriter.Close()
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", fmt.Sprintf("%v/%v/file", baseAPIResults, newResultID), bodyBuf)
+	assert.NoError(t, err, "create request")
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Add("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	assert.Equalf(t, 200, w.Code, "Response body: \n%v\n", w.Body)
+
+	// authenticate as guest user
+	guestToken, err := helper.AuthenticateForTest(router, database.GuestCredentials)
+	assert.NoError(t, err)
+
+	// try to archive the result as guest
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, guestToken,
+		fmt.Sprintf("%v/%v/archive", baseAPIResults, newResultID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// archive the result as normal user
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("%v/%v/archive", baseAPIResults, newResultID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	jobID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	jobs.Wait()
+
+	var job database.Job
+	db := database.GetDB()
+	assert.NoError(t, db.Find(&job, jobID).Error)
+	assert.Equal(t, jobs.StateSucceeded, job.State, job.Error)
+	assert.Equal(t, ResultArchiveJob, job.Type)
+	assert.Equal(t, uint(100), job.Progress)
+
+	var jobResult struct {
+		FileID uint `json:"fileID"`
+	}
+	assert.NoError(t, json.Unmarshal(job.Result.RawMessage, &jobResult))
+
+	// the archive was added to the scenario
+	var archive database.File
+	assert.NoError(t, db.Find(&archive, jobResult.FileID).Error)
+	assert.Equal(t, scenarioID, archive.ScenarioID)
+	assert.Equal(t, fmt.Sprintf("result-%d.zip", newResultID), archive.Name)
+	assert.Equal(t, "application/zip", archive.Type)
+}
@@ -0,0 +1,177 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+package scenario_run
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	infrastructure_component "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/infrastructure-component"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+func RegisterScenarioRunEndpoints(r *gin.RouterGroup) {
+	r.POST("/:scenarioID/run", runScenario)
+	r.POST("/:scenarioID/stop", stopScenario)
+}
+
+// runScenario godoc
+// @Summary Start all ICs of a scenario and create a result with snapshots of its component configurations
+// @Description The ICs are started by a job in the order database, service, gateway, other categories and simulator;
+// @Description the ICs of a category are started once the ICs of the previous category are running.
+// @ID runScenario
+// @Tags scenarios
+// @Produce json
+// @Success 200 {object} api.ResponseScenarioRun "Job starting the ICs and result of the run"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 409 {object} api.ResponseError "Conflict, an IC of the scenario is reserved by someone else"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity, e.g. component configurations start the same IC with different parameters"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param scenarioID path int true "Scenario ID"
+// @Router /scenarios/{scenarioID}/run [post]
+// @Security Bearer
+func runScenario(c *gin.Context) {
+
+	so, stages, ok := checkRunPermissions(c)
+	if !ok {
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+
+	err := conflictingStarts(stages)
+	if err != nil {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	}
+
+	for _, stage := range stages {
+		for _, rc := range stage {
+			// the start parameters of all ICs are validated before the first IC is started
+			action := rc.startAction(0)
+			if errs := action.ValidateParameters(rc.ic); len(errs) > 0 {
+				helper.SchemaValidationError(c, fmt.Sprintf("Start parameters of component configuration %v do not match the schema of IC %v",
+					rc.config.Name, rc.ic.Name), errs)
+				return
+			}
+
+			err := infrastructure_component.CheckReservation(userID.(uint), rc.ic, action)
+			if _, ok := err.(*infrastructure_component.ReservationConflict); ok {
+				helper.ConflictError(c, fmt.Sprintf("Cannot start IC %v: %v", rc.ic.Name, err))
+				return
+			} else if helper.DBError(c, err) {
+				return
+			}
+		}
+	}
+
+	snapshots, err := snapshotConfigs(stages)
+	if helper.DBError(c, err) {
+		return
+	}
+
+	result := database.Result{
+		Description:     fmt.Sprintf("Run of scenario %v started at %v", so.Name, time.Now().Format(time.RFC3339)),
+		ScenarioID:      so.ID,
+		ConfigSnapshots: postgres.Jsonb{RawMessage: snapshots},
+	}
+	err = database.GetDB().Create(&result).Error
+	if helper.DBError(c, err) {
+		return
+	}
+	database.Audit(c, database.Create, database.ModelResult, result.ID, result.ScenarioID, nil, result)
+
+	job, err := submitRun(so, userID.(uint), stages, result.ID)
+	if err != nil {
+		// the result of a run which is not started is not kept
+		if delErr := database.GetDB().Delete(&result).Error; delErr != nil {
+			log.Printf("Failed to delete result %v of run which was not started: %v", result.ID, delErr)
+		}
+	}
+	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelJob, job.ID, job.ScenarioID, nil, job)
+		c.JSON(http.StatusOK, gin.H{"job": job, "result": result})
+	}
+}
+
+// stopScenario godoc
+// @Summary Stop all ICs of a scenario in the reverse order in which they are started
+// @Description Jobs which are still starting the ICs of the scenario are cancelled.
+// @ID stopScenario
+// @Tags scenarios
+// @Produce json
+// @Success 200 {object} api.ResponseJob "Job stopping the ICs"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param scenarioID path int true "Scenario ID"
+// @Router /scenarios/{scenarioID}/stop [post]
+// @Security Bearer
+func stopScenario(c *gin.Context) {
+
+	so, stages, ok := checkRunPermissions(c)
+	if !ok {
+		return
+	}
+
+	err := cancelRuns(so)
+	if helper.DBError(c, err) {
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+
+	job, err := submitStop(so, userID.(uint), stages)
+	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelJob, job.ID, job.ScenarioID, nil, job)
+		c.JSON(http.StatusOK, gin.H{"job": job})
+	}
+}
+
+// checkRunPermissions checks if the user may send actions to the ICs of the scenario
+// and returns the scenario and its component configurations grouped by start stage
+func checkRunPermissions(c *gin.Context) (database.Scenario, [][]runConfig, bool) {
+
+	ok, so := database.CheckScenarioPermissions(c, database.Update, "path", -1)
+	if !ok {
+		return so, nil, false
+	}
+
+	err := database.ValidateRole(c, database.ModelInfrastructureComponentAction, database.Update)
+	if err != nil {
+		helper.UnprocessableEntityError(c, fmt.Sprintf("Access denied (role validation of infrastructure component action failed): %v", err.Error()))
+		return so, nil, false
+	}
+
+	stages, err := runConfigs(so)
+	if helper.DBError(c, err) {
+		return so, nil, false
+	}
+	if len(stages) == 0 {
+		helper.UnprocessableEntityError(c, "Scenario has no component configurations with an IC")
+		return so, nil, false
+	}
+
+	return so, stages, true
+}
@@ -0,0 +1,292 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+package scenario_run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
+	infrastructure_component "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/infrastructure-component"
+)
+
+// ScenarioRunJob is the type of the jobs starting all ICs of a scenario
+const ScenarioRunJob = "scenario-run"
+
+// ScenarioStopJob is the type of the jobs stopping all ICs of a scenario
+const ScenarioStopJob = "scenario-stop"
+
+// order in which the ICs of a scenario are started (stopped in reverse order),
+// ICs of the same stage are started at once
+var startStages = map[string]int{
+	"database":  0,
+	"service":   1,
+	"gateway":   2,
+	"equipment": 3,
+	"simulator": 4,
+}
+
+// stage of ICs whose category is not listed in startStages
+const defaultStartStage = 3
+
+// runConfig is a component configuration of a scenario together with its IC
+type runConfig struct {
+	config database.ComponentConfiguration
+	ic     database.InfrastructureComponent
+}
+
+// configSnapshot is the state of a component configuration at the start of a run
+type configSnapshot struct {
+	database.ComponentConfiguration
+	IC            database.InfrastructureComponent `json:"ic"`
+	InputMapping  []database.Signal                `json:"inputMapping"`
+	OutputMapping []database.Signal                `json:"outputMapping"`
+}
+
+// runConfigs returns the component configurations of the scenario which use an IC
+// grouped by the stage in which their ICs are started
+func runConfigs(s database.Scenario) ([][]runConfig, error) {
+	db := database.GetDB()
+	var configs []database.ComponentConfiguration
+	err := db.Order("ID asc").Model(&s).Related(&configs, "ComponentConfigurations").Error
+	if err != nil {
+		return nil, err
+	}
+
+	stages := make(map[int][]runConfig)
+	for _, config := range configs {
+		if config.ICID == 0 {
+			continue
+		}
+
+		var ic database.InfrastructureComponent
+		err = db.Find(&ic, config.ICID).Error
+		if err != nil {
+			return nil, fmt.Errorf("IC %v of component configuration %v: %w", config.ICID, config.ID, err)
+		}
+
+		stage, ok := startStages[ic.Category]
+		if !ok {
+			stage = defaultStartStage
+		}
+		stages[stage] = append(stages[stage], runConfig{config: config, ic: ic})
+	}
+
+	var order []int
+	for stage := range stages {
+		order = append(order, stage)
+	}
+	sort.Ints(order)
+
+	var result [][]runConfig
+	for _, stage := range order {
+		result = append(result, stages[stage])
+	}
+	return result, nil
+}
+
+// snapshotConfigs returns the JSON snapshots of the component configurations which are stored in the result of a run
+func snapshotConfigs(stages [][]runConfig) (json.RawMessage, error) {
+	db := database.GetDB()
+	var snapshots []configSnapshot
+	for _, stage := range stages {
+		for _, rc := range stage {
+			snapshot := configSnapshot{ComponentConfiguration: rc.config, IC: rc.ic}
+			err := db.Order("ID asc").Model(&rc.config).Where("Direction = ?", "in").Related(&snapshot.InputMapping, "InputMapping").Error
+			if err != nil {
+				return nil, err
+			}
+			err = db.Order("ID asc").Model(&rc.config).Where("Direction = ?", "out").Related(&snapshot.OutputMapping, "OutputMapping").Error
+			if err != nil {
+				return nil, err
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	// keep the snapshots in the order of the component configurations
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID < snapshots[j].ID })
+	return json.Marshal(snapshots)
+}
+
+// startAction returns the action starting the IC of the component configuration for the run with the result
+func (rc runConfig) startAction(resultID uint) infrastructure_component.Action {
+	action := infrastructure_component.Action{
+		Act:        "start",
+		When:       time.Now().Unix(),
+		Parameters: rc.config.StartParameters.RawMessage,
+	}
+	if len(rc.config.FileIDs) > 0 {
+		action.Model, _ = json.Marshal(map[string]interface{}{"fileIDs": rc.config.FileIDs})
+	}
+	action.Results, _ = json.Marshal(map[string]interface{}{"resultID": resultID})
+	return action
+}
+
+// conflictingStarts returns an error if component configurations which share an IC would start it
+// with different start parameters or files, since every IC is started only once per run
+func conflictingStarts(stages [][]runConfig) error {
+	first := make(map[uint]runConfig) // key: IC ID
+	for _, stage := range stages {
+		for _, rc := range stage {
+			other, ok := first[rc.ic.ID]
+			if !ok {
+				first[rc.ic.ID] = rc
+				continue
+			}
+
+			a, b := other.startAction(0), rc.startAction(0)
+			if !sameJSON(a.Parameters, b.Parameters) || !sameJSON(a.Model, b.Model) {
+				return fmt.Errorf("component configurations %v and %v start IC %v with different start parameters or files",
+					other.config.Name, rc.config.Name, rc.ic.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// sameJSON reports whether two JSON documents have the same content; empty documents equal null
+func sameJSON(a json.RawMessage, b json.RawMessage) bool {
+	var va, vb interface{}
+	if len(a) > 0 && json.Unmarshal(a, &va) != nil {
+		return false
+	}
+	if len(b) > 0 && json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// submitRun starts the ICs of the scenario stage by stage as a job;
+// each stage is started once the ICs of the previous stage are running.
+// The result of the run is marked as failed if the ICs cannot be started.
+func submitRun(s database.Scenario, userID uint, stages [][]runConfig, resultID uint) (database.Job, error) {
+	return jobs.Submit(ScenarioRunJob, userID, s.ID, func(ctx context.Context, j *jobs.Job) error {
+		err := runStages(ctx, j, userID, stages, resultID)
+		if err != nil {
+			markResultFailed(resultID, err)
+			return err
+		}
+
+		return j.SetResult(map[string]interface{}{"resultID": resultID})
+	})
+}
+
+// runStages starts the ICs of the stages one stage after the other,
+// ICs which are used by several component configurations are started once
+func runStages(ctx context.Context, j *jobs.Job, userID uint, stages [][]runConfig, resultID uint) error {
+	started := make(map[uint]bool) // key: IC ID
+	for i, stage := range stages {
+		j.SetProgress(uint(100*i/len(stages)), fmt.Sprintf("starting %d ICs of stage %d", len(stage), i+1))
+
+		// the ICs may have been reserved by someone else while the previous stages were started
+		for _, rc := range stage {
+			err := infrastructure_component.CheckReservation(userID, rc.ic, rc.startAction(resultID))
+			if err != nil {
+				return fmt.Errorf("cannot start IC %v: %w", rc.ic.Name, err)
+			}
+		}
+
+		var sent []database.ICAction
+		for _, rc := range stage {
+			if started[rc.ic.ID] {
+				continue
+			}
+			started[rc.ic.ID] = true
+
+			tracked, err := infrastructure_component.SendAction(userID, rc.ic, rc.startAction(resultID))
+			if err != nil {
+				return err
+			}
+			sent = append(sent, tracked)
+		}
+
+		err := infrastructure_component.WaitForActions(ctx, sent,
+			[]string{infrastructure_component.ActionRunning, infrastructure_component.ActionCompleted})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markResultFailed adds the error of a run which failed to the description of its result
+func markResultFailed(resultID uint, runErr error) {
+	db := database.GetDB()
+	var result database.Result
+	err := db.Find(&result, resultID).Error
+	if err == nil {
+		err = db.Model(&result).Update("Description", fmt.Sprintf("%v (failed: %v)", result.Description, runErr)).Error
+	}
+	if err != nil {
+		log.Printf("Failed to mark result %v of failed run: %v", resultID, err)
+	}
+}
+
+// submitStop stops the ICs of the scenario as a job in the reverse order in which they were started
+func submitStop(s database.Scenario, userID uint, stages [][]runConfig) (database.Job, error) {
+	return jobs.Submit(ScenarioStopJob, userID, s.ID, func(ctx context.Context, j *jobs.Job) error {
+		stopped := make(map[uint]bool) // key: IC ID
+		for i := len(stages) - 1; i >= 0; i-- {
+			j.SetProgress(uint(100*(len(stages)-1-i)/len(stages)), fmt.Sprintf("stopping ICs of stage %d", i+1))
+
+			var sent []database.ICAction
+			for _, rc := range stages[i] {
+				if stopped[rc.ic.ID] {
+					continue
+				}
+				stopped[rc.ic.ID] = true
+
+				action := infrastructure_component.Action{Act: "stop", When: time.Now().Unix()}
+				tracked, err := infrastructure_component.SendAction(userID, rc.ic, action)
+				if err != nil {
+					return err
+				}
+				sent = append(sent, tracked)
+			}
+
+			err := infrastructure_component.WaitForActions(ctx, sent, []string{infrastructure_component.ActionCompleted})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// cancelRuns cancels the pending and running jobs starting the ICs of the scenario
+func cancelRuns(s database.Scenario) error {
+	var runs []database.Job
+	err := database.GetDB().Where("type = ? AND scenario_id = ? AND state IN (?)",
+		ScenarioRunJob, s.ID, []string{jobs.StatePending, jobs.StateRunning}).Find(&runs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		// the job may have finished in the meantime
+		_ = jobs.Cancel(run.ID)
+	}
+	return nil
+}
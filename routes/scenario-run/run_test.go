@@ -0,0 +1,442 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+package scenario_run
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
+	component_configuration "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/component-configuration"
+	infrastructure_component "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/infrastructure-component"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/signal"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/stretchr/testify/assert"
+)
+
+var router *gin.Engine
+var session *helper.AMQPsession
+
+var waitingTime time.Duration = 1
+
+type ICRequest struct {
+	UUID              string `json:"uuid,omitempty"`
+	Type              string `json:"type,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Category          string `json:"category,omitempty"`
+	State             string `json:"state,omitempty"`
+	Manager           string `json:"manager,omitempty"`
+	ManagedExternally *bool  `json:"managedexternally"`
+}
+
+type ConfigRequest struct {
+	Name            string         `json:"name,omitempty"`
+	ScenarioID      uint           `json:"scenarioID,omitempty"`
+	ICID            uint           `json:"icID,omitempty"`
+	StartParameters postgres.Jsonb `json:"startParameters,omitempty"`
+	FileIDs         []int64        `json:"fileIDs"`
+}
+
+var newGateway = ICRequest{
+	UUID:              "0ad2dc50-9b33-4f36-b6f0-4d1e0cfd43c1",
+	Type:              "villas-node",
+	Name:              "Gateway of run",
+	Category:          "gateway",
+	State:             "idle",
+	Manager:           "3c0f1a9e-8b71-4f1b-a1c4-6d2f3d0e5b21",
+	ManagedExternally: newFalse(),
+}
+
+var newSimulator = ICRequest{
+	UUID:              "5f8c7a4e-1b2d-4c3e-9f6a-7b8c9d0e1f2a",
+	Type:              "dpsim",
+	Name:              "Simulator of run",
+	Category:          "simulator",
+	State:             "idle",
+	Manager:           "3c0f1a9e-8b71-4f1b-a1c4-6d2f3d0e5b21",
+	ManagedExternally: newFalse(),
+}
+
+func TestMain(m *testing.M) {
+	err := configuration.InitConfig()
+	if err != nil {
+		panic(m)
+	}
+
+	err = database.InitDB(configuration.GlobalConfig, true)
+	if err != nil {
+		panic(m)
+	}
+	defer database.DBpool.Close()
+
+	router = gin.Default()
+	api := router.Group("/api/v2")
+
+	user.RegisterAuthenticate(api.Group("/authenticate"))
+	api.Use(user.Authentication())
+
+	scenario.RegisterScenarioEndpoints(api.Group("/scenarios"))
+	RegisterScenarioRunEndpoints(api.Group("/scenarios"))
+	component_configuration.RegisterComponentConfigurationEndpoints(api.Group("/configs"))
+	signal.RegisterSignalEndpoints(api.Group("/signals"))
+	infrastructure_component.RegisterICEndpoints(api.Group("/ic"))
+
+	// connect AMQP client
+	// Make sure that AMQP_HOST, AMQP_USER, AMQP_PASS are set
+	host, _ := configuration.GlobalConfig.String("amqp.host")
+	usr, _ := configuration.GlobalConfig.String("amqp.user")
+	pass, _ := configuration.GlobalConfig.String("amqp.pass")
+	amqpURI := "amqp://" + usr + ":" + pass + "@" + host
+
+	session = helper.NewAMQPSession("villas-test-session", amqpURI, "villas", infrastructure_component.ProcessMessage)
+	infrastructure_component.SetAMQPSession(session)
+
+	os.Exit(m.Run())
+}
+
+func TestRunAndStopScenario(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin user to add the ICs
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	var icIDs []uint
+	for _, ic := range []ICRequest{newSimulator, newGateway} {
+		code, resp, err := helper.TestEndpoint(router, token,
+			"/api/v2/ic", "POST", helper.KeyModels{"ic": ic})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+		icID, err := helper.GetResponseID(resp)
+		assert.NoError(t, err)
+		icIDs = append(icIDs, uint(icID))
+	}
+
+	// authenticate as normal user
+	token, err = helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": map[string]string{"name": "Scenario to run"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	scenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// try to run a scenario without component configurations
+	// should result in unprocessable entity
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/run", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// add a component configuration for each IC, the simulator is added first
+	for i, icID := range icIDs {
+		config := ConfigRequest{
+			Name:            fmt.Sprintf("Config %d", i),
+			ScenarioID:      uint(scenarioID),
+			ICID:            icID,
+			StartParameters: postgres.Jsonb{RawMessage: json.RawMessage(fmt.Sprintf(`{"config": %d}`, i))},
+			FileIDs:         []int64{},
+		}
+		code, resp, err = helper.TestEndpoint(router, token,
+			"/api/v2/configs", "POST", helper.KeyModels{"config": config})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	}
+
+	// try to run the scenario as user B who has no access to it
+	// should result in unprocessable entity
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v/run", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// run the scenario
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/run", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	var run struct {
+		Job    database.Job    `json:"job"`
+		Result database.Result `json:"result"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &run))
+	assert.Equal(t, ScenarioRunJob, run.Job.Type)
+	assert.Equal(t, uint(scenarioID), run.Result.ScenarioID)
+
+	var snapshots []configSnapshot
+	assert.NoError(t, json.Unmarshal(run.Result.ConfigSnapshots.RawMessage, &snapshots))
+	assert.Equal(t, 2, len(snapshots))
+	assert.Equal(t, "Config 0", snapshots[0].Name)
+	assert.Equal(t, newSimulator.UUID, snapshots[0].IC.UUID)
+	assert.Equal(t, newGateway.UUID, snapshots[1].IC.UUID)
+
+	// the gateway is started first, the simulator once the gateway is running
+	time.Sleep(waitingTime * time.Second)
+	assertActions(t, icIDs[0], 0)
+	assertActions(t, icIDs[1], 1)
+
+	sendStatus(t, newGateway, "running")
+	time.Sleep(2 * waitingTime * time.Second)
+	assertActions(t, icIDs[0], 1)
+
+	sendStatus(t, newSimulator, "running")
+	jobs.Wait()
+
+	var job database.Job
+	assert.NoError(t, database.GetDB().Find(&job, run.Job.ID).Error)
+	assert.Equal(t, jobs.StateSucceeded, job.State)
+
+	// stop the scenario, the simulator is stopped first
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/stop", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	stopID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	time.Sleep(waitingTime * time.Second)
+	assertActions(t, icIDs[0], 2)
+	assertActions(t, icIDs[1], 1)
+
+	sendStatus(t, newSimulator, "stopped")
+	time.Sleep(2 * waitingTime * time.Second)
+	assertActions(t, icIDs[1], 2)
+
+	sendStatus(t, newGateway, "stopped")
+	jobs.Wait()
+
+	assert.NoError(t, database.GetDB().Find(&job, stopID).Error)
+	assert.Equal(t, ScenarioStopJob, job.Type)
+	assert.Equal(t, jobs.StateSucceeded, job.State)
+}
+
+func TestRunScenarioFailures(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin user to add the ICs
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	var icIDs []uint
+	for _, ic := range []ICRequest{newSimulator, newGateway} {
+		code, resp, err := helper.TestEndpoint(router, token,
+			"/api/v2/ic", "POST", helper.KeyModels{"ic": ic})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+		icID, err := helper.GetResponseID(resp)
+		assert.NoError(t, err)
+		icIDs = append(icIDs, uint(icID))
+	}
+
+	// authenticate as normal user
+	token, err = helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": map[string]string{"name": "Scenario to run"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	scenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	for i, icID := range icIDs {
+		config := ConfigRequest{
+			Name:            fmt.Sprintf("Config %d", i),
+			ScenarioID:      uint(scenarioID),
+			ICID:            icID,
+			StartParameters: postgres.Jsonb{RawMessage: json.RawMessage(fmt.Sprintf(`{"config": %d}`, i))},
+			FileIDs:         []int64{},
+		}
+		code, resp, err = helper.TestEndpoint(router, token,
+			"/api/v2/configs", "POST", helper.KeyModels{"config": config})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	}
+
+	// try to run the scenario while the start parameters of the simulator do not match its schema
+	// should result in unprocessable entity, no IC is started and no result is created
+	db := database.GetDB()
+	err = db.Exec("UPDATE infrastructure_components SET start_parameter_schema = ? WHERE id = ?",
+		`{"type": "object", "required": ["duration"]}`, icIDs[0]).Error
+	assert.NoError(t, err)
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/run", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+	assertActions(t, icIDs[1], 0)
+	var results int
+	assert.NoError(t, db.Model(&database.Result{}).Count(&results).Error)
+	assert.Equal(t, 0, results)
+	assert.NoError(t, db.Exec("UPDATE infrastructure_components SET start_parameter_schema = NULL").Error)
+
+	// run the scenario, the gateway is started first
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/run", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	var run struct {
+		Job    database.Job    `json:"job"`
+		Result database.Result `json:"result"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &run))
+
+	time.Sleep(waitingTime * time.Second)
+	assertActions(t, icIDs[1], 1)
+
+	// user B reserves the simulator before the gateway is running
+	now := time.Now()
+	reservation := database.Reservation{ICID: icIDs[0], UserID: 3, Start: now.Add(-time.Hour), End: now.Add(time.Hour)}
+	assert.NoError(t, db.Create(&reservation).Error)
+
+	// the simulator is not started, the run and its result are marked as failed
+	sendStatus(t, newGateway, "running")
+	jobs.Wait()
+	assertActions(t, icIDs[0], 0)
+
+	var job database.Job
+	assert.NoError(t, db.Find(&job, run.Job.ID).Error)
+	assert.Equal(t, jobs.StateFailed, job.State)
+
+	var result database.Result
+	assert.NoError(t, db.Find(&result, run.Result.ID).Error)
+	assert.Contains(t, result.Description, "failed")
+}
+
+func TestRunScenarioSharedIC(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin user to add the IC
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newGateway})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	icID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// authenticate as normal user
+	token, err = helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": map[string]string{"name": "Scenario to run"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	scenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// add two component configurations of the same IC with different start parameters
+	var configIDs []int
+	for i := 0; i < 2; i++ {
+		config := ConfigRequest{
+			Name:            fmt.Sprintf("Config %d", i),
+			ScenarioID:      uint(scenarioID),
+			ICID:            uint(icID),
+			StartParameters: postgres.Jsonb{RawMessage: json.RawMessage(fmt.Sprintf(`{"config": %d}`, i))},
+			FileIDs:         []int64{},
+		}
+		code, resp, err = helper.TestEndpoint(router, token,
+			"/api/v2/configs", "POST", helper.KeyModels{"config": config})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+		configID, err := helper.GetResponseID(resp)
+		assert.NoError(t, err)
+		configIDs = append(configIDs, configID)
+	}
+
+	// try to run the scenario which starts the IC with different start parameters
+	// should result in unprocessable entity
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/run", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+	assertActions(t, uint(icID), 0)
+
+	// the IC is started once if the component configurations start it in the same way
+	err = database.GetDB().Exec("UPDATE component_configurations SET start_parameters = ? WHERE id = ?",
+		`{"config":  0}`, configIDs[1]).Error
+	assert.NoError(t, err)
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/run", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	var run struct {
+		Job database.Job `json:"job"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &run))
+
+	time.Sleep(waitingTime * time.Second)
+	sendStatus(t, newGateway, "running")
+	jobs.Wait()
+	assertActions(t, uint(icID), 1)
+
+	var job database.Job
+	assert.NoError(t, database.GetDB().Find(&job, run.Job.ID).Error)
+	assert.Equal(t, jobs.StateSucceeded, job.State)
+}
+
+// assertActions checks the number of actions sent to an IC
+func assertActions(t *testing.T, icID uint, expected int) {
+	var count int
+	err := database.GetDB().Model(&database.ICAction{}).Where("ic_id = ?", icID).Count(&count).Error
+	assert.NoError(t, err)
+	assert.Equal(t, expected, count)
+}
+
+// sendStatus fakes a status update of an IC
+func sendStatus(t *testing.T, ic ICRequest, state string) {
+	var update infrastructure_component.ICUpdate
+	update.Properties.UUID = ic.UUID
+	update.Properties.Name = ic.Name
+	update.Properties.Category = ic.Category
+	update.Properties.Type = ic.Type
+	update.Status.ManagedBy = ic.Manager
+	update.Status.State = state
+
+	payload, err := json.Marshal(update)
+	assert.NoError(t, err)
+
+	err = session.Send(payload, ic.Manager)
+	assert.NoError(t, err)
+}
+
+func newFalse() *bool {
+	b := false
+	return &b
+}
@@ -0,0 +1,195 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package scenario_transfer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterScenarioTransferEndpoints(r *gin.RouterGroup) {
+	r.GET("/:scenarioID/export", exportScenario)
+	r.POST("/import", importScenario)
+	r.POST("/:scenarioID/clone", cloneScenario)
+}
+
+// exportScenario godoc
+// @Summary Export a scenario including all its component configurations, signals, dashboards, widgets, files and results
+// @ID exportScenario
+// @Produce json
+// @Tags scenarios
+// @Success 200 {object} scenario_transfer.ScenarioArchive "Archive of the scenario"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param scenarioID path int true "Scenario ID"
+// @Router /scenarios/{scenarioID}/export [get]
+// @Security Bearer
+func exportScenario(c *gin.Context) {
+
+	ok, so := database.CheckScenarioPermissions(c, database.Read, "path", -1)
+	if !ok {
+		return
+	}
+
+	archive, err := newArchive(so)
+	if helper.DBError(c, err) {
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=scenario-%d.json", so.ID))
+	c.JSON(http.StatusOK, archive)
+}
+
+// importScenario godoc
+// @Summary Import a scenario from an archive created by the export endpoint
+// @ID importScenario
+// @Accept json
+// @Produce json
+// @Tags scenarios
+// @Success 200 {object} api.ResponseScenario "Scenario that was imported"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param inputArchive body scenario_transfer.ScenarioArchive true "Archive of the scenario to be imported"
+// @Router /scenarios/import [post]
+// @Security Bearer
+func importScenario(c *gin.Context) {
+
+	ok, _ := database.CheckScenarioPermissions(c, database.Create, "none", -1)
+	if !ok {
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+	db := database.GetDB()
+	var u database.User
+	err := db.Find(&u, userID.(uint)).Error
+	if helper.DBNotFoundError(c, err, strconv.FormatUint(uint64(userID.(uint)), 10), "User") {
+		return
+	}
+
+	var archive ScenarioArchive
+	if err := c.ShouldBindJSON(&archive); err != nil {
+		helper.BadRequestError(c, err.Error())
+		return
+	}
+
+	// Validate the archive
+	if err = archive.validate(); err != nil {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	}
+
+	so, err := archive.restore(&u)
+	if _, ok := err.(*UnknownICs); ok {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	} else if helper.DBError(c, err) {
+		return
+	}
+
+	database.Audit(c, database.Create, database.ModelScenario, so.ID, so.ID, nil, so)
+	c.JSON(http.StatusOK, gin.H{"scenario": so})
+}
+
+// cloneScenario godoc
+// @Summary Clone a scenario including all its component configurations, signals, dashboards, widgets and files
+// @ID cloneScenario
+// @Accept json
+// @Produce json
+// @Tags scenarios
+// @Success 200 {object} api.ResponseScenario "Clone of the scenario"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param scenarioID path int true "ID of the scenario to be cloned"
+// @Param inputClone body scenario_transfer.cloneScenarioRequest true "Name, optional owner and optional IC mapping of the clone"
+// @Router /scenarios/{scenarioID}/clone [post]
+// @Security Bearer
+func cloneScenario(c *gin.Context) {
+
+	ok, so := database.CheckScenarioPermissions(c, database.Read, "path", -1)
+	if !ok {
+		return
+	}
+
+	// the clone is a new scenario, the user must be allowed to create one
+	err := database.ValidateRole(c, database.ModelScenario, database.Create)
+	if err != nil {
+		helper.UnprocessableEntityError(c, fmt.Sprintf("Access denied (role validation of scenario failed): %v", err))
+		return
+	}
+
+	var req cloneScenarioRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.BadRequestError(c, err.Error())
+		return
+	}
+
+	// Validate the request
+	if err = req.validate(); err != nil {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+	userRole, _ := c.Get(database.UserRoleCtx)
+
+	ownerID := userID.(uint)
+	if req.Clone.OwnerID != 0 && req.Clone.OwnerID != ownerID {
+		if userRole != "Admin" {
+			helper.UnprocessableEntityError(c, "Access denied (only admins can clone a scenario for another user)")
+			return
+		}
+		ownerID = req.Clone.OwnerID
+	}
+
+	db := database.GetDB()
+	var owner database.User
+	err = db.Find(&owner, ownerID).Error
+	if helper.DBNotFoundError(c, err, strconv.FormatUint(uint64(ownerID), 10), "User") {
+		return
+	}
+
+	icIds, err := cloneICMapping(so, req.Clone.ICMapping)
+	if _, ok := err.(*UnknownICs); ok {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	} else if helper.DBError(c, err) {
+		return
+	}
+
+	clone, err := user.CloneScenario(so, req.Clone.Name, &owner, icIds)
+	if helper.DBError(c, err) {
+		return
+	}
+
+	database.Audit(c, database.Create, database.ModelScenario, clone.ID, clone.ID, nil, clone)
+	c.JSON(http.StatusOK, gin.H{"scenario": clone})
+}
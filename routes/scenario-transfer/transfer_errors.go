@@ -0,0 +1,32 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package scenario_transfer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnknownICs is returned if ICs (identified by UUID or ID) are not found in the DB
+type UnknownICs struct {
+	ICs []string
+}
+
+func (e *UnknownICs) Error() string {
+	return fmt.Sprintf("ICs unknown to this backend: %s", strings.Join(e.ICs, ", "))
+}
@@ -0,0 +1,408 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package scenario_transfer
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/file"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// ArchiveVersion is the version of the archive format written by the export
+const ArchiveVersion = 1
+
+// ScenarioArchive is a self-contained representation of a scenario and all its children.
+// The IDs contained in the archive are the IDs of the exporting backend instance,
+// they are remapped to new IDs when the archive is imported.
+type ScenarioArchive struct {
+	// Version of the archive format
+	Version int `json:"version"`
+	// Time of the export
+	ExportedAt time.Time `json:"exportedAt"`
+	// The exported scenario
+	Scenario database.Scenario `json:"scenario"`
+	// ICs used by the component configurations of the scenario (matched by UUID on import)
+	ICs []archiveIC `json:"ics"`
+	// Component configurations of the scenario including their signals
+	Configs []archiveConfig `json:"configs"`
+	// Dashboards of the scenario including their widgets
+	Dashboards []archiveDashboard `json:"dashboards"`
+	// Files of the scenario including their data
+	Files []archiveFile `json:"files"`
+	// Results of the scenario
+	Results []database.Result `json:"results"`
+}
+
+type archiveIC struct {
+	ID       uint   `json:"id"`
+	UUID     string `json:"uuid"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Type     string `json:"type"`
+}
+
+type archiveConfig struct {
+	database.ComponentConfiguration
+	Signals []database.Signal `json:"signals"`
+}
+
+type archiveDashboard struct {
+	database.Dashboard
+	Widgets []database.Widget `json:"widgets"`
+}
+
+type archiveFile struct {
+	database.File
+	Data []byte `json:"data"`
+}
+
+func newArchive(so database.Scenario) (ScenarioArchive, error) {
+
+	db := database.GetDB()
+
+	archive := ScenarioArchive{
+		Version:    ArchiveVersion,
+		ExportedAt: time.Now(),
+		Scenario:   so,
+		ICs:        []archiveIC{},
+		Configs:    []archiveConfig{},
+		Dashboards: []archiveDashboard{},
+		Files:      []archiveFile{},
+		Results:    []database.Result{},
+	}
+
+	// component configurations, their signals and ICs
+	var configs []database.ComponentConfiguration
+	err := db.Order("ID asc").Model(&so).Related(&configs, "ComponentConfigurations").Error
+	if err != nil {
+		return archive, err
+	}
+
+	exportedICs := make(map[uint]bool)
+	for _, config := range configs {
+		var signals []database.Signal
+		err = db.Order("ID asc").Model(&config).Related(&signals, "OutputMapping").Error
+		if err != nil {
+			return archive, err
+		}
+		archive.Configs = append(archive.Configs, archiveConfig{ComponentConfiguration: config, Signals: signals})
+
+		if config.ICID == 0 || exportedICs[config.ICID] {
+			// config is not associated with an IC or the IC is exported already
+			continue
+		}
+		exportedICs[config.ICID] = true
+
+		var ic database.InfrastructureComponent
+		err = db.Find(&ic, config.ICID).Error
+		if err == gorm.ErrRecordNotFound {
+			// config is not associated with an IC
+			continue
+		} else if err != nil {
+			return archive, err
+		}
+
+		archive.ICs = append(archive.ICs, archiveIC{
+			ID:       ic.ID,
+			UUID:     ic.UUID,
+			Name:     ic.Name,
+			Category: ic.Category,
+			Type:     ic.Type,
+		})
+	}
+
+	// dashboards and their widgets
+	var dashboards []database.Dashboard
+	err = db.Order("ID asc").Model(&so).Related(&dashboards, "Dashboards").Error
+	if err != nil {
+		return archive, err
+	}
+
+	for _, dab := range dashboards {
+		var widgets []database.Widget
+		err = db.Order("ID asc").Model(&dab).Related(&widgets, "Widgets").Error
+		if err != nil {
+			return archive, err
+		}
+		archive.Dashboards = append(archive.Dashboards, archiveDashboard{Dashboard: dab, Widgets: widgets})
+	}
+
+	// files including their data (stored in DB or S3)
+	var files []database.File
+	err = db.Order("ID asc").Model(&so).Related(&files, "Files").Error
+	if err != nil {
+		return archive, err
+	}
+
+	for _, f := range files {
+		var exportedFile file.File
+		exportedFile.File = f
+		data, err := exportedFile.Content()
+		if err != nil {
+			return archive, err
+		}
+		archive.Files = append(archive.Files, archiveFile{File: f, Data: data})
+	}
+
+	// results
+	err = db.Order("ID asc").Model(&so).Related(&archive.Results, "Results").Error
+
+	return archive, err
+}
+
+// restore creates a new scenario from the archive which is owned by the given user, the scenario
+// is created in one transaction; the data of the files is deleted if the scenario cannot be created
+func (a *ScenarioArchive) restore(u *database.User) (database.Scenario, error) {
+
+	// map the archived ICs to the ICs of this backend instance by their UUID
+	icIds, err := a.icMapping()
+	if err != nil {
+		return database.Scenario{}, err
+	}
+
+	ctx := context.Background()
+	var so database.Scenario
+	var files []file.File
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		so, err = a.create(ctx, tx, u, icIds, &files)
+		return err
+	})
+	if err != nil {
+		// the stored data of the files is not referenced by any file
+		for _, f := range files {
+			delErr := f.DeleteData(ctx)
+			if delErr != nil {
+				log.Printf("Failed to delete the data of imported file %v: %v", f.Name, delErr)
+			}
+		}
+		return database.Scenario{}, err
+	}
+
+	return so, nil
+}
+
+// icMapping maps the IDs of the archived ICs to the IDs of the ICs of this backend instance with the same UUID
+func (a *ScenarioArchive) icMapping() (map[uint]uint, error) {
+	db := database.GetDB()
+
+	icIds := make(map[uint]uint) // key: archived IC id, value: local IC id
+	var unknownUUIDs []string
+	for _, aic := range a.ICs {
+		var ic database.InfrastructureComponent
+		err := db.Find(&ic, "UUID = ?", aic.UUID).Error
+		if err == gorm.ErrRecordNotFound {
+			unknownUUIDs = append(unknownUUIDs, aic.UUID)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		icIds[aic.ID] = ic.ID
+	}
+
+	if len(unknownUUIDs) > 0 {
+		return nil, &UnknownICs{ICs: unknownUUIDs}
+	}
+
+	return icIds, nil
+}
+
+// create creates the scenario of the archive and all its children in the transaction tx,
+// the files whose data is stored are added to files
+func (a *ScenarioArchive) create(ctx context.Context, tx *gorm.DB, u *database.User, icIds map[uint]uint,
+	files *[]file.File) (database.Scenario, error) {
+
+	var so database.Scenario
+	so.Name = a.Scenario.Name
+	so.StartParameters = a.Scenario.StartParameters
+
+	err := tx.Create(&so).Error
+	if err != nil {
+		return so, err
+	}
+
+	err = tx.Model(&so).Association("Users").Append(u).Error
+	if err != nil {
+		return so, err
+	}
+
+	fileIDmap := make(map[uint]uint) // key: archived file id, value: new file id
+	for _, af := range a.Files {
+		var f file.File
+		f.Name = af.Name
+		f.Type = af.Type
+		f.Date = af.Date
+		f.ScenarioID = so.ID
+
+		err = f.StoreData(ctx, bytes.NewReader(af.Data))
+		if err != nil {
+			return so, err
+		}
+		*files = append(*files, f)
+
+		err = tx.Create(&f.File).Error
+		if err != nil {
+			return so, err
+		}
+		fileIDmap[af.ID] = f.ID
+	}
+
+	configIDmap := make(map[uint]uint) // key: archived config id, value: new config id
+	signalIDmap := make(map[uint]uint) // key: archived signal id, value: new signal id
+	for _, ac := range a.Configs {
+		m := ac.ComponentConfiguration
+		m.Model = database.Model{}
+		m.ScenarioID = so.ID
+		m.ICID = icIds[ac.ICID]
+		m.FileIDs = remapIDs(ac.FileIDs, fileIDmap)
+
+		err = tx.Create(&m).Error
+		if err != nil {
+			return so, err
+		}
+		configIDmap[ac.ID] = m.ID
+
+		for _, as := range ac.Signals {
+			sig := as
+			sig.Model = database.Model{}
+			sig.ConfigID = m.ID
+
+			err = tx.Create(&sig).Error
+			if err != nil {
+				return so, err
+			}
+			signalIDmap[as.ID] = sig.ID
+		}
+	}
+
+	for _, ad := range a.Dashboards {
+		dab := ad.Dashboard
+		dab.Model = database.Model{}
+		dab.ScenarioID = so.ID
+
+		err = tx.Create(&dab).Error
+		if err != nil {
+			return so, err
+		}
+
+		for _, aw := range ad.Widgets {
+			w := aw
+			w.Model = database.Model{}
+			w.DashboardID = dab.ID
+			w.SignalIDs = remapIDs(aw.SignalIDs, signalIDmap)
+			w.CustomProperties = user.DuplicateCustomProperties(aw, configIDmap, fileIDmap, icIds)
+
+			err = tx.Create(&w).Error
+			if err != nil {
+				return so, err
+			}
+		}
+	}
+
+	for _, ar := range a.Results {
+		r := ar
+		r.Model = database.Model{}
+		r.ScenarioID = so.ID
+		r.ResultFileIDs = remapIDs(ar.ResultFileIDs, fileIDmap)
+
+		err = tx.Create(&r).Error
+		if err != nil {
+			return so, err
+		}
+	}
+
+	return so, nil
+}
+
+// remapIDs replaces the IDs of a list by the IDs found in idmap, IDs without a mapping are dropped
+func remapIDs(ids pq.Int64Array, idmap map[uint]uint) pq.Int64Array {
+	remapped := pq.Int64Array{}
+	for _, id := range ids {
+		if newID, ok := idmap[uint(id)]; ok {
+			remapped = append(remapped, int64(newID))
+		}
+	}
+	return remapped
+}
+
+// cloneICMapping returns the IC mapping used for cloning the scenario so: ICs of the
+// component configurations are kept unless they are remapped by icMapping
+func cloneICMapping(so database.Scenario, icMapping map[uint]uint) (map[uint]uint, error) {
+	db := database.GetDB()
+
+	var configs []database.ComponentConfiguration
+	err := db.Order("ID asc").Model(&so).Related(&configs, "ComponentConfigurations").Error
+	if err != nil {
+		return nil, err
+	}
+
+	icIds := make(map[uint]uint) // key: original IC id, value: IC id used by the clone
+	for _, config := range configs {
+		icIds[config.ICID] = config.ICID
+	}
+
+	var unknown []string
+	for origID, newID := range icMapping {
+		var ic database.InfrastructureComponent
+		err = db.Find(&ic, newID).Error
+		if err == gorm.ErrRecordNotFound {
+			unknown = append(unknown, strconv.FormatUint(uint64(newID), 10))
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		icIds[origID] = ic.ID
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, &UnknownICs{ICs: unknown}
+	}
+
+	return icIds, nil
+}
+
+// ExportScenario creates an archive of the scenario with the given ID
+func ExportScenario(scenarioID uint) (ScenarioArchive, error) {
+	var so database.Scenario
+	err := database.GetDB().Find(&so, scenarioID).Error
+	if err != nil {
+		return ScenarioArchive{}, err
+	}
+
+	return newArchive(so)
+}
+
+// ImportScenario validates the archive and creates a new scenario from it which is owned by the given user
+func ImportScenario(archive ScenarioArchive, u *database.User) (database.Scenario, error) {
+	err := archive.validate()
+	if err != nil {
+		return database.Scenario{}, err
+	}
+
+	return archive.restore(u)
+}
@@ -0,0 +1,762 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package scenario_transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	component_configuration "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/component-configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/dashboard"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/file"
+	infrastructure_component "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/infrastructure-component"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/result"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/signal"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/widget"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/stretchr/testify/assert"
+)
+
+var router *gin.Engine
+
+type ScenarioRequest struct {
+	Name            string         `json:"name,omitempty"`
+	StartParameters postgres.Jsonb `json:"startParameters,omitempty"`
+}
+
+type ICRequest struct {
+	UUID              string `json:"uuid,omitempty"`
+	Type              string `json:"type,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Category          string `json:"category,omitempty"`
+	State             string `json:"state,omitempty"`
+	ManagedExternally *bool  `json:"managedexternally"`
+}
+
+type ConfigRequest struct {
+	Name            string         `json:"name,omitempty"`
+	ScenarioID      uint           `json:"scenarioID,omitempty"`
+	ICID            uint           `json:"icID,omitempty"`
+	StartParameters postgres.Jsonb `json:"startParameters,omitempty"`
+	FileIDs         []int64        `json:"fileIDs"`
+}
+
+type SignalRequest struct {
+	Name      string `json:"name,omitempty"`
+	Unit      string `json:"unit,omitempty"`
+	Index     *uint  `json:"index,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	ConfigID  uint   `json:"configID,omitempty"`
+}
+
+type DashboardRequest struct {
+	Name       string `json:"name,omitempty"`
+	Grid       int    `json:"grid,omitempty"`
+	ScenarioID uint   `json:"scenarioID,omitempty"`
+}
+
+type WidgetRequest struct {
+	Name             string         `json:"name,omitempty"`
+	Type             string         `json:"type,omitempty"`
+	Width            uint           `json:"width,omitempty"`
+	Height           uint           `json:"height,omitempty"`
+	MinWidth         uint           `json:"minWidth,omitempty"`
+	MinHeight        uint           `json:"minHeight,omitempty"`
+	DashboardID      uint           `json:"dashboardID,omitempty"`
+	CustomProperties postgres.Jsonb `json:"customProperties,omitempty"`
+	SignalIDs        []int64        `json:"signalIDs"`
+}
+
+type ResultRequest struct {
+	Description     string         `json:"description,omitempty"`
+	ScenarioID      uint           `json:"scenarioID,omitempty"`
+	ConfigSnapshots postgres.Jsonb `json:"configSnapshots,omitempty"`
+}
+
+var newScenario = ScenarioRequest{
+	Name:            "Scenario to export",
+	StartParameters: postgres.Jsonb{RawMessage: json.RawMessage(`{"parameter1" : "testValue1A"}`)},
+}
+
+var newIC = ICRequest{
+	UUID:              "7be0322d-354e-431e-84bd-ae4c9633138b",
+	Type:              "villas-node",
+	Name:              "ACS Demo Signals",
+	Category:          "gateway",
+	State:             "idle",
+	ManagedExternally: newFalse(),
+}
+
+func TestMain(m *testing.M) {
+	err := configuration.InitConfig()
+	if err != nil {
+		panic(m)
+	}
+
+	err = database.InitDB(configuration.GlobalConfig, true)
+	if err != nil {
+		panic(m)
+	}
+	defer database.DBpool.Close()
+
+	router = gin.Default()
+	api := router.Group("/api/v2")
+
+	user.RegisterAuthenticate(api.Group("/authenticate"))
+	api.Use(user.Authentication())
+
+	scenario.RegisterScenarioEndpoints(api.Group("/scenarios"))
+	RegisterScenarioTransferEndpoints(api.Group("/scenarios"))
+	file.RegisterFileEndpoints(api.Group("/files"))
+	component_configuration.RegisterComponentConfigurationEndpoints(api.Group("/configs"))
+	signal.RegisterSignalEndpoints(api.Group("/signals"))
+	dashboard.RegisterDashboardEndpoints(api.Group("/dashboards"))
+	widget.RegisterWidgetEndpoints(api.Group("/widgets"))
+	result.RegisterResultEndpoints(api.Group("/results"))
+	infrastructure_component.RegisterICEndpoints(api.Group("/ic"))
+
+	os.Exit(m.Run())
+}
+
+func TestExportImportScenario(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin user to add an IC
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	icID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// authenticate as normal user
+	token, err = helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	scenarioID := addScenarioTree(t, token, icID)
+
+	// authenticate as user B who has no access to the scenario
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+
+	// try to export the scenario as user B
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v/export", scenarioID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// export the scenario as user A
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/export", scenarioID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	var archive ScenarioArchive
+	err = json.Unmarshal(resp.Bytes(), &archive)
+	assert.NoError(t, err)
+	assert.Equal(t, ArchiveVersion, archive.Version)
+	assert.Equal(t, newScenario.Name, archive.Scenario.Name)
+	assert.Equal(t, 1, len(archive.ICs))
+	assert.Equal(t, newIC.UUID, archive.ICs[0].UUID)
+	assert.Equal(t, 1, len(archive.Configs))
+	assert.Equal(t, 2, len(archive.Configs[0].Signals))
+	assert.Equal(t, 1, len(archive.Dashboards))
+	assert.Equal(t, 1, len(archive.Dashboards[0].Widgets))
+	assert.Equal(t, 1, len(archive.Files))
+	assert.Equal(t, "This is my testfile\n", string(archive.Files[0].Data))
+	assert.Equal(t, 1, len(archive.Results))
+
+	// import the archive as user B
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		"/api/v2/scenarios/import", "POST", archive)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	err = helper.CompareResponse(resp, helper.KeyModels{"scenario": newScenario})
+	assert.NoError(t, err)
+
+	importedScenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+	assert.NotEqual(t, scenarioID, importedScenarioID)
+
+	// user B has access to the imported scenario
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v", importedScenarioID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// all children of the scenario have been imported with new IDs
+	db := database.GetDB()
+	var importedScenario database.Scenario
+	assert.NoError(t, db.Find(&importedScenario, importedScenarioID).Error)
+
+	var files []database.File
+	assert.NoError(t, db.Model(&importedScenario).Related(&files, "Files").Error)
+	assert.Equal(t, 1, len(files))
+	assert.NotEqual(t, archive.Files[0].ID, files[0].ID)
+	assert.Equal(t, "This is my testfile\n", string(files[0].FileData))
+
+	var configs []database.ComponentConfiguration
+	assert.NoError(t, db.Model(&importedScenario).Related(&configs, "ComponentConfigurations").Error)
+	assert.Equal(t, 1, len(configs))
+	assert.Equal(t, uint(icID), configs[0].ICID)
+	assert.Equal(t, []int64{int64(files[0].ID)}, []int64(configs[0].FileIDs))
+
+	var signals []database.Signal
+	assert.NoError(t, db.Order("ID asc").Model(&configs[0]).Related(&signals, "OutputMapping").Error)
+	assert.Equal(t, 2, len(signals))
+
+	var dashboards []database.Dashboard
+	assert.NoError(t, db.Model(&importedScenario).Related(&dashboards, "Dashboards").Error)
+	assert.Equal(t, 1, len(dashboards))
+
+	var widgets []database.Widget
+	assert.NoError(t, db.Model(&dashboards[0]).Related(&widgets, "Widgets").Error)
+	assert.Equal(t, 1, len(widgets))
+	assert.Equal(t, []int64{int64(signals[0].ID)}, []int64(widgets[0].SignalIDs))
+
+	var props map[string]interface{}
+	assert.NoError(t, json.Unmarshal(widgets[0].CustomProperties.RawMessage, &props))
+	assert.Equal(t, fmt.Sprint(files[0].ID), props["file"])
+
+	var results []database.Result
+	assert.NoError(t, db.Model(&importedScenario).Related(&results, "Results").Error)
+	assert.Equal(t, 1, len(results))
+}
+
+func TestExportImportScenarioWithoutIC(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": newScenario})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	scenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// add a component configuration which is not associated with an IC
+	newConfig := ConfigRequest{
+		Name:       "Config without IC",
+		ScenarioID: uint(scenarioID),
+		FileIDs:    []int64{},
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/configs", "POST", helper.KeyModels{"config": newConfig})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/export", scenarioID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	var archive ScenarioArchive
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &archive))
+	assert.Equal(t, 0, len(archive.ICs))
+	assert.Equal(t, 1, len(archive.Configs))
+
+	// the exported scenario can be imported again
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/scenarios/import", "POST", archive)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	importedScenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	var importedScenario database.Scenario
+	assert.NoError(t, database.GetDB().Find(&importedScenario, importedScenarioID).Error)
+	var configs []database.ComponentConfiguration
+	assert.NoError(t, database.GetDB().Model(&importedScenario).Related(&configs, "ComponentConfigurations").Error)
+	assert.Equal(t, 1, len(configs))
+	assert.Equal(t, "Config without IC", configs[0].Name)
+	assert.Equal(t, uint(0), configs[0].ICID)
+}
+
+func TestImportScenarioInvalidArchive(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as normal user
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	// try to POST with non JSON body
+	// should return a bad request error
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/scenarios/import", "POST", "this is not a JSON")
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	// try to import an archive of an unsupported version
+	// should return an unprocessable entity error
+	archive := ScenarioArchive{Version: ArchiveVersion + 1}
+	archive.Scenario.Name = "Scenario from the future"
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/scenarios/import", "POST", archive)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// try to import an archive which references an IC unknown to this backend
+	// should return an unprocessable entity error
+	archive.Version = ArchiveVersion
+	archive.ICs = []archiveIC{{ID: 1, UUID: "7be0322d-354e-431e-84bd-ae4c9633138b"}}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/scenarios/import", "POST", archive)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// try to import an archive with a component configuration whose IC is not contained in the archive
+	// should return an unprocessable entity error
+	archive.ICs = []archiveIC{}
+	archive.Configs = []archiveConfig{{ComponentConfiguration: database.ComponentConfiguration{Name: "Config without IC"}}}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/scenarios/import", "POST", archive)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+	archive.Configs = nil
+
+	// nothing was imported
+	number, err := helper.LengthOfResponse(router, token,
+		"/api/v2/scenarios", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, number)
+
+	// authenticate as guest user
+	token, err = helper.AuthenticateForTest(router, database.GuestCredentials)
+	assert.NoError(t, err)
+
+	// try to import a scenario as guest user
+	// should return an unprocessable entity error
+	archive.ICs = []archiveIC{}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/scenarios/import", "POST", archive)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+}
+
+// addScenarioTree adds a scenario with a file, a component configuration, two signals,
+// a dashboard with an image widget and a result and returns the ID of the scenario
+func addScenarioTree(t *testing.T, token string, icID int) int {
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": newScenario})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	scenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	fileID := addFile(t, token, scenarioID)
+
+	newConfig := ConfigRequest{
+		Name:            "Example for Signal generator",
+		ScenarioID:      uint(scenarioID),
+		ICID:            uint(icID),
+		StartParameters: postgres.Jsonb{RawMessage: json.RawMessage(`{"parameter1" : "testValue1A"}`)},
+		FileIDs:         []int64{int64(fileID)},
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/configs", "POST", helper.KeyModels{"config": newConfig})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	configID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	var signalIndex0 uint = 0
+	var signalIDs []int64
+	for _, direction := range []string{"out", "in"} {
+		newSignal := SignalRequest{
+			Name:      direction + "Signal_A",
+			Unit:      "V",
+			Direction: direction,
+			Index:     &signalIndex0,
+			ConfigID:  uint(configID),
+		}
+		code, resp, err = helper.TestEndpoint(router, token,
+			"/api/v2/signals", "POST", helper.KeyModels{"signal": newSignal})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+		signalID, err := helper.GetResponseID(resp)
+		assert.NoError(t, err)
+		signalIDs = append(signalIDs, int64(signalID))
+	}
+
+	newDashboard := DashboardRequest{
+		Name:       "Dashboard_A",
+		Grid:       15,
+		ScenarioID: uint(scenarioID),
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/dashboards", "POST", helper.KeyModels{"dashboard": newDashboard})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	dashboardID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	newWidget := WidgetRequest{
+		Name:             "My image",
+		Type:             "Image",
+		Width:            100,
+		Height:           50,
+		MinWidth:         40,
+		MinHeight:        80,
+		DashboardID:      uint(dashboardID),
+		CustomProperties: postgres.Jsonb{RawMessage: json.RawMessage(fmt.Sprintf(`{"file" : "%d", "update" : false, "lockAspect" : true}`, fileID))},
+		SignalIDs:        signalIDs[:1],
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/widgets", "POST", helper.KeyModels{"widget": newWidget})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	newResult := ResultRequest{
+		Description:     "This is a test result.",
+		ScenarioID:      uint(scenarioID),
+		ConfigSnapshots: postgres.Jsonb{RawMessage: json.RawMessage(`{"configs": []}`)},
+	}
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/results", "POST", helper.KeyModels{"result": newResult})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	return scenarioID
+}
+
+func addFile(t *testing.T, token string, scenarioID int) int {
+
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+	fileWriter, err := bodyWriter.CreateFormFile("file", "testuploadfile.txt")
+	assert.NoError(t, err, "writing to buffer")
+
+	_, err = io.Copy(fileWriter, bytes.NewBufferString("This is my testfile\n"))
+	assert.NoError(t, err, "IO copy")
+
+	contentType := bodyWriter.FormDataContentType()
+	bodyWriter.Close()
+
+	// Create the request
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", fmt.Sprintf("/api/v2/files?scenarioID=%v", scenarioID), bodyBuf)
+	assert.NoError(t, err, "create request")
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Add("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+
+	assert.Equalf(t, 200, w.Code, "Response body: \n%v\n", w.Body)
+
+	newFileID, err := helper.GetResponseID(w.Body)
+	assert.NoError(t, err)
+
+	return newFileID
+}
+
+func newFalse() *bool {
+	b := false
+	return &b
+}
+
+type CloneRequest struct {
+	Name      string        `json:"name,omitempty"`
+	OwnerID   uint          `json:"ownerID,omitempty"`
+	ICMapping map[uint]uint `json:"icMapping,omitempty"`
+}
+
+func TestCloneScenario(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin user to add two ICs
+	adminToken, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, adminToken,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	icID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	otherIC := newIC
+	otherIC.UUID = "4854af30-325f-44a5-ad59-b67b2597de68"
+	otherIC.Name = "Other IC"
+	code, resp, err = helper.TestEndpoint(router, adminToken,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": otherIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	otherICID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// authenticate as normal user
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	scenarioID := addScenarioTree(t, token, icID)
+
+	// authenticate as user B who has no access to the scenario
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+
+	// try to clone the scenario as user B
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v/clone", scenarioID), "POST",
+		helper.KeyModels{"clone": CloneRequest{Name: "Fork"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// try to clone the scenario without a name
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/clone", scenarioID), "POST",
+		helper.KeyModels{"clone": CloneRequest{}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// try to clone the scenario for another user as normal user
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/clone", scenarioID), "POST",
+		helper.KeyModels{"clone": CloneRequest{Name: "Fork", OwnerID: 3}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// try to remap the IC to an IC that does not exist
+	// should return an unprocessable entity error
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/clone", scenarioID), "POST",
+		helper.KeyModels{"clone": CloneRequest{Name: "Fork", ICMapping: map[uint]uint{uint(icID): 100}}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// clone the scenario as user A and remap the IC
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/clone", scenarioID), "POST",
+		helper.KeyModels{"clone": CloneRequest{Name: "Fork", ICMapping: map[uint]uint{uint(icID): uint(otherICID)}}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	err = helper.CompareResponse(resp, helper.KeyModels{"scenario": ScenarioRequest{Name: "Fork"}})
+	assert.NoError(t, err)
+
+	cloneID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+	assert.NotEqual(t, scenarioID, cloneID)
+
+	// the clone contains copies of all children using the remapped IC
+	db := database.GetDB()
+	var clone database.Scenario
+	assert.NoError(t, db.Find(&clone, cloneID).Error)
+
+	var files []database.File
+	assert.NoError(t, db.Model(&clone).Related(&files, "Files").Error)
+	assert.Equal(t, 1, len(files))
+
+	var configs []database.ComponentConfiguration
+	assert.NoError(t, db.Model(&clone).Related(&configs, "ComponentConfigurations").Error)
+	assert.Equal(t, 1, len(configs))
+	assert.Equal(t, uint(otherICID), configs[0].ICID)
+	assert.Equal(t, []int64{int64(files[0].ID)}, []int64(configs[0].FileIDs))
+
+	var dashboards []database.Dashboard
+	assert.NoError(t, db.Model(&clone).Related(&dashboards, "Dashboards").Error)
+	assert.Equal(t, 1, len(dashboards))
+
+	var widgets []database.Widget
+	assert.NoError(t, db.Model(&dashboards[0]).Related(&widgets, "Widgets").Error)
+	assert.Equal(t, 1, len(widgets))
+
+	var results []database.Result
+	assert.NoError(t, db.Model(&clone).Related(&results, "Results").Error)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "This is a test result.", results[0].Description)
+
+	// the original scenario is unchanged
+	var original database.Scenario
+	assert.NoError(t, db.Find(&original, scenarioID).Error)
+
+	// the file of the clone has a copy of the data of the original file
+	var originalFiles []database.File
+	assert.NoError(t, db.Model(&original).Related(&originalFiles, "Files").Error)
+	assert.Equal(t, 1, len(originalFiles))
+	assert.NotEqual(t, originalFiles[0].Key, files[0].Key)
+	assert.Equal(t, originalFiles[0].FileData, files[0].FileData)
+	assert.NoError(t, db.Model(&original).Related(&configs, "ComponentConfigurations").Error)
+	assert.Equal(t, 1, len(configs))
+	assert.Equal(t, uint(icID), configs[0].ICID)
+
+	// clone the scenario as admin for user B
+	code, resp, err = helper.TestEndpoint(router, adminToken,
+		fmt.Sprintf("/api/v2/scenarios/%v/clone", scenarioID), "POST",
+		helper.KeyModels{"clone": CloneRequest{Name: "Fork for B", OwnerID: 3}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	cloneID, err = helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// user B has access to the clone
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v", cloneID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+}
+
+func TestCloneScenarioRollback(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin user to add an IC
+	adminToken, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, adminToken,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	icID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// authenticate as normal user
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	scenarioID := addScenarioTree(t, token, icID)
+
+	count := func(model interface{}) int {
+		var n int
+		assert.NoError(t, database.GetDB().Model(model).Count(&n).Error)
+		return n
+	}
+	scenarios, configs, signals, dashboards := count(&database.Scenario{}), count(&database.ComponentConfiguration{}),
+		count(&database.Signal{}), count(&database.Dashboard{})
+
+	// let the creation of widgets fail after everything else was copied
+	callbacks := database.GetDB().Callback().Create()
+	callbacks.Before("gorm:create").Register("test:fail_widget_create", func(scope *gorm.Scope) {
+		if scope.TableName() == "widgets" {
+			scope.Err(fmt.Errorf("injected failure"))
+		}
+	})
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/clone", scenarioID), "POST",
+		helper.KeyModels{"clone": CloneRequest{Name: "Fork"}})
+	callbacks.Remove("test:fail_widget_create")
+	assert.NoError(t, err)
+	assert.Equalf(t, 500, code, "Response body: \n%v\n", resp)
+
+	// no partial copy is left behind
+	assert.Equal(t, scenarios, count(&database.Scenario{}))
+	assert.Equal(t, configs, count(&database.ComponentConfiguration{}))
+	assert.Equal(t, signals, count(&database.Signal{}))
+	assert.Equal(t, dashboards, count(&database.Dashboard{}))
+}
+
+func TestImportScenarioRollback(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin user to add an IC
+	adminToken, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, adminToken,
+		"/api/v2/ic", "POST", helper.KeyModels{"ic": newIC})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	icID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// authenticate as normal user
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	scenarioID := addScenarioTree(t, token, icID)
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v/export", scenarioID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	var archive ScenarioArchive
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &archive))
+
+	count := func(model interface{}) int {
+		var n int
+		assert.NoError(t, database.GetDB().Unscoped().Model(model).Count(&n).Error)
+		return n
+	}
+	scenarios, files, configs, signals, dashboards := count(&database.Scenario{}), count(&database.File{}),
+		count(&database.ComponentConfiguration{}), count(&database.Signal{}), count(&database.Dashboard{})
+
+	// let the creation of widgets fail after everything else was imported
+	callbacks := database.GetDB().Callback().Create()
+	callbacks.Before("gorm:create").Register("test:fail_widget_create", func(scope *gorm.Scope) {
+		if scope.TableName() == "widgets" {
+			scope.Err(fmt.Errorf("injected failure"))
+		}
+	})
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/scenarios/import", "POST", archive)
+	callbacks.Remove("test:fail_widget_create")
+	assert.NoError(t, err)
+	assert.Equalf(t, 500, code, "Response body: \n%v\n", resp)
+
+	// no partial import is left behind
+	assert.Equal(t, scenarios, count(&database.Scenario{}))
+	assert.Equal(t, files, count(&database.File{}))
+	assert.Equal(t, configs, count(&database.ComponentConfiguration{}))
+	assert.Equal(t, signals, count(&database.Signal{}))
+	assert.Equal(t, dashboards, count(&database.Dashboard{}))
+}
@@ -0,0 +1,66 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package scenario_transfer
+
+import (
+	"fmt"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+var validate *validator.Validate
+
+type validCloneRequest struct {
+	Name      string        `form:"Name" validate:"required"`
+	OwnerID   uint          `form:"OwnerID" validate:"omitempty"`
+	ICMapping map[uint]uint `form:"ICMapping" validate:"omitempty"`
+}
+
+type cloneScenarioRequest struct {
+	Clone validCloneRequest `json:"clone"`
+}
+
+func (r *cloneScenarioRequest) validate() error {
+	validate = validator.New()
+	errs := validate.Struct(r)
+	return errs
+}
+
+func (a *ScenarioArchive) validate() error {
+	if a.Version < 1 || a.Version > ArchiveVersion {
+		return fmt.Errorf("unsupported archive version %d (supported up to version %d)", a.Version, ArchiveVersion)
+	}
+
+	if a.Scenario.Name == "" {
+		return fmt.Errorf("archive does not contain a scenario name")
+	}
+
+	// the component configurations must use ICs of the archive, which are mapped to the ICs of this backend instance;
+	// configurations without an IC are imported without an IC
+	archivedICs := make(map[uint]bool)
+	for _, aic := range a.ICs {
+		archivedICs[aic.ID] = true
+	}
+	for _, ac := range a.Configs {
+		if ac.ICID != 0 && !archivedICs[ac.ICID] {
+			return fmt.Errorf("component configuration %v uses IC %d which is not contained in the archive", ac.Name, ac.ICID)
+		}
+	}
+
+	return nil
+}
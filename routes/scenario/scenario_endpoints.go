@@ -24,6 +24,7 @@ import (
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
 func RegisterScenarioEndpoints(r *gin.RouterGroup) {
@@ -33,6 +34,7 @@ func RegisterScenarioEndpoints(r *gin.RouterGroup) {
 	r.GET("/:scenarioID", getScenario)
 	r.DELETE("/:scenarioID", deleteScenario)
 	r.GET("/:scenarioID/users", getUsersOfScenario)
+	r.GET("/:scenarioID/members", getMembersOfScenario)
 	r.PUT("/:scenarioID/user", addUserToScenario)
 	r.DELETE("/:scenarioID/user", deleteUserFromScenario)
 }
@@ -51,6 +53,14 @@ func RegisterScenarioEndpoints(r *gin.RouterGroup) {
 func getScenarios(c *gin.Context) {
 
 	// Checking permissions is not required here as read access is independent of user's role
+	// API tokens may however not be allowed to read scenarios at all
+	if database.IsAPITokenRequest(c) {
+		err := database.ValidateRole(c, database.ModelScenario, database.Read)
+		if err != nil {
+			helper.UnprocessableEntityError(c, err.Error())
+			return
+		}
+	}
 
 	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
 	userID, _ := c.Get(database.UserIDCtx)
@@ -63,15 +73,21 @@ func getScenarios(c *gin.Context) {
 
 	// get all scenarios for the user who issues the request
 
+	query := db.Order("ID asc")
+	if tokenScenarioID := database.TokenScenarioID(c); tokenScenarioID != 0 {
+		// API token limited to a single scenario
+		query = query.Where("scenarios.id = ?", tokenScenarioID)
+	}
+
 	var scenarios []database.Scenario
 	if u.Role == "Admin" { // Admin can see all scenarios
-		err = db.Order("ID asc").Find(&scenarios).Error
+		err = query.Find(&scenarios).Error
 		if helper.DBError(c, err) {
 			return
 		}
 
 	} else { // User or Guest roles see only their scenarios
-		err = db.Order("ID asc").Model(&u).Related(&scenarios, "Scenarios").Error
+		err = query.Model(&u).Related(&scenarios, "Scenarios").Error
 		if helper.DBError(c, err) {
 			return
 		}
@@ -132,11 +148,12 @@ func addScenario(c *gin.Context) {
 	}
 
 	// add user to new scenario
-	err = newScenario.addUser(&(u))
+	err = newScenario.addUser(&(u), database.ScenarioOwner)
 	if helper.DBError(c, err) {
 		return
 	}
 
+	database.Audit(c, database.Create, database.ModelScenario, newScenario.ID, newScenario.ID, nil, newScenario.Scenario)
 	c.JSON(http.StatusOK, gin.H{"scenario": newScenario.Scenario})
 }
 
@@ -188,6 +205,8 @@ func updateScenario(c *gin.Context) {
 		return
 	}
 
+	database.Audit(c, database.Update, database.ModelScenario, oldScenario_r.ID, oldScenario_r.ID, oldScenario_r, updatedScenario.Scenario)
+
 	c.JSON(http.StatusOK, gin.H{"scenario": updatedScenario.Scenario})
 }
 
@@ -236,18 +255,13 @@ func deleteScenario(c *gin.Context) {
 	var so Scenario
 	so.Scenario = so_r
 
-	errs := so.delete()
-	if len(errs) > 0 {
-		var errorString = "DB errors:"
-		for _, e := range errs {
-			if e != nil {
-				errorString += ", " + e.Error()
-			}
-		}
-		helper.InternalServerError(c, errorString)
+	err := so.delete()
+	if err != nil {
+		helper.InternalServerError(c, "Deleting the scenario failed, nothing was deleted: "+err.Error())
 		return
 	}
 
+	database.Audit(c, database.Delete, database.ModelScenario, so.ID, so.ID, so.Scenario, nil)
 	c.JSON(http.StatusOK, gin.H{"scenario": so.Scenario})
 }
 
@@ -265,7 +279,7 @@ func deleteScenario(c *gin.Context) {
 // @Security Bearer
 func getUsersOfScenario(c *gin.Context) {
 
-	ok, so_r := database.CheckScenarioPermissions(c, database.Read, "path", -1)
+	ok, so_r := database.CheckScenarioMemberPermissions(c, database.Read, "path", -1)
 	if !ok {
 		return
 	}
@@ -282,22 +296,52 @@ func getUsersOfScenario(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"users": allUsers})
 }
 
+// getMembersOfScenario godoc
+// @Summary Get the members of a scenario and their roles in the scenario
+// @ID getMembersOfScenario
+// @Produce  json
+// @Tags scenarios
+// @Success 200 {object} api.ResponseScenarioMembers "Array of memberships of the scenario"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param scenarioID path int true "Scenario ID"
+// @Router /scenarios/{scenarioID}/members [get]
+// @Security Bearer
+func getMembersOfScenario(c *gin.Context) {
+
+	ok, so_r := database.CheckScenarioMemberPermissions(c, database.Read, "path", -1)
+	if !ok {
+		return
+	}
+
+	var so Scenario
+	so.Scenario = so_r
+
+	members, err := so.getMembers()
+	if !helper.DBError(c, err) {
+		c.JSON(http.StatusOK, gin.H{"members": members})
+	}
+}
+
 // addUserToScenario godoc
-// @Summary Add a user to a a scenario
+// @Summary Add a user to a a scenario or change the role of a member of a scenario
 // @ID addUserToScenario
 // @Tags scenarios
 // @Produce json
 // @Success 200 {object} api.ResponseUser "User that was added to scenario"
+// @Failure 400 {object} api.ResponseError "Bad request"
 // @Failure 404 {object} api.ResponseError "Not found"
 // @Failure 422 {object} api.ResponseError "Unprocessable entity"
 // @Failure 500 {object} api.ResponseError "Internal server error"
 // @Param scenarioID path int true "Scenario ID"
 // @Param username query string true "User name"
+// @Param role query string false "Role of the user in the scenario (default: owner for new members, unchanged for existing members)" Enums(owner, editor, viewer)
 // @Router /scenarios/{scenarioID}/user [put]
 // @Security Bearer
 func addUserToScenario(c *gin.Context) {
 
-	ok, so_r := database.CheckScenarioPermissions(c, database.Update, "path", -1)
+	ok, so_r := database.CheckScenarioMemberPermissions(c, database.Update, "path", -1)
 	if !ok {
 		return
 	}
@@ -305,6 +349,12 @@ func addUserToScenario(c *gin.Context) {
 	var so Scenario
 	so.Scenario = so_r
 
+	role, hasRole := c.GetQuery("role")
+	if hasRole && !database.IsScenarioRole(role) {
+		helper.BadRequestError(c, "invalid role: "+role)
+		return
+	}
+
 	username := c.Request.URL.Query().Get("username")
 	var u database.User
 	db := database.GetDB()
@@ -318,11 +368,33 @@ func addUserToScenario(c *gin.Context) {
 		return
 	}
 
-	err = so.addUser(&(u))
+	membership, err := database.GetScenarioMembership(so.ID, u.ID)
+	if err == gorm.ErrRecordNotFound {
+		if !hasRole {
+			role = database.ScenarioOwner
+		}
+	} else if helper.DBError(c, err) {
+		return
+	} else if !hasRole {
+		role = membership.Role
+	}
+
+	if role != database.ScenarioOwner {
+		lastOwner, err := so.isLastOwner(&u)
+		if helper.DBError(c, err) {
+			return
+		} else if lastOwner {
+			helper.UnprocessableEntityError(c, "cannot change the role of the last owner of the scenario")
+			return
+		}
+	}
+
+	err = so.addUser(&(u), role)
 	if helper.DBError(c, err) {
 		return
 	}
 
+	database.Audit(c, database.Update, database.ModelScenario, so.ID, so.ID, nil, gin.H{"addedUser": u.Username, "role": role})
 	c.JSON(http.StatusOK, gin.H{"user": u})
 }
 
@@ -341,7 +413,7 @@ func addUserToScenario(c *gin.Context) {
 // @Security Bearer
 func deleteUserFromScenario(c *gin.Context) {
 
-	ok, so_r := database.CheckScenarioPermissions(c, database.Update, "path", -1)
+	ok, so_r := database.CheckScenarioMemberPermissions(c, database.Update, "path", -1)
 	if !ok {
 		return
 	}
@@ -357,10 +429,25 @@ func deleteUserFromScenario(c *gin.Context) {
 		return
 	}
 
+	lastOwner, err := so.isLastOwner(&u)
+	if helper.DBError(c, err) {
+		return
+	}
+	members, err := so.getMembers()
+	if helper.DBError(c, err) {
+		return
+	}
+	if lastOwner && len(members) > 1 {
+		helper.UnprocessableEntityError(c, "cannot delete the last owner from a scenario with other members")
+		return
+	}
+
 	err = so.deleteUser(username)
 	if helper.DBError(c, err) {
 		return
 	}
 
+	database.Audit(c, database.Update, database.ModelScenario, so.ID, so.ID, nil, gin.H{"removedUser": u.Username})
+
 	c.JSON(http.StatusOK, gin.H{"user": u})
 }
@@ -69,11 +69,32 @@ func (s *Scenario) update(updatedScenario Scenario) error {
 	return err
 }
 
-func (s *Scenario) addUser(u *database.User) error {
+func (s *Scenario) addUser(u *database.User, role string) error {
+	return database.SetScenarioMember(s.ID, u.ID, role)
+}
+
+// isLastOwner returns true if the user is the only owner of the scenario
+func (s *Scenario) isLastOwner(u *database.User) (bool, error) {
+	m, err := database.GetScenarioMembership(s.ID, u.ID)
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if m.Role != database.ScenarioOwner {
+		return false, nil
+	}
 
+	owners, err := database.CountScenarioOwners(s.ID)
+	return owners == 1, err
+}
+
+func (s *Scenario) getMembers() ([]database.ScenarioMembership, error) {
 	db := database.GetDB()
-	err := db.Model(s).Association("Users").Append(u).Error
-	return err
+	var members []database.ScenarioMembership
+	err := db.Order("user_id asc").Where("scenario_id = ?", s.ID).Find(&members).Error
+	return members, err
 }
 
 func (s *Scenario) deleteUser(username string) error {
@@ -118,186 +139,149 @@ func (s *Scenario) deleteUser(username string) error {
 	return nil
 }
 
-func (s *Scenario) delete() []error {
-	db := database.GetDB()
-
-	var errs []error
+// delete removes the scenario with its files, results, dashboards, widgets, component configurations
+// and signals in one transaction; if any step fails, nothing is deleted. All rows are soft-deleted
+// at the same time and the members are kept, so that the scenario can be restored from the trash.
+func (s *Scenario) delete() error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		database.SetDeletionTime(tx)
 
-	// delete all files of the scenario
-	var files []database.File
-	err := db.Order("ID asc").Model(s).Related(&files, "Files").Error
-	if err != nil {
-		errs = append(errs, err)
-	}
-
-	for _, f := range files {
-		// delete file from s3 bucket
-		if f.Key != "" {
-			// TODO we do not delete the file from s3 object storage
-			// to ensure that no data is lost if multiple File objects reference the same S3 data object
-			// This behavior should be replaced by a different file handling in the future
-			//err = f.deleteS3()
-			//if err != nil {
-			//	return err
-			//}
-			//log.Println("Deleted file in S3 object storage")
-			log.Printf("Did NOT delete file with key %v in S3 object storage!\n", f.Key)
-		}
-
-		log.Println("DELETE file ", f.ID, "(name="+f.Name+")")
-		err = db.Delete(&f).Error
+		// delete all files of the scenario
+		var files []database.File
+		err := tx.Order("ID asc").Model(s).Related(&files, "Files").Error
 		if err != nil {
-			errs = append(errs, err)
+			return err
 		}
-	}
 
-	// delete all results of the scenario
-	var results []database.Result
-	err = db.Order("ID asc").Model(s).Related(&results, "Results").Error
-	if err != nil {
-		errs = append(errs, err)
-	}
-
-	for _, r := range results {
-		log.Println("DELETE result ", r.ID, "(desc="+r.Description+")")
-		err = db.Delete(&r).Error
-		if err != nil {
-			errs = append(errs, err)
+		for _, f := range files {
+			// the data is deleted from its storage when the file is purged from the trash
+			log.Println("DELETE file ", f.ID, "(name="+f.Name+")")
+			err = tx.Delete(&f).Error
+			if err != nil {
+				return err
+			}
 		}
-	}
-
-	// delete all dashboards (and widgets) of the scenario
-	var dab []database.Dashboard
-	err = db.Order("ID asc").Model(s).Related(&dab, "Dashboards").Error
-	if err != nil {
-		errs = append(errs, err)
-	}
 
-	for _, d := range dab {
-		// get all widgets of the dashboard
-		var widgets []database.Widget
-		err = db.Order("ID asc").Model(&d).Related(&widgets, "Widgets").Error
+		// delete all results of the scenario
+		var results []database.Result
+		err = tx.Order("ID asc").Model(s).Related(&results, "Results").Error
 		if err != nil {
-			errs = append(errs, err)
+			return err
 		}
 
-		// Delete widgets
-		for _, widget := range widgets {
-			log.Println("DELETE widget ", widget.ID, "(name="+widget.Name+")")
-			err = db.Delete(&widget).Error
+		for _, r := range results {
+			log.Println("DELETE result ", r.ID, "(desc="+r.Description+")")
+			err = tx.Delete(&r).Error
 			if err != nil {
-				errs = append(errs, err)
+				return err
 			}
 		}
 
-		// Delete dashboard
-		log.Println("DELETE dashboard ", d.ID, "(name="+d.Name+")")
-		err = db.Delete(&d).Error
+		// delete all dashboards (and widgets) of the scenario
+		var dab []database.Dashboard
+		err = tx.Order("ID asc").Model(s).Related(&dab, "Dashboards").Error
 		if err != nil {
-			errs = append(errs, err)
+			return err
 		}
-	}
 
-	// delete all component configs (and signals) of the scenario
-	var configs []database.ComponentConfiguration
-	err = db.Order("ID asc").Model(s).Related(&configs, "ComponentConfigurations").Error
-	if err != nil {
-		errs = append(errs, err)
-	}
+		for _, d := range dab {
+			// get all widgets of the dashboard
+			var widgets []database.Widget
+			err = tx.Order("ID asc").Model(&d).Related(&widgets, "Widgets").Error
+			if err != nil {
+				return err
+			}
 
-	for _, config := range configs {
+			// Delete widgets
+			for _, widget := range widgets {
+				log.Println("DELETE widget ", widget.ID, "(name="+widget.Name+")")
+				err = tx.Delete(&widget).Error
+				if err != nil {
+					return err
+				}
+			}
 
-		// Get Signals of InputMapping and delete them
-		var InputMappingSignals []database.Signal
-		err = db.Model(&config).Related(&InputMappingSignals, "InputMapping").Error
-		if err != nil {
-			errs = append(errs, err)
-		}
-		for _, sig := range InputMappingSignals {
-			log.Println("DELETE signal ", sig.ID, "(name="+sig.Name+")")
-			err = db.Delete(&sig).Error
+			// Delete dashboard
+			log.Println("DELETE dashboard ", d.ID, "(name="+d.Name+")")
+			err = tx.Delete(&d).Error
 			if err != nil {
-				errs = append(errs, err)
+				return err
 			}
 		}
 
-		// Get Signals of OutputMapping and delete them
-		var OutputMappingSignals []database.Signal
-		err = db.Model(&config).Related(&OutputMappingSignals, "OutputMapping").Error
+		// delete all component configs (and signals) of the scenario
+		var configs []database.ComponentConfiguration
+		err = tx.Order("ID asc").Model(s).Related(&configs, "ComponentConfigurations").Error
 		if err != nil {
-			errs = append(errs, err)
-		}
-		for _, sig := range OutputMappingSignals {
-			log.Println("DELETE signal ", sig.ID, "(name="+sig.Name+")")
-			err = db.Delete(&sig).Error
-			if err != nil {
-				errs = append(errs, err)
-			}
+			return err
 		}
 
-		var ic database.InfrastructureComponent
-		err = db.Find(&ic, config.ICID).Error
-		if err == nil {
-			// remove association between Infrastructure component and config
-			log.Println("DELETE ASSOCIATION to IC ", ic.ID, "(name="+ic.Name+")")
-			err = db.Model(&ic).Association("ComponentConfigurations").Delete(&config).Error
+		for _, config := range configs {
+			err = deleteComponentConfig(tx, config)
 			if err != nil {
-				errs = append(errs, err)
+				return err
 			}
+		}
 
-			// if IC has state gone and there is no component configuration associated with it: delete IC
-			no_configs := db.Model(&ic).Association("ComponentConfigurations").Count()
-			if no_configs == 0 && ic.State == "gone" {
-				log.Println("DELETE IC with state gone, last component config deleted", ic.UUID)
-				err = db.Delete(&ic).Error
-				if err != nil {
-					errs = append(errs, err)
-				}
+		// Delete scenario
+		return tx.Delete(s).Error
+	})
+}
 
-			}
-		} else {
-			if err == gorm.ErrRecordNotFound {
-				log.Printf("SKIPPING IC association removal, IC with id=%v not found\n", config.ICID)
-			} else {
-				errs = append(errs, err)
-			}
-		}
+// deleteComponentConfig deletes the component configuration and its signals within the transaction tx,
+// the IC of the configuration is deleted as well if it is gone and no longer used
+func deleteComponentConfig(tx *gorm.DB, config database.ComponentConfiguration) error {
 
-		// delete component configuration
-		log.Println("DELETE component config ", config.ID, "(name="+config.Name+")")
-		err = db.Delete(&config).Error
+	// Get Signals of InputMapping and delete them
+	var InputMappingSignals []database.Signal
+	err := tx.Model(&config).Related(&InputMappingSignals, "InputMapping").Error
+	if err != nil {
+		return err
+	}
+	for _, sig := range InputMappingSignals {
+		log.Println("DELETE signal ", sig.ID, "(name="+sig.Name+")")
+		err = tx.Delete(&sig).Error
 		if err != nil {
-			errs = append(errs, err)
+			return err
 		}
 	}
 
-	// delete scenario from all users and vice versa
-
-	users, no_users, err := s.getUsers()
+	// Get Signals of OutputMapping and delete them
+	var OutputMappingSignals []database.Signal
+	err = tx.Model(&config).Related(&OutputMappingSignals, "OutputMapping").Error
 	if err != nil {
-		errs = append(errs, err)
+		return err
 	}
-	if no_users > 0 {
-		for _, u := range users {
-			// remove user from scenario
-			log.Println("DELETE ASSOCIATION to user", u.ID, "(name="+u.Username+")")
-			err = db.Model(s).Association("Users").Delete(&u).Error
-			if err != nil {
-				errs = append(errs, err)
-			}
-			// remove scenario from user
-			err = db.Model(&u).Association("Scenarios").Delete(s).Error
-			if err != nil {
-				errs = append(errs, err)
-			}
+	for _, sig := range OutputMappingSignals {
+		log.Println("DELETE signal ", sig.ID, "(name="+sig.Name+")")
+		err = tx.Delete(&sig).Error
+		if err != nil {
+			return err
 		}
 	}
 
-	// Delete scenario
-	err = db.Delete(s).Error
+	// delete component configuration
+	log.Println("DELETE component config ", config.ID, "(name="+config.Name+")")
+	err = tx.Delete(&config).Error
 	if err != nil {
-		errs = append(errs, err)
+		return err
+	}
+
+	var ic database.InfrastructureComponent
+	err = tx.Find(&ic, config.ICID).Error
+	if err == gorm.ErrRecordNotFound {
+		log.Printf("SKIPPING IC deletion check, IC with id=%v not found\n", config.ICID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// if IC has state gone and there is no component configuration associated with it: delete IC
+	no_configs := tx.Model(&ic).Association("ComponentConfigurations").Count()
+	if no_configs == 0 && ic.State == "gone" {
+		log.Println("DELETE IC with state gone, last component config deleted", ic.UUID)
+		return tx.Delete(&ic).Error
 	}
 
-	return errs
+	return nil
 }
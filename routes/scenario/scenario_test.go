@@ -41,6 +41,7 @@ import (
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 	"github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/stretchr/testify/assert"
 )
@@ -579,6 +580,76 @@ func TestDeleteScenario(t *testing.T) {
 	assert.Equalf(t, 404, code, "Response body: \n%v\n", resp)
 }
 
+func TestDeleteScenarioRollback(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as admin user to add ICs
+	token, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	ic1ID, ic2ID := addICs(t, token)
+
+	// authenticate as normal user
+	token, err = helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": newScenario1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	newScenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	fileID := addFile(t, token, newScenarioID)
+	dashboardID := addDashboard(t, token, newScenarioID)
+	widgetID := addWidget(t, token, dashboardID)
+	componentConfig1ID, _ := addComponentConfigs(t, token, newScenarioID, ic1ID, ic2ID)
+	signalInID, _ := addSignals(t, token, componentConfig1ID)
+
+	// let the deletion of component configurations fail after files, dashboards and widgets were deleted
+	callbacks := database.GetDB().Callback().Delete()
+	callbacks.Before("gorm:delete").Register("test:fail_config_delete", func(scope *gorm.Scope) {
+		if scope.TableName() == "component_configurations" {
+			scope.Err(fmt.Errorf("injected failure"))
+		}
+	})
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v", newScenarioID), "DELETE", nil)
+	callbacks.Remove("test:fail_config_delete")
+	assert.NoError(t, err)
+	assert.Equalf(t, 500, code, "Response body: \n%v\n", resp)
+
+	// nothing was deleted
+	for _, url := range []string{
+		fmt.Sprintf("/api/v2/scenarios/%v", newScenarioID),
+		fmt.Sprintf("/api/v2/files/%v", fileID),
+		fmt.Sprintf("/api/v2/dashboards/%v", dashboardID),
+		fmt.Sprintf("/api/v2/widgets/%v", widgetID),
+		fmt.Sprintf("/api/v2/configs/%v", componentConfig1ID),
+		fmt.Sprintf("/api/v2/signals/%v", signalInID),
+		fmt.Sprintf("/api/v2/ic/%v", ic2ID),
+	} {
+		code, resp, err = helper.TestEndpoint(router, token, url, "GET", nil)
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "GET %v, response body: \n%v\n", url, resp)
+	}
+
+	// without failure the scenario is deleted
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v", newScenarioID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/widgets/%v", widgetID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 404, code, "Response body: \n%v\n", resp)
+}
+
 func TestAddUserToScenario(t *testing.T) {
 
 	database.DropTables()
@@ -656,6 +727,122 @@ func TestAddUserToScenario(t *testing.T) {
 
 }
 
+func TestScenarioMemberRoles(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as normal user
+	tokenA, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	code, resp, err := helper.TestEndpoint(router, tokenA,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": newScenario1})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	newScenarioID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	// try to add userB with an invalid role
+	// should return a bad request error
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/scenarios/%v/user?username=User_B&role=student", newScenarioID), "PUT", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	// add userB as viewer
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/scenarios/%v/user?username=User_B&role=viewer", newScenarioID), "PUT", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/scenarios/%v/members", newScenarioID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"members": []map[string]interface{}{
+		{"userID": 2, "scenarioID": newScenarioID, "role": database.ScenarioOwner},
+		{"userID": 3, "scenarioID": newScenarioID, "role": database.ScenarioViewer},
+	}})
+	assert.NoError(t, err)
+
+	// authenticate as userB
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+
+	newDashboard := map[string]interface{}{"name": "Dashboard", "grid": 15, "scenarioID": newScenarioID}
+
+	// viewers can read the scenario
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v", newScenarioID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// but they cannot update it or add dashboards to it
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v", newScenarioID), "PUT", helper.KeyModels{"scenario": newScenario2})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		"/api/v2/dashboards", "POST", helper.KeyModels{"dashboard": newDashboard})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// make userB an editor
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/scenarios/%v/user?username=User_B&role=editor", newScenarioID), "PUT", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// editors can update the scenario and its contents
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		"/api/v2/dashboards", "POST", helper.KeyModels{"dashboard": newDashboard})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	dashboardID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/dashboards/%v", dashboardID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// but they cannot manage the members of the scenario or delete it
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v/user?username=User_C", newScenarioID), "PUT", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/scenarios/%v", newScenarioID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// re-adding userB without a role does not change the role of userB
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/scenarios/%v/user?username=User_B", newScenarioID), "PUT", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	membership, err := database.GetScenarioMembership(uint(newScenarioID), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, database.ScenarioEditor, membership.Role)
+
+	// try to downgrade and remove the last owner of the scenario
+	// should return unprocessable entity errors
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/scenarios/%v/user?username=User_A&role=editor", newScenarioID), "PUT", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, tokenA,
+		fmt.Sprintf("/api/v2/scenarios/%v/user?username=User_A", newScenarioID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+}
+
 func TestGetAllUsersOfScenario(t *testing.T) {
 
 	database.DropTables()
@@ -114,6 +114,7 @@ func addSignal(c *gin.Context) {
 	// Add signal to component configuration
 	err := newSignal.AddToConfig()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelSignal, newSignal.ID, database.ScenarioIDOfConfig(newSignal.ConfigID), nil, newSignal.Signal)
 		c.JSON(http.StatusOK, gin.H{"signal": newSignal.Signal})
 	}
 
@@ -160,6 +161,7 @@ func updateSignal(c *gin.Context) {
 	// Update the signal in the DB
 	err := oldSignal.update(updatedSignal)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelSignal, oldSignal_r.ID, database.ScenarioIDOfConfig(oldSignal_r.ConfigID), oldSignal_r, updatedSignal.Signal)
 		c.JSON(http.StatusOK, gin.H{"signal": updatedSignal.Signal})
 	}
 
@@ -212,6 +214,7 @@ func deleteSignal(c *gin.Context) {
 
 	err := sig.delete()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelSignal, sig.ID, database.ScenarioIDOfConfig(sig.ConfigID), sig.Signal, nil)
 		c.JSON(http.StatusOK, gin.H{"signal": sig.Signal})
 	}
 
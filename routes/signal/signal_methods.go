@@ -85,27 +85,9 @@ func (s *Signal) update(modifiedSignal Signal) error {
 
 func (s *Signal) delete() error {
 
+	// Delete signal, the component configuration ID is kept to restore the signal from the trash
 	db := database.GetDB()
-	var err error
-	var m database.ComponentConfiguration
-	err = db.Find(&m, s.ConfigID).Error
-	if err != nil {
-		return err
-	}
-
-	// remove association between Signal and ComponentConfiguration
-	if s.Direction == "in" {
-		err = db.Model(&m).Association("InputMapping").Delete(s).Error
-	} else {
-		err = db.Model(&m).Association("OutputMapping").Delete(s).Error
-	}
-
-	if err != nil {
-		return err
-	}
-
-	// Delete signal
-	err = db.Delete(s).Error
+	err := db.Delete(s).Error
 
 	return err
 }
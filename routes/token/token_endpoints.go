@@ -0,0 +1,147 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package token
+
+import (
+	"net/http"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAPITokenEndpoints(r *gin.RouterGroup) {
+	r.GET("", getAPITokens)
+	r.POST("", addAPIToken)
+	r.DELETE("/:tokenID", revokeAPIToken)
+}
+
+// getAPITokens godoc
+// @Summary Get the API tokens of the requesting user
+// @ID getAPITokens
+// @Produce  json
+// @Tags tokens
+// @Success 200 {object} api.ResponseAPITokens "API tokens of the user"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Router /tokens [get]
+// @Security Bearer
+func getAPITokens(c *gin.Context) {
+
+	ok, _ := database.CheckAPITokenPermissions(c, database.Read, "none", -1)
+	if !ok {
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+
+	db := database.GetDB()
+	var tokens []database.APIToken
+	err := db.Order("ID asc").Where("user_id = ?", userID.(uint)).Find(&tokens).Error
+	if !helper.DBError(c, err) {
+		c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+	}
+}
+
+// addAPIToken godoc
+// @Summary Create an API token for the requesting user, the token is only returned once
+// @ID addAPIToken
+// @Accept json
+// @Produce json
+// @Tags tokens
+// @Success 200 {object} api.ResponseNewAPIToken "API token that was created and its secret"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param inputToken body token.addAPITokenRequest true "API token to be created"
+// @Router /tokens [post]
+// @Security Bearer
+func addAPIToken(c *gin.Context) {
+
+	ok, _ := database.CheckAPITokenPermissions(c, database.Create, "none", -1)
+	if !ok {
+		return
+	}
+
+	var req addAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.BadRequestError(c, err.Error())
+		return
+	}
+
+	// Validate the request
+	if err := req.validate(); err != nil {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	}
+
+	// Tokens can only be limited to scenarios the user has access to
+	if req.Token.Scope == database.TokenScopeScenario {
+		ok, _ := database.CheckScenarioPermissions(c, database.Read, "body", int(req.Token.ScenarioID))
+		if !ok {
+			return
+		}
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+
+	newToken, secret, err := req.createAPIToken(userID.(uint))
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
+		return
+	}
+
+	err = newToken.save()
+	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelAPIToken, newToken.ID, newToken.ScenarioID, nil, newToken.APIToken)
+		c.JSON(http.StatusOK, gin.H{"token": newToken.APIToken, "secret": secret})
+	}
+}
+
+// revokeAPIToken godoc
+// @Summary Revoke an API token
+// @ID revokeAPIToken
+// @Produce json
+// @Tags tokens
+// @Success 200 {object} api.ResponseAPIToken "API token that was revoked"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param tokenID path int true "API token ID"
+// @Router /tokens/{tokenID} [delete]
+// @Security Bearer
+func revokeAPIToken(c *gin.Context) {
+
+	ok, t_r := database.CheckAPITokenPermissions(c, database.Delete, "path", -1)
+	if !ok {
+		return
+	}
+
+	var t APIToken
+	t.APIToken = t_r
+
+	err := t.revoke()
+	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelAPIToken, t.ID, t.ScenarioID, t.APIToken, nil)
+		c.JSON(http.StatusOK, gin.H{"token": t.APIToken})
+	}
+}
@@ -0,0 +1,39 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package token
+
+import (
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+)
+
+type APIToken struct {
+	database.APIToken
+}
+
+func (t *APIToken) save() error {
+	db := database.GetDB()
+	err := db.Create(t).Error
+	return err
+}
+
+// revoke deletes the token so that it is no longer accepted
+func (t *APIToken) revoke() error {
+	db := database.GetDB()
+	err := db.Delete(t).Error
+	return err
+}
@@ -0,0 +1,216 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	infrastructure_component "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/infrastructure-component"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var router *gin.Engine
+
+type TokenRequest struct {
+	Name       string     `json:"name,omitempty"`
+	Scope      string     `json:"scope,omitempty"`
+	ScenarioID uint       `json:"scenarioID,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+type ScenarioRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+func TestMain(m *testing.M) {
+	err := configuration.InitConfig()
+	if err != nil {
+		panic(m)
+	}
+
+	err = database.InitDB(configuration.GlobalConfig, true)
+	if err != nil {
+		panic(m)
+	}
+	defer database.DBpool.Close()
+
+	router = gin.Default()
+	api := router.Group("/api/v2")
+
+	user.RegisterAuthenticate(api.Group("/authenticate"))
+	api.Use(user.Authentication())
+	user.RegisterUserEndpoints(api.Group("/users"))
+	scenario.RegisterScenarioEndpoints(api.Group("/scenarios"))
+	infrastructure_component.RegisterICEndpoints(api.Group("/ic"))
+	RegisterAPITokenEndpoints(api.Group("/tokens"))
+
+	os.Exit(m.Run())
+}
+
+// addToken creates an API token and returns its ID and secret
+func addToken(t *testing.T, token string, req TokenRequest) (int, string) {
+	code, resp, err := helper.TestEndpoint(router, token,
+		"/api/v2/tokens", "POST", helper.KeyModels{"token": req})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	var body struct {
+		Token  database.APIToken `json:"token"`
+		Secret string            `json:"secret"`
+	}
+	err = json.Unmarshal(resp.Bytes(), &body)
+	assert.NoError(t, err)
+	assert.Equal(t, database.APITokenPrefixOf(body.Secret), body.Token.Prefix)
+
+	return int(body.Token.ID), body.Secret
+}
+
+func TestAPITokens(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// authenticate as normal user
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+
+	// add two scenarios
+	var scenarioIDs []int
+	for _, name := range []string{"Scenario1", "Scenario2"} {
+		code, resp, err := helper.TestEndpoint(router, token,
+			"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": ScenarioRequest{Name: name}})
+		assert.NoError(t, err)
+		assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+		id, err := helper.GetResponseID(resp)
+		assert.NoError(t, err)
+		scenarioIDs = append(scenarioIDs, id)
+	}
+
+	// try to add invalid tokens
+	// should return unprocessable entity errors
+	past := time.Now().Add(-time.Hour)
+	for _, req := range []TokenRequest{
+		{Name: "no scenario", Scope: database.TokenScopeScenario},
+		{Name: "unknown scope", Scope: "everything"},
+		{Name: "expired", Scope: database.TokenScopeReadOnly, ExpiresAt: &past},
+	} {
+		code, resp, err := helper.TestEndpoint(router, token,
+			"/api/v2/tokens", "POST", helper.KeyModels{"token": req})
+		assert.NoError(t, err)
+		assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+	}
+
+	readOnlyID, readOnly := addToken(t, token, TokenRequest{Name: "notebook", Scope: database.TokenScopeReadOnly})
+	_, scenarioOnly := addToken(t, token, TokenRequest{Name: "ci", Scope: database.TokenScopeScenario, ScenarioID: uint(scenarioIDs[0])})
+	_, icActions := addToken(t, token, TokenRequest{Name: "controller", Scope: database.TokenScopeICActions})
+
+	numberOfTokens, err := helper.LengthOfResponse(router, token,
+		"/api/v2/tokens", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, numberOfTokens)
+
+	// read-only tokens can read but not modify
+	numberOfScenarios, err := helper.LengthOfResponse(router, readOnly,
+		"/api/v2/scenarios", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, numberOfScenarios)
+
+	code, resp, err := helper.TestEndpoint(router, readOnly,
+		fmt.Sprintf("/api/v2/scenarios/%v", scenarioIDs[0]), "PUT", helper.KeyModels{"scenario": ScenarioRequest{Name: "Renamed"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// tokens cannot be used to manage tokens or to update users
+	code, resp, err = helper.TestEndpoint(router, readOnly,
+		"/api/v2/tokens", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, readOnly,
+		"/api/v2/users/2", "PUT", helper.KeyModels{"user": map[string]string{"mail": "new@mail.com"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 403, code, "Response body: \n%v\n", resp)
+
+	// scenario tokens are limited to their scenario
+	numberOfScenarios, err = helper.LengthOfResponse(router, scenarioOnly,
+		"/api/v2/scenarios", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numberOfScenarios)
+
+	code, resp, err = helper.TestEndpoint(router, scenarioOnly,
+		fmt.Sprintf("/api/v2/scenarios/%v", scenarioIDs[0]), "PUT", helper.KeyModels{"scenario": ScenarioRequest{Name: "Renamed"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, scenarioOnly,
+		fmt.Sprintf("/api/v2/scenarios/%v", scenarioIDs[1]), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, scenarioOnly,
+		"/api/v2/scenarios", "POST", helper.KeyModels{"scenario": ScenarioRequest{Name: "Scenario3"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// IC action tokens can read ICs but not scenarios
+	code, resp, err = helper.TestEndpoint(router, icActions,
+		"/api/v2/ic", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, icActions,
+		"/api/v2/scenarios", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// revoked and unknown tokens are rejected
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/tokens/%v", readOnlyID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, readOnly,
+		"/api/v2/scenarios", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, database.APITokenPrefix+"unknown",
+		"/api/v2/scenarios", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// tokens of user A cannot be revoked by user B
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/tokens/%v", readOnlyID+1), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+}
@@ -0,0 +1,78 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package token
+
+import (
+	"fmt"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+var validate *validator.Validate
+
+type validNewAPIToken struct {
+	Name       string     `form:"Name" validate:"required"`
+	Scope      string     `form:"Scope" validate:"required,oneof=read-only scenario ic-actions"`
+	ScenarioID uint       `form:"ScenarioID" validate:"omitempty"`
+	ExpiresAt  *time.Time `form:"ExpiresAt" validate:"omitempty"`
+}
+
+type addAPITokenRequest struct {
+	Token validNewAPIToken `json:"token"`
+}
+
+func (r *addAPITokenRequest) validate() error {
+	validate = validator.New()
+	errs := validate.Struct(r)
+	if errs != nil {
+		return errs
+	}
+
+	if r.Token.Scope == database.TokenScopeScenario && r.Token.ScenarioID == 0 {
+		return fmt.Errorf("tokens of scope %v require a scenarioID", database.TokenScopeScenario)
+	} else if r.Token.Scope != database.TokenScopeScenario && r.Token.ScenarioID != 0 {
+		return fmt.Errorf("only tokens of scope %v can be limited to a scenario", database.TokenScopeScenario)
+	}
+
+	if r.Token.ExpiresAt != nil && r.Token.ExpiresAt.Before(time.Now()) {
+		return fmt.Errorf("expiration time is in the past")
+	}
+
+	return nil
+}
+
+func (r *addAPITokenRequest) createAPIToken(userID uint) (APIToken, string, error) {
+	var t APIToken
+
+	secret, hash, err := database.NewAPITokenSecret()
+	if err != nil {
+		return t, "", err
+	}
+
+	t.UserID = userID
+	t.Name = r.Token.Name
+	t.Hash = hash
+	t.Prefix = database.APITokenPrefixOf(secret)
+	t.Scope = r.Token.Scope
+	t.ScenarioID = r.Token.ScenarioID
+	t.ExpiresAt = r.Token.ExpiresAt
+
+	return t, secret, nil
+}
@@ -0,0 +1,153 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package trash
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterTrashEndpoints(r *gin.RouterGroup) {
+	r.GET("", getTrash)
+	r.DELETE("", purgeTrash)
+	r.POST("/:model/:id/restore", restoreFromTrash)
+}
+
+// getTrash godoc
+// @Summary Get the deleted items which can be restored, admins get the items of all scenarios
+// @ID getTrash
+// @Produce  json
+// @Tags trash
+// @Success 200 {object} api.ResponseTrash "Items in the trash"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Router /trash [get]
+// @Security Bearer
+func getTrash(c *gin.Context) {
+
+	err := database.ValidateRole(c, database.ModelTrash, database.Read)
+	if err != nil {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	}
+
+	// ATTENTION: do not use c.GetInt (common.UserIDCtx) since userID is of type uint and not int
+	userID, _ := c.Get(database.UserIDCtx)
+	var u database.User
+	err = database.GetDB().Find(&u, userID.(uint)).Error
+	if helper.DBNotFoundError(c, err, strconv.FormatUint(uint64(userID.(uint)), 10), "User") {
+		return
+	}
+
+	memberID := u.ID
+	if u.Role == "Admin" {
+		memberID = 0
+	}
+
+	items, err := getItems(memberID, database.TokenScenarioID(c))
+	if !helper.DBError(c, err) {
+		c.JSON(http.StatusOK, gin.H{"trash": items})
+	}
+}
+
+// restoreFromTrash godoc
+// @Summary Restore a deleted item together with the children which were deleted with it
+// @ID restoreFromTrash
+// @Produce  json
+// @Tags trash
+// @Success 200 {object} api.ResponseRestored "Restored item and number of restored rows per model"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 404 {object} api.ResponseError "Not found"
+// @Failure 409 {object} api.ResponseError "Parent of the item is in the trash"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Param model path string true "Model of the item" Enums(scenario, dashboard, widget, component-configuration, signal, file, result)
+// @Param id path int true "ID of the item"
+// @Router /trash/{model}/{id}/restore [post]
+// @Security Bearer
+func restoreFromTrash(c *gin.Context) {
+
+	m, ok := models[database.ModelName(c.Param("model"))]
+	if !ok {
+		helper.NotFoundError(c, fmt.Sprintf("Items of model %v cannot be restored", c.Param("model")))
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		helper.BadRequestError(c, fmt.Sprintf("Invalid ID: %v", c.Param("id")))
+		return
+	}
+
+	item, err := getItem(m, uint(id))
+	if helper.DBNotFoundError(c, err, c.Param("id"), "Trash item") {
+		return
+	}
+
+	if !database.CheckRestorePermissions(c, m.name, item.ScenarioID) {
+		return
+	}
+
+	if item.ParentDeletedAt != nil {
+		helper.ConflictError(c, fmt.Sprintf("The parent of the %v is in the trash, restore it first", m.name))
+		return
+	}
+
+	restored, err := restore(item)
+	if helper.DBError(c, err) {
+		return
+	}
+
+	database.Audit(c, database.Create, m.name, item.ID, item.ScenarioID, nil, item)
+	c.JSON(http.StatusOK, gin.H{"item": item, "restored": restored})
+}
+
+// purgeTrash godoc
+// @Summary Permanently delete the items which are in the trash for longer than the retention time (admin only)
+// @ID purgeTrash
+// @Produce  json
+// @Tags trash
+// @Success 200 {object} api.ResponseJob "Job purging the trash"
+// @Failure 422 {object} api.ResponseError "Unprocessable entity"
+// @Failure 500 {object} api.ResponseError "Internal server error"
+// @Router /trash [delete]
+// @Security Bearer
+func purgeTrash(c *gin.Context) {
+
+	err := database.ValidateRole(c, database.ModelTrash, database.Delete)
+	if err != nil {
+		helper.UnprocessableEntityError(c, err.Error())
+		return
+	}
+
+	userID, _ := c.Get(database.UserIDCtx)
+	job, err := SubmitPurge(userID.(uint))
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
+		return
+	}
+
+	database.Audit(c, database.Create, database.ModelJob, job.ID, job.ScenarioID, nil, job)
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
@@ -0,0 +1,389 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package trash
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
+	"github.com/jinzhu/gorm"
+)
+
+// PurgeJob is the type of the jobs removing expired items from the trash
+const PurgeJob = "trash-purge"
+
+// Item is a soft-deleted row in the trash
+type Item struct {
+	// Model of the item
+	Model database.ModelName `json:"model"`
+	// ID of the item
+	ID uint `json:"id"`
+	// Name (or description) of the item
+	Name string `json:"name"`
+	// ID of the scenario the item belongs to
+	ScenarioID uint `json:"scenarioID"`
+	// Time at which the item was deleted
+	DeletedAt time.Time `json:"deletedAt"`
+	// Time at which the parent of the item was deleted, nil if the parent is not in the trash
+	ParentDeletedAt *time.Time `json:"-"`
+}
+
+// trashModel describes the table of a model whose rows can be restored from the trash
+type trashModel struct {
+	name       database.ModelName
+	table      string
+	nameColumn string
+	// table of the parent and the column of the table referencing it, empty for scenarios
+	parentTable  string
+	parentColumn string
+	// models whose rows reference rows of this model and are deleted with them
+	children []database.ModelName
+}
+
+var models = map[database.ModelName]trashModel{
+	database.ModelScenario: {
+		name: database.ModelScenario, table: "scenarios", nameColumn: "name",
+		children: []database.ModelName{database.ModelFile, database.ModelResult, database.ModelDashboard, database.ModelComponentConfiguration},
+	},
+	database.ModelDashboard: {
+		name: database.ModelDashboard, table: "dashboards", nameColumn: "name",
+		parentTable: "scenarios", parentColumn: "scenario_id",
+		children: []database.ModelName{database.ModelWidget},
+	},
+	database.ModelWidget: {
+		name: database.ModelWidget, table: "widgets", nameColumn: "name",
+		parentTable: "dashboards", parentColumn: "dashboard_id",
+	},
+	database.ModelComponentConfiguration: {
+		name: database.ModelComponentConfiguration, table: "component_configurations", nameColumn: "name",
+		parentTable: "scenarios", parentColumn: "scenario_id",
+		children: []database.ModelName{database.ModelSignal},
+	},
+	database.ModelSignal: {
+		name: database.ModelSignal, table: "signals", nameColumn: "name",
+		parentTable: "component_configurations", parentColumn: "config_id",
+	},
+	database.ModelFile: {
+		name: database.ModelFile, table: "files", nameColumn: "name",
+		parentTable: "scenarios", parentColumn: "scenario_id",
+	},
+	database.ModelResult: {
+		name: database.ModelResult, table: "results", nameColumn: "description",
+		parentTable: "scenarios", parentColumn: "scenario_id",
+	},
+}
+
+// purgeOrder lists the models in the order in which their rows are purged, children before parents
+var purgeOrder = []database.ModelName{
+	database.ModelWidget,
+	database.ModelSignal,
+	database.ModelDashboard,
+	database.ModelComponentConfiguration,
+	database.ModelFile,
+	database.ModelResult,
+	database.ModelScenario,
+}
+
+// query returns the SQL query of the items of the model in the trash
+func (m trashModel) query() string {
+	if m.parentTable == "" {
+		return fmt.Sprintf("SELECT t.id, t.%v AS name, t.id AS scenario_id, t.deleted_at, "+
+			"CAST(NULL AS timestamp with time zone) AS parent_deleted_at FROM %v t WHERE t.deleted_at IS NOT NULL",
+			m.nameColumn, m.table)
+	}
+
+	scenarioID := "p.scenario_id"
+	if m.parentTable == "scenarios" {
+		scenarioID = "p.id"
+	}
+	return fmt.Sprintf("SELECT t.id, t.%v AS name, %v AS scenario_id, t.deleted_at, p.deleted_at AS parent_deleted_at "+
+		"FROM %v t JOIN %v p ON p.id = t.%v WHERE t.deleted_at IS NOT NULL",
+		m.nameColumn, scenarioID, m.table, m.parentTable, m.parentColumn)
+}
+
+// getItems returns the items in the trash which can be restored, i.e. whose parent is not in the trash;
+// the items are limited to the scenarios of the user unless userID is 0 and to the scenario if scenarioID is not 0
+func getItems(userID uint, scenarioID uint) ([]Item, error) {
+	var items []Item
+	for _, name := range purgeOrder {
+		m := models[name]
+
+		query := "SELECT * FROM (" + m.query() + ") items WHERE parent_deleted_at IS NULL"
+		var args []interface{}
+		if userID != 0 {
+			query += " AND scenario_id IN (SELECT scenario_id FROM user_scenarios WHERE user_id = ?)"
+			args = append(args, userID)
+		}
+		if scenarioID != 0 {
+			query += " AND scenario_id = ?"
+			args = append(args, scenarioID)
+		}
+
+		var modelItems []Item
+		err := database.GetDB().Raw(query, args...).Scan(&modelItems).Error
+		if err != nil {
+			return nil, err
+		}
+		for i := range modelItems {
+			modelItems[i].Model = name
+		}
+		items = append(items, modelItems...)
+	}
+
+	return items, nil
+}
+
+// getItem returns the item of the model with the ID from the trash
+func getItem(m trashModel, id uint) (Item, error) {
+	var items []Item
+	err := database.GetDB().Raw(m.query()+" AND t.id = ?", id).Scan(&items).Error
+	if err != nil {
+		return Item{}, err
+	}
+	if len(items) == 0 {
+		return Item{}, gorm.ErrRecordNotFound
+	}
+
+	items[0].Model = m.name
+	return items[0], nil
+}
+
+// restore restores the item with all children which were deleted together with it in one transaction;
+// it returns the number of restored rows per model
+func restore(item Item) (map[database.ModelName]int, error) {
+	restored := map[database.ModelName]int{}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		return restoreRows(tx, models[item.Model], []uint{item.ID}, restored)
+	})
+	return restored, err
+}
+
+// restoreRows restores the rows of the model with the IDs and their children with the same deletion time
+func restoreRows(tx *gorm.DB, m trashModel, ids []uint, restored map[database.ModelName]int) error {
+	for _, id := range ids {
+		var deletedAt []time.Time
+		err := tx.Table(m.table).Where("id = ? AND deleted_at IS NOT NULL", id).Pluck("deleted_at", &deletedAt).Error
+		if err != nil {
+			return err
+		}
+		if len(deletedAt) == 0 {
+			continue
+		}
+
+		err = tx.Exec("UPDATE "+m.table+" SET deleted_at = NULL WHERE id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		restored[m.name]++
+
+		for _, name := range m.children {
+			child := models[name]
+			var childIDs []uint
+			err = tx.Table(child.table).Where(child.parentColumn+" = ? AND deleted_at = ?", id, deletedAt[0]).
+				Pluck("id", &childIDs).Error
+			if err != nil {
+				return err
+			}
+
+			err = restoreRows(tx, child, childIDs, restored)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = restoreReferences(tx, m, id, deletedAt[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreReferences restores the rows which are not children of the restored row but were deleted with it:
+// the files of results and the ICs which were deleted with their last component configuration
+func restoreReferences(tx *gorm.DB, m trashModel, id uint, deletedAt time.Time) error {
+	switch m.name {
+	case database.ModelResult:
+		var r database.Result
+		err := tx.Find(&r, id).Error
+		if err != nil {
+			return err
+		}
+		if len(r.ResultFileIDs) == 0 {
+			return nil
+		}
+		return tx.Exec("UPDATE files SET deleted_at = NULL WHERE id IN (?) AND deleted_at IS NOT NULL", []int64(r.ResultFileIDs)).Error
+	case database.ModelComponentConfiguration:
+		return tx.Exec("UPDATE infrastructure_components SET deleted_at = NULL WHERE id = "+
+			"(SELECT ic_id FROM component_configurations WHERE id = ?) AND deleted_at = ?", id, deletedAt).Error
+	}
+	return nil
+}
+
+func retention() (time.Duration, error) {
+	retention, _ := configuration.GlobalConfig.String("trashretention")
+	d, err := time.ParseDuration(retention)
+	if err != nil {
+		return 0, fmt.Errorf("no or erroneous trash retention parameter provided in API config")
+	}
+	return d, nil
+}
+
+// purge permanently deletes all items which were deleted before the time; it returns the IDs
+// of the deleted rows per model
+func purge(ctx context.Context, before time.Time) (map[database.ModelName][]uint, error) {
+	purged := map[database.ModelName][]uint{}
+	var files []database.File
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// the data of the files is deleted once the files are deleted
+		err := tx.Unscoped().Where("deleted_at < ?", before).Find(&files).Error
+		if err != nil {
+			return err
+		}
+
+		// the members of scenarios are kept in the trash to restore the scenarios
+		err = tx.Exec("DELETE FROM user_scenarios WHERE scenario_id IN "+
+			"(SELECT id FROM scenarios WHERE deleted_at < ?)", before).Error
+		if err != nil {
+			return err
+		}
+
+		for _, name := range purgeOrder {
+			ids, err := deleteReturningIDs(tx, "DELETE FROM "+models[name].table+" WHERE deleted_at < ?", before)
+			if err != nil {
+				return err
+			}
+			purged[name] = ids
+		}
+
+		return purgeICs(tx, before, purged)
+	})
+	if err != nil {
+		return purged, err
+	}
+
+	if len(files) > 0 {
+		storage, err := database.GetFileStorage()
+		if err != nil {
+			return purged, err
+		}
+		for _, f := range files {
+			// the data is kept as long as other files reference it
+			err = storage.DeleteData(ctx, &f)
+			if err != nil {
+				log.Printf("Failed to delete the data of purged file %v: %v", f.ID, err)
+			}
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeICs permanently deletes the ICs which were deleted before the time and are not referenced by
+// any component configuration left in the trash, together with their actions, reservations and states;
+// the IDs of the deleted ICs and actions are added to purged
+func purgeICs(tx *gorm.DB, before time.Time, purged map[database.ModelName][]uint) error {
+	var ids []uint
+	err := tx.Table("infrastructure_components").Where("deleted_at < ? AND id NOT IN "+
+		"(SELECT ic_id FROM component_configurations WHERE ic_id IS NOT NULL)", before).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	purged[database.ModelInfrastructureComponentAction], err = deleteReturningIDs(tx,
+		"DELETE FROM ic_actions WHERE ic_id IN (?)", ids)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"reservations", "ic_state_samples"} {
+		err = tx.Exec("DELETE FROM "+table+" WHERE ic_id IN (?)", ids).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	purged[database.ModelInfrastructureComponent], err = deleteReturningIDs(tx,
+		"DELETE FROM infrastructure_components WHERE id IN (?)", ids)
+	return err
+}
+
+// deleteReturningIDs executes a DELETE statement and returns the IDs of the deleted rows
+func deleteReturningIDs(tx *gorm.DB, sql string, values ...interface{}) ([]uint, error) {
+	rows, err := tx.Raw(sql+" RETURNING id", values...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SubmitPurge submits a job which permanently deletes the items which are in the trash for longer than the retention time
+func SubmitPurge(userID uint) (database.Job, error) {
+	d, err := retention()
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	return jobs.Submit(PurgeJob, userID, 0, func(ctx context.Context, j *jobs.Job) error {
+		purged, err := purge(ctx, time.Now().Add(-d))
+		if err != nil {
+			return err
+		}
+
+		// the deleted rows are recorded since they can no longer be restored
+		counts := map[database.ModelName]int{}
+		for name, ids := range purged {
+			counts[name] = len(ids)
+			if len(ids) > 0 {
+				database.AuditPurgedRows(userID, name, ids)
+			}
+		}
+		return j.SetResult(counts)
+	})
+}
+
+// PurgePeriodically submits a purge job every d
+func PurgePeriodically(d time.Duration) {
+
+	go func() {
+
+		for range time.Tick(d) {
+			_, err := SubmitPurge(0)
+			if err != nil {
+				log.Println("Error purging trash:", err.Error())
+			}
+		}
+	}()
+}
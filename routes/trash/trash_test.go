@@ -0,0 +1,341 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/dashboard"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/scenario"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/widget"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var router *gin.Engine
+
+type ScenarioRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+type DashboardRequest struct {
+	Name       string `json:"name,omitempty"`
+	Grid       int    `json:"grid,omitempty"`
+	ScenarioID uint   `json:"scenarioID,omitempty"`
+}
+
+type WidgetRequest struct {
+	Name        string `json:"name,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Width       uint   `json:"width,omitempty"`
+	Height      uint   `json:"height,omitempty"`
+	DashboardID uint   `json:"dashboardID,omitempty"`
+}
+
+func TestMain(m *testing.M) {
+	err := configuration.InitConfig()
+	if err != nil {
+		panic(m)
+	}
+
+	err = database.InitDB(configuration.GlobalConfig, true)
+	if err != nil {
+		panic(m)
+	}
+	defer database.DBpool.Close()
+
+	router = gin.Default()
+	api := router.Group("/api/v2")
+
+	user.RegisterAuthenticate(api.Group("/authenticate"))
+	api.Use(user.Authentication())
+	scenario.RegisterScenarioEndpoints(api.Group("/scenarios"))
+	dashboard.RegisterDashboardEndpoints(api.Group("/dashboards"))
+	widget.RegisterWidgetEndpoints(api.Group("/widgets"))
+	RegisterTrashEndpoints(api.Group("/trash"))
+
+	os.Exit(m.Run())
+}
+
+func create(t *testing.T, token string, url string, model string, request interface{}) uint {
+	code, resp, err := helper.TestEndpoint(router, token, url, "POST", helper.KeyModels{model: request})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	id, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+	return uint(id)
+}
+
+func getTrashItems(t *testing.T, token string) []Item {
+	code, resp, err := helper.TestEndpoint(router, token, "/api/v2/trash", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	var trash struct {
+		Trash []Item `json:"trash"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &trash))
+	return trash.Trash
+}
+
+func TestTrash(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+	tokenB, err := helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+	adminToken, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+
+	// create a scenario with a dashboard containing a widget as user A
+	scenarioID := create(t, token, "/api/v2/scenarios", "scenario", ScenarioRequest{Name: "Scenario1"})
+	dashboardID := create(t, token, "/api/v2/dashboards", "dashboard",
+		DashboardRequest{Name: "Dashboard1", Grid: 15, ScenarioID: scenarioID})
+	widgetID := create(t, token, "/api/v2/widgets", "widget",
+		WidgetRequest{Name: "Widget1", Type: "Label", Width: 100, Height: 100, DashboardID: dashboardID})
+
+	// delete the dashboard, the widget is deleted with it
+	code, resp, err := helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/dashboards/%v", dashboardID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// only the dashboard is listed, the widget is restored with it
+	items := getTrashItems(t, token)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, database.ModelDashboard, items[0].Model)
+		assert.Equal(t, dashboardID, items[0].ID)
+		assert.Equal(t, "Dashboard1", items[0].Name)
+		assert.Equal(t, scenarioID, items[0].ScenarioID)
+	}
+
+	// user B is no member of the scenario
+	assert.Len(t, getTrashItems(t, tokenB), 0)
+	code, resp, err = helper.TestEndpoint(router, tokenB,
+		fmt.Sprintf("/api/v2/trash/dashboard/%v/restore", dashboardID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	// the widget cannot be restored while its dashboard is in the trash
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/trash/widget/%v/restore", widgetID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 409, code, "Response body: \n%v\n", resp)
+
+	// unknown models and items which are not in the trash
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/trash/user/%v/restore", 2), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 404, code, "Response body: \n%v\n", resp)
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/trash/scenario/%v/restore", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 404, code, "Response body: \n%v\n", resp)
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/trash/dashboard/abc/restore", "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	// restore the dashboard together with its widget
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/trash/dashboard/%v/restore", dashboardID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"restored": map[string]int{"dashboard": 1, "widget": 1}})
+	assert.NoError(t, err)
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/widgets/%v", widgetID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	assert.Len(t, getTrashItems(t, token), 0)
+
+	// delete the whole scenario, only the scenario is listed
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/scenarios/%v", scenarioID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	items = getTrashItems(t, token)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, database.ModelScenario, items[0].Model)
+		assert.Equal(t, scenarioID, items[0].ID)
+	}
+	assert.Len(t, getTrashItems(t, adminToken), 1)
+
+	// restore the scenario, its members, dashboards and widgets
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/trash/scenario/%v/restore", scenarioID), "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/widgets/%v", widgetID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// delete the widget and let it expire
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/widgets/%v", widgetID), "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	db := database.GetDB()
+	d, err := retention()
+	assert.NoError(t, err)
+	err = db.Exec("UPDATE widgets SET deleted_at = ? WHERE id = ?", time.Now().Add(-d-time.Hour), widgetID).Error
+	assert.NoError(t, err)
+
+	// only admins can purge the trash
+	code, resp, err = helper.TestEndpoint(router, token, "/api/v2/trash", "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 422, code, "Response body: \n%v\n", resp)
+
+	code, resp, err = helper.TestEndpoint(router, adminToken, "/api/v2/trash", "DELETE", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	jobID, err := helper.GetResponseID(resp)
+	assert.NoError(t, err)
+
+	jobs.Wait()
+
+	var job database.Job
+	assert.NoError(t, db.Find(&job, jobID).Error)
+	assert.Equal(t, jobs.StateSucceeded, job.State, job.Error)
+	assert.Equal(t, PurgeJob, job.Type)
+
+	var count int
+	assert.NoError(t, db.Unscoped().Model(&database.Widget{}).Where("id = ?", widgetID).Count(&count).Error)
+	assert.Equal(t, 0, count)
+	assert.Len(t, getTrashItems(t, token), 0)
+
+	// the purge job and the purged widget are recorded in the audit log
+	assert.NoError(t, db.Model(&database.AuditEntry{}).Where("operation = ? AND model_name = ? AND object_id = ?",
+		database.Create, database.ModelJob, jobID).Count(&count).Error)
+	assert.Equal(t, 1, count)
+	var entry database.AuditEntry
+	assert.NoError(t, db.Where("operation = ? AND model_name = ?", database.AuditPurge, database.ModelWidget).First(&entry).Error)
+	assert.Equal(t, job.UserID, entry.UserID)
+	assert.Equal(t, "Admin", entry.Role)
+	var purged struct {
+		IDs   []uint `json:"ids"`
+		Count int    `json:"count"`
+	}
+	assert.NoError(t, json.Unmarshal(entry.Diff.RawMessage, &purged))
+	assert.Equal(t, []uint{uint(widgetID)}, purged.IDs)
+	assert.Equal(t, 1, purged.Count)
+
+	// the dashboard and scenario are untouched
+	code, resp, err = helper.TestEndpoint(router, token,
+		fmt.Sprintf("/api/v2/dashboards/%v", dashboardID), "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+}
+
+// deletedData records the files whose data is deleted
+type deletedData struct {
+	files []database.File
+}
+
+func (s *deletedData) CopyData(ctx context.Context, f *database.File) error {
+	return nil
+}
+
+func (s *deletedData) DeleteData(ctx context.Context, f *database.File) error {
+	s.files = append(s.files, *f)
+	return nil
+}
+
+func TestPurgeFilesAndICs(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	storage := &deletedData{}
+	database.SetFileStorage(storage)
+	defer database.SetFileStorage(nil)
+
+	db := database.GetDB()
+	d, err := retention()
+	assert.NoError(t, err)
+	expired := time.Now().Add(-d - time.Hour)
+
+	so := database.Scenario{Name: "Scenario1"}
+	assert.NoError(t, db.Create(&so).Error)
+
+	// an expired file, a file deleted recently and a file which is not deleted
+	expiredFile := database.File{Name: "expired", Key: "key1", Storage: "local", ScenarioID: so.ID}
+	recentFile := database.File{Name: "recent", Key: "key2", Storage: "local", ScenarioID: so.ID}
+	keptFile := database.File{Name: "kept", Key: "key3", Storage: "local", ScenarioID: so.ID}
+	for _, f := range []*database.File{&expiredFile, &recentFile, &keptFile} {
+		assert.NoError(t, db.Create(f).Error)
+	}
+	assert.NoError(t, db.Delete(&recentFile).Error)
+	assert.NoError(t, db.Exec("UPDATE files SET deleted_at = ? WHERE id = ?", expired, expiredFile.ID).Error)
+
+	// an expired IC, an expired IC still referenced by a configuration in the trash and an IC which is not deleted
+	expiredIC := database.InfrastructureComponent{UUID: "ic1", Name: "expired"}
+	referencedIC := database.InfrastructureComponent{UUID: "ic2", Name: "referenced"}
+	keptIC := database.InfrastructureComponent{UUID: "ic3", Name: "kept"}
+	for _, ic := range []*database.InfrastructureComponent{&expiredIC, &referencedIC, &keptIC} {
+		assert.NoError(t, db.Create(ic).Error)
+	}
+	config := database.ComponentConfiguration{Name: "config", ScenarioID: so.ID, ICID: referencedIC.ID}
+	assert.NoError(t, db.Create(&config).Error)
+	assert.NoError(t, db.Delete(&config).Error)
+	assert.NoError(t, db.Exec("UPDATE infrastructure_components SET deleted_at = ? WHERE id IN (?)",
+		expired, []uint{expiredIC.ID, referencedIC.ID}).Error)
+	sample := database.ICStateSample{ICID: expiredIC.ID, State: "running"}
+	assert.NoError(t, db.Create(&sample).Error)
+
+	purged, err := purge(context.Background(), time.Now().Add(-d))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{expiredFile.ID}, purged[database.ModelFile])
+	assert.Equal(t, []uint{expiredIC.ID}, purged[database.ModelInfrastructureComponent])
+
+	// only the data of the purged file is deleted
+	if assert.Len(t, storage.files, 1) {
+		assert.Equal(t, expiredFile.ID, storage.files[0].ID)
+		assert.Equal(t, "key1", storage.files[0].Key)
+	}
+
+	var count int
+	assert.NoError(t, db.Unscoped().Model(&database.File{}).Count(&count).Error)
+	assert.Equal(t, 2, count)
+
+	var icIDs []uint
+	assert.NoError(t, db.Unscoped().Model(&database.InfrastructureComponent{}).Order("id").Pluck("id", &icIDs).Error)
+	assert.Equal(t, []uint{referencedIC.ID, keptIC.ID}, icIDs)
+	assert.NoError(t, db.Model(&database.ICStateSample{}).Where("ic_id = ?", expiredIC.ID).Count(&count).Error)
+	assert.Equal(t, 0, count)
+}
@@ -46,6 +46,9 @@ type tokenClaims struct {
 
 func RegisterAuthenticate(r *gin.RouterGroup) {
 	r.GET("", authenticated)
+	r.GET("/oidc", startOIDC)
+	r.POST("/refresh", refresh)
+	r.POST("/logout", logout)
 	r.POST("/:mechanism", authenticate)
 }
 
@@ -110,7 +113,7 @@ func authenticated(c *gin.Context) {
 // @Produce json
 // @Tags authentication
 // @Param inputUser body user.loginRequest true "loginRequest of user"
-// @Param mechanism path string true "Login mechanism" Enums(internal, external)
+// @Param mechanism path string true "Login mechanism" Enums(internal, external, ldap, oidc)
 // @Success 200 {object} api.ResponseAuthenticate "JSON web token, success status, message and authenticated user object"
 // @Failure 401 {object} api.ResponseError "Unauthorized"
 // @Failure 500 {object} api.ResponseError "Internal server error."
@@ -139,6 +142,18 @@ func authenticate(c *gin.Context) {
 			helper.BadRequestError(c, "External authentication is not activated")
 			return
 		}
+	case "ldap":
+		myUser, err = authenticateLDAP(c)
+		if err != nil {
+			log.Println("LDAP auth. failed with error: ", err)
+			return
+		}
+	case "oidc":
+		myUser, err = authenticateOIDC(c)
+		if err != nil {
+			log.Println("OpenID Connect auth. failed with error: ", err)
+			return
+		}
 	default:
 		helper.BadRequestError(c, "Invalid authentication mechanism")
 		return
@@ -150,15 +165,109 @@ func authenticate(c *gin.Context) {
 		return
 	}
 
-	expiresStr, err := configuration.GlobalConfig.String("jwt.expires-after")
+	issueToken(c, myUser, "Authenticated")
+}
+
+// refresh godoc
+// @Summary Exchange a refresh token for a new JSON web token and refresh token
+// @ID refresh
+// @Accept json
+// @Produce json
+// @Tags authentication
+// @Param inputRefresh body user.refreshRequest true "Refresh token obtained at login or at the last refresh"
+// @Success 200 {object} api.ResponseAuthenticate "JSON web token, refresh token, success status, message and authenticated user object"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 401 {object} api.ResponseError "Unauthorized"
+// @Failure 500 {object} api.ResponseError "Internal server error."
+// @Router /authenticate/refresh [post]
+func refresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.BadRequestError(c, err.Error())
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		helper.BadRequestError(c, err.Error())
+		return
+	}
+
+	s, err := database.RefreshableSession(req.RefreshToken)
 	if err != nil {
-		helper.InternalServerError(c, "Invalid backend configuration: jwt.expires-after")
+		helper.UnauthorizedError(c, "Invalid, expired or revoked refresh token")
+		return
+	}
+
+	// a refresh token can only be used once, even by concurrent requests
+	revoked, err := database.RevokeRefreshedSession(s.ID)
+	if helper.DBError(c, err) {
+		return
+	}
+	if !revoked {
+		helper.UnauthorizedError(c, "Invalid, expired or revoked refresh token")
 		return
 	}
 
-	expiresDuration, err := time.ParseDuration(expiresStr)
+	var myUser User
+	err = myUser.byID(s.UserID)
+	if err != nil || !myUser.Active {
+		helper.UnauthorizedError(c, "User is not active")
+		return
+	}
+
+	issueToken(c, myUser, "Refreshed")
+}
+
+// logout godoc
+// @Summary Revoke the JSON web token and the refresh token of the current session
+// @ID logout
+// @Produce json
+// @Tags authentication
+// @Success 200 {object} api.ResponseAuthenticate "Success status and message"
+// @Failure 401 {object} api.ResponseError "Unauthorized"
+// @Failure 500 {object} api.ResponseError "Internal server error."
+// @Router /authenticate/logout [post]
+// @Security Bearer
+func logout(c *gin.Context) {
+	ok, err := isAuthenticated(c)
 	if err != nil {
-		helper.InternalServerError(c, "Invalid backend configuration: jwt.expires-after")
+		helper.UnauthorizedError(c, err.Error())
+		return
+	}
+	if !ok {
+		helper.UnauthorizedError(c, "Not authenticated")
+		return
+	}
+
+	sessionID, exists := c.Get(database.SessionIDCtx)
+	if !exists {
+		helper.BadRequestError(c, "Only sessions started by a login can be logged out")
+		return
+	}
+
+	err = database.RevokeSession(sessionID.(uint))
+	if helper.DBError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Logged out",
+	})
+}
+
+// issueToken starts a new session for the user and responds with its
+// JSON web token and refresh token
+func issueToken(c *gin.Context, myUser User, message string) {
+	expiresDuration, err := configDuration("jwt.expires-after")
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
+		return
+	}
+
+	refreshExpiresDuration, err := configDuration("jwt.refresh-expires-after")
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
 		return
 	}
 
@@ -168,12 +277,18 @@ func authenticate(c *gin.Context) {
 		return
 	}
 
+	s, refreshToken, err := database.NewSession(myUser.ID, expiresDuration, refreshExpiresDuration)
+	if helper.DBError(c, err) {
+		return
+	}
+
 	// Create authentication token
 	claims := tokenClaims{
 		myUser.ID,
 		myUser.Role,
 		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(expiresDuration).Unix(),
+			Id:        s.TokenID,
+			ExpiresAt: s.ExpiresAt.Unix(),
 			IssuedAt:  time.Now().Unix(),
 			Issuer:    "http://web.villas.fein-aachen.org/",
 		},
@@ -188,13 +303,28 @@ func authenticate(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Authenticated",
-		"token":   tokenString,
-		"user":    myUser.User,
+		"success":      true,
+		"message":      message,
+		"token":        tokenString,
+		"refreshToken": refreshToken,
+		"user":         myUser.User,
 	})
 }
 
+func configDuration(key string) (time.Duration, error) {
+	str, err := configuration.GlobalConfig.String(key)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid backend configuration: %v", key)
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid backend configuration: %v", key)
+	}
+
+	return d, nil
+}
+
 func authenticateInternal(c *gin.Context) (User, error) {
 	// Bind the response (context) with the loginRequest struct
 	var myUser User
@@ -244,20 +374,34 @@ func authenticateExternal(c *gin.Context) (User, error) {
 	groups := strings.Split(c.Request.Header.Get("X-Forwarded-Groups"), ",")
 	// preferred_username := c.Request.Header.Get("X-Forwarded-Preferred-Username")
 
+	myUser, err := externalUser(username, email, groups, "admin")
+	if err != nil {
+		helper.UnauthorizedAbort(c, "Authentication failed ("+err.Error()+")")
+		return myUser, err
+	}
+
+	return myUser, nil
+}
+
+// externalUser returns the user authenticated by an external identity
+// provider. The user is created on the first login and added to the
+// scenarios of its groups according to configuration.ScenarioGroupMap.
+func externalUser(username, email string, groups []string, adminGroup string) (User, error) {
+	var myUser User
+
 	// check if user already exists
 	err := myUser.byUsername(username)
 
 	if err != nil {
 		// this is the first login, create new user
 		role := "User"
-		if _, found := helper.Find(groups, "admin"); found {
+		if _, found := helper.Find(groups, adminGroup); found {
 			role = "Admin"
 		}
 
 		myUser, err = NewUser(username, "", email, role, true)
 		if err != nil {
-			helper.UnauthorizedAbort(c, "Authentication failed (failed to create new user: "+err.Error()+")")
-			return myUser, fmt.Errorf("failed to create new user")
+			return myUser, fmt.Errorf("failed to create new user: %v", err)
 		}
 
 		log.Printf("Created new external user %s (id=%d)", myUser.Username, myUser.ID)
@@ -277,14 +421,21 @@ func authenticateExternal(c *gin.Context) (User, error) {
 				}
 
 				if groupedScenario.Duplicate {
-					DuplicateScenarioForUser(so, &myUser.User, "")
-				} else { // add user to scenario
-					err = db.Model(&so).Association("Users").Append(&(myUser.User)).Error
+					_, err = SubmitScenarioDuplication(so, &myUser.User, "")
+					if err != nil {
+						log.Printf("Failed to duplicate scenario %s (id=%d) for user %s (id=%d): %s\n", so.Name, so.ID, myUser.Username, myUser.ID, err)
+					}
+				} else { // add user to scenario, as for user groups users are owners if no role is given
+					role := groupedScenario.Role
+					if role == "" {
+						role = database.ScenarioOwner
+					}
+					err = database.AddScenarioMember(so.ID, myUser.ID, role)
 					if err != nil {
 						log.Printf("Failed to add user %s (id=%d) to scenario %s (id=%d): %s\n", myUser.Username, myUser.ID, so.Name, so.ID, err)
 						continue
 					}
-					log.Printf("Added user %s (id=%d) to scenario %s (id=%d)", myUser.Username, myUser.ID, so.Name, so.ID)
+					log.Printf("Added user %s (id=%d) to scenario %s (id=%d) as %s", myUser.Username, myUser.ID, so.Name, so.ID, role)
 				}
 			}
 		}
@@ -0,0 +1,342 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package user
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Timeout of requests to the LDAP server
+const ldapTimeout = 10 * time.Second
+
+type ldapConfig struct {
+	URL             string
+	StartTLS        bool
+	BindDN          string
+	BindPass        string
+	UserBaseDN      string
+	UserAttribute   string
+	MailAttribute   string
+	GroupBaseDN     string
+	GroupAttribute  string
+	MemberAttribute string
+	AdminGroup      string
+}
+
+// ldapAccount is a user account found in the directory
+type ldapAccount struct {
+	Username string
+	Mail     string
+	// Groups of the user
+	Groups []string
+	// All groups of the directory
+	DirectoryGroups []string
+}
+
+func authenticateLDAP(c *gin.Context) (User, error) {
+	var myUser User
+
+	cfg, err := getLDAPConfig()
+	if err != nil {
+		helper.BadRequestError(c, err.Error())
+		return myUser, err
+	}
+
+	var credentials loginRequest
+	if err := c.ShouldBindJSON(&credentials); err != nil {
+		helper.UnauthorizedError(c, "Wrong username or password")
+		return myUser, err
+	}
+
+	if errs := credentials.validate(); errs != nil {
+		helper.UnauthorizedError(c, "Failed to validate request")
+		return myUser, errs
+	}
+
+	account, err := lookupLDAPAccount(cfg, credentials.Username, credentials.Password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		helper.UnauthorizedError(c, "Wrong username or password")
+		return myUser, err
+	} else if err != nil {
+		helper.InternalServerError(c, "Failed to query LDAP server")
+		return myUser, err
+	}
+
+	// do not let the directory take over accounts which log in with a password
+	err = myUser.byUsername(account.Username)
+	if err == nil && myUser.Password != "" {
+		helper.UnauthorizedError(c, "Authentication failed (username is taken by an internal user)")
+		return myUser, fmt.Errorf("username %v is taken by an internal user", account.Username)
+	}
+
+	myUser, err = externalUser(account.Username, account.Mail, account.Groups, cfg.AdminGroup)
+	if err != nil {
+		helper.UnauthorizedError(c, "Authentication failed ("+err.Error()+")")
+		return myUser, err
+	}
+
+	if myUser.Active {
+		err = myUser.syncUserGroups(account.Groups, account.DirectoryGroups)
+		if err != nil {
+			log.Printf("Failed to sync LDAP groups of user %s (id=%d): %v", myUser.Username, myUser.ID, err)
+		}
+	}
+
+	return myUser, nil
+}
+
+func getLDAPConfig() (ldapConfig, error) {
+	var cfg ldapConfig
+
+	enabled, err := configuration.GlobalConfig.Bool("auth.ldap.enabled")
+	if err != nil || !enabled {
+		return cfg, fmt.Errorf("LDAP authentication is not activated")
+	}
+
+	cfg.URL, _ = configuration.GlobalConfig.String("auth.ldap.url")
+	cfg.StartTLS, _ = configuration.GlobalConfig.Bool("auth.ldap.start-tls")
+	cfg.BindDN, _ = configuration.GlobalConfig.String("auth.ldap.bind-dn")
+	cfg.BindPass, _ = configuration.GlobalConfig.String("auth.ldap.bind-pass")
+	cfg.UserBaseDN, _ = configuration.GlobalConfig.String("auth.ldap.user-base-dn")
+	cfg.UserAttribute, _ = configuration.GlobalConfig.String("auth.ldap.user-attribute")
+	cfg.MailAttribute, _ = configuration.GlobalConfig.String("auth.ldap.mail-attribute")
+	cfg.GroupBaseDN, _ = configuration.GlobalConfig.String("auth.ldap.group-base-dn")
+	cfg.GroupAttribute, _ = configuration.GlobalConfig.String("auth.ldap.group-attribute")
+	cfg.MemberAttribute, _ = configuration.GlobalConfig.String("auth.ldap.member-attribute")
+	cfg.AdminGroup, _ = configuration.GlobalConfig.String("auth.ldap.admin-group")
+
+	if cfg.URL == "" || cfg.UserBaseDN == "" {
+		return cfg, fmt.Errorf("Invalid backend configuration: auth.ldap.url and auth.ldap.user-base-dn are required")
+	}
+
+	return cfg, nil
+}
+
+// dialLDAP connects to the LDAP server, connections to ldaps:// URLs are encrypted from the start,
+// other connections are upgraded with StartTLS if it is enabled
+func dialLDAP(cfg ldapConfig) (*ldap.Conn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL %v: %w", cfg.URL, err)
+	}
+
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if cfg.StartTLS && u.Scheme != "ldaps" {
+		err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// searchLDAP returns the entries below the base DN which match the filter
+func searchLDAP(conn *ldap.Conn, baseDN string, filter string, attributes []string) ([]*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout.Seconds()),
+		false, filter, attributes, nil)
+	result, err := conn.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// lookupLDAPAccount searches the user and its groups in the directory and
+// verifies the password of the user by binding as the user
+func lookupLDAPAccount(cfg ldapConfig, username, password string) (ldapAccount, error) {
+	var account ldapAccount
+
+	conn, err := dialLDAP(cfg)
+	if err != nil {
+		return account, err
+	}
+	defer conn.Close()
+
+	if cfg.BindDN != "" {
+		err = conn.Bind(cfg.BindDN, cfg.BindPass)
+		if err != nil {
+			return account, fmt.Errorf("failed to bind as %v: %w", cfg.BindDN, err)
+		}
+	}
+
+	users, err := searchLDAP(conn, cfg.UserBaseDN,
+		fmt.Sprintf("(%s=%s)", cfg.UserAttribute, ldap.EscapeFilter(username)),
+		[]string{cfg.UserAttribute, cfg.MailAttribute})
+	if err != nil {
+		return account, fmt.Errorf("failed to search user %v: %w", username, err)
+	}
+	if len(users) != 1 {
+		// do not disclose whether the user exists
+		return account, ldap.NewError(ldap.LDAPResultInvalidCredentials, fmt.Errorf("unknown user"))
+	}
+	entry := users[0]
+
+	account.Username = entry.GetAttributeValue(cfg.UserAttribute)
+	if account.Username == "" {
+		account.Username = username
+	}
+	account.Mail = entry.GetAttributeValue(cfg.MailAttribute)
+
+	if cfg.GroupBaseDN != "" {
+		groups, err := searchLDAP(conn, cfg.GroupBaseDN,
+			fmt.Sprintf("(%s=%s)", cfg.MemberAttribute, ldap.EscapeFilter(entry.DN)),
+			[]string{cfg.GroupAttribute})
+		if err != nil {
+			return account, fmt.Errorf("failed to search groups of %v: %w", entry.DN, err)
+		}
+		for _, g := range groups {
+			account.Groups = append(account.Groups, g.GetAttributeValue(cfg.GroupAttribute))
+		}
+
+		groups, err = searchLDAP(conn, cfg.GroupBaseDN, fmt.Sprintf("(%s=*)", cfg.GroupAttribute),
+			[]string{cfg.GroupAttribute})
+		if err != nil {
+			return account, fmt.Errorf("failed to search groups: %w", err)
+		}
+		for _, g := range groups {
+			account.DirectoryGroups = append(account.DirectoryGroups, g.GetAttributeValue(cfg.GroupAttribute))
+		}
+	}
+
+	// verify the password last, the user may not be allowed to search the directory
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+// syncUserGroups makes the user a member of exactly those user groups which
+// are named like one of its LDAP groups. User groups which are not named like
+// any group of the directory are managed manually and left untouched.
+func (u *User) syncUserGroups(groups []string, directoryGroups []string) error {
+	if len(directoryGroups) == 0 {
+		return nil
+	}
+
+	db := database.GetDB()
+
+	var managed []database.UserGroup
+	err := db.Preload("ScenarioMappings").Where("name IN (?)", directoryGroups).Find(&managed).Error
+	if err != nil {
+		return err
+	}
+
+	var current []database.UserGroup
+	err = db.Model(&u.User).Related(&current, "UserGroups").Error
+	if err != nil {
+		return err
+	}
+	isMember := map[uint]bool{}
+	for _, ug := range current {
+		isMember[ug.ID] = true
+	}
+
+	for i := range managed {
+		ug := &managed[i]
+		_, inGroup := helper.Find(groups, ug.Name)
+
+		if !inGroup && isMember[ug.ID] {
+			// the user loses the access to the scenarios of the group, as if it was removed from the group manually
+			u.removeGroupScenarios(ug)
+
+			err = db.Model(ug).Association("Users").Delete(&u.User).Error
+			if err != nil {
+				return err
+			}
+			log.Printf("Removed user %s (id=%d) from user group %s (id=%d)", u.Username, u.ID, ug.Name, ug.ID)
+			continue
+		}
+
+		if !inGroup || isMember[ug.ID] {
+			continue
+		}
+
+		err = db.Model(ug).Association("Users").Append(&u.User).Error
+		if err != nil {
+			return err
+		}
+		log.Printf("Added user %s (id=%d) to user group %s (id=%d)", u.Username, u.ID, ug.Name, ug.ID)
+
+		for _, sm := range ug.ScenarioMappings {
+			var so database.Scenario
+			err = db.Find(&so, sm.ScenarioID).Error
+			if err != nil {
+				log.Printf("Cannot find scenario %d of user group %s (id=%d): %v", sm.ScenarioID, ug.Name, ug.ID, err)
+				continue
+			}
+
+			if sm.Duplicate {
+				_, err = SubmitScenarioDuplication(so, &u.User, "")
+			} else {
+				role := sm.Role
+				if role == "" {
+					role = database.ScenarioOwner
+				}
+				err = database.AddScenarioMember(so.ID, u.ID, role)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeGroupScenarios removes the duplicates of the scenarios of the user group which were made for the user
+// and the access to the other scenarios of the group unless the user has access to them otherwise
+func (u *User) removeGroupScenarios(ug *database.UserGroup) {
+	db := database.GetDB()
+	for _, sm := range ug.ScenarioMappings {
+		var so database.Scenario
+		err := db.Find(&so, sm.ScenarioID).Error
+		if err != nil {
+			continue
+		}
+
+		if sm.Duplicate {
+			err = RemoveDuplicate(&so, &u.User)
+		} else {
+			err = RemoveAccess(&so, &u.User, ug)
+		}
+		if err != nil {
+			log.Printf("Failed to remove user %s (id=%d) from scenario %d of user group %s (id=%d): %v",
+				u.Username, u.ID, sm.ScenarioID, ug.Name, ug.ID, err)
+		}
+	}
+}
@@ -0,0 +1,542 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package user
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// Time within which a login started at the OpenID Connect provider has to be completed
+const oidcLoginTimeout = 10 * time.Minute
+
+// Time for which the metadata and the key set of the OpenID Connect provider are cached
+const oidcCacheTTL = time.Hour
+
+// Minimum time between two queries of the key set, which is queried again if a token is signed with an unknown key
+const oidcKeySetRefreshInterval = time.Minute
+
+type oidcConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string
+	AdminGroup   string
+}
+
+// oidcProvider holds the metadata published by an OpenID Connect provider
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type cachedOIDCProvider struct {
+	provider oidcProvider
+	fetched  time.Time
+}
+
+type cachedKeySet struct {
+	keys    []jsonWebKey
+	fetched time.Time
+}
+
+// oidcCache holds the metadata of the providers by their issuer and the key sets by their URI
+var oidcCache = struct {
+	sync.Mutex
+	providers map[string]cachedOIDCProvider
+	keySets   map[string]cachedKeySet
+}{providers: map[string]cachedOIDCProvider{}, keySets: map[string]cachedKeySet{}}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// startOIDC godoc
+// @Summary Start a login at the OpenID Connect provider
+// @Description Redirects to the provider which redirects back to auth.oidc.redirect-url with the code and state to be passed to POST /authenticate/oidc.
+// @ID startOIDC
+// @Tags authentication
+// @Success 302 "Redirect to the authorization endpoint of the provider"
+// @Failure 400 {object} api.ResponseError "Bad request"
+// @Failure 500 {object} api.ResponseError "Internal server error."
+// @Router /authenticate/oidc [get]
+func startOIDC(c *gin.Context) {
+	cfg, err := getOIDCConfig()
+	if err != nil {
+		helper.BadRequestError(c, err.Error())
+		return
+	}
+
+	provider, err := discoverOIDCProvider(cfg.Issuer)
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
+		return
+	}
+	verifier, err := randomString()
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
+		return
+	}
+
+	// the login can be completed at any instance of the backend
+	err = database.NewOIDCLogin(state, verifier, nonce, oidcLoginTimeout)
+	if helper.DBError(c, err) {
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", cfg.ClientID)
+	params.Set("redirect_uri", cfg.RedirectURL)
+	params.Set("scope", strings.Join(cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	c.Redirect(http.StatusFound, provider.AuthorizationEndpoint+sep+params.Encode())
+}
+
+func authenticateOIDC(c *gin.Context) (User, error) {
+	var myUser User
+
+	cfg, err := getOIDCConfig()
+	if err != nil {
+		helper.BadRequestError(c, err.Error())
+		return myUser, err
+	}
+
+	var req oidcLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.BadRequestError(c, err.Error())
+		return myUser, err
+	}
+
+	if err := req.validate(); err != nil {
+		helper.BadRequestError(c, err.Error())
+		return myUser, err
+	}
+
+	// the state can only be used once
+	login, err := database.CompleteOIDCLogin(req.State)
+	if gorm.IsRecordNotFoundError(err) {
+		helper.UnauthorizedError(c, "Unknown or expired login state")
+		return myUser, fmt.Errorf("unknown or expired state")
+	} else if helper.DBError(c, err) {
+		return myUser, err
+	}
+
+	provider, err := discoverOIDCProvider(cfg.Issuer)
+	if err != nil {
+		helper.InternalServerError(c, err.Error())
+		return myUser, err
+	}
+
+	claims, err := exchangeOIDCCode(cfg, provider, req.Code, login)
+	if err != nil {
+		helper.UnauthorizedError(c, "Authentication failed ("+err.Error()+")")
+		return myUser, err
+	}
+
+	username, _ := claims["preferred_username"].(string)
+	if username == "" {
+		username, _ = claims["sub"].(string)
+	}
+
+	email, _ := claims["email"].(string)
+	if email == "" {
+		helper.UnauthorizedError(c, "Authentication failed (no email claim)")
+		return myUser, fmt.Errorf("no email")
+	}
+
+	// do not let the provider take over accounts which log in with a password
+	err = myUser.byUsername(username)
+	if err == nil && myUser.Password != "" {
+		helper.UnauthorizedError(c, "Authentication failed (username is taken by an internal user)")
+		return myUser, fmt.Errorf("username %v is taken by an internal user", username)
+	}
+
+	myUser, err = externalUser(username, email, claimStrings(claims[cfg.GroupsClaim]), cfg.AdminGroup)
+	if err != nil {
+		helper.UnauthorizedError(c, "Authentication failed ("+err.Error()+")")
+		return myUser, err
+	}
+
+	return myUser, nil
+}
+
+func getOIDCConfig() (oidcConfig, error) {
+	var cfg oidcConfig
+
+	enabled, err := configuration.GlobalConfig.Bool("auth.oidc.enabled")
+	if err != nil || !enabled {
+		return cfg, fmt.Errorf("OpenID Connect authentication is not activated")
+	}
+
+	cfg.Issuer, _ = configuration.GlobalConfig.String("auth.oidc.issuer")
+	cfg.ClientID, _ = configuration.GlobalConfig.String("auth.oidc.client-id")
+	cfg.ClientSecret, _ = configuration.GlobalConfig.String("auth.oidc.client-secret")
+	cfg.RedirectURL, _ = configuration.GlobalConfig.String("auth.oidc.redirect-url")
+	cfg.GroupsClaim, _ = configuration.GlobalConfig.String("auth.oidc.groups-claim")
+	cfg.AdminGroup, _ = configuration.GlobalConfig.String("auth.oidc.admin-group")
+
+	scopes, _ := configuration.GlobalConfig.String("auth.oidc.scopes")
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			cfg.Scopes = append(cfg.Scopes, scope)
+		}
+	}
+
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return cfg, fmt.Errorf("Invalid backend configuration: auth.oidc.issuer, auth.oidc.client-id and auth.oidc.redirect-url are required")
+	}
+
+	return cfg, nil
+}
+
+// discoverOIDCProvider returns the metadata of the provider, which is cached for oidcCacheTTL
+func discoverOIDCProvider(issuer string) (oidcProvider, error) {
+	oidcCache.Lock()
+	cached, ok := oidcCache.providers[issuer]
+	oidcCache.Unlock()
+	if ok && time.Since(cached.fetched) < oidcCacheTTL {
+		return cached.provider, nil
+	}
+
+	var provider oidcProvider
+
+	resp, err := resty.New().R().SetHeader("Accept", "application/json").
+		Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return provider, fmt.Errorf("failed to query OpenID Connect provider: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return provider, fmt.Errorf("failed to query OpenID Connect provider: %v", resp.Status())
+	}
+
+	err = json.Unmarshal(resp.Body(), &provider)
+	if err != nil {
+		return provider, fmt.Errorf("failed to unmarshal OpenID Connect provider metadata: %w", err)
+	}
+
+	if provider.Issuer != issuer {
+		return provider, fmt.Errorf("OpenID Connect provider reports issuer %v instead of %v", provider.Issuer, issuer)
+	}
+
+	oidcCache.Lock()
+	oidcCache.providers[issuer] = cachedOIDCProvider{provider: provider, fetched: time.Now()}
+	oidcCache.Unlock()
+
+	return provider, nil
+}
+
+// exchangeOIDCCode redeems the authorization code at the provider and returns
+// the verified claims of the ID token complemented by the claims of the user info
+func exchangeOIDCCode(cfg oidcConfig, provider oidcProvider, code string, login database.OIDCLogin) (jwt.MapClaims, error) {
+	client := resty.New()
+
+	tokenRequest := client.R().SetHeader("Accept", "application/json").
+		SetFormData(map[string]string{
+			"grant_type":    "authorization_code",
+			"code":          code,
+			"redirect_uri":  cfg.RedirectURL,
+			"client_id":     cfg.ClientID,
+			"code_verifier": login.Verifier,
+		})
+	if cfg.ClientSecret != "" {
+		tokenRequest.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := tokenRequest.Post(provider.TokenEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem code: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to redeem code: %v", resp.Status())
+	}
+
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.Unmarshal(resp.Body(), &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token response: %w", err)
+	}
+
+	claims, err := verifyIDToken(cfg, provider, tokens.IDToken, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider.UserinfoEndpoint == "" || tokens.AccessToken == "" {
+		return claims, nil
+	}
+
+	// providers may omit claims like the groups from the ID token
+	resp, err = client.R().SetHeader("Accept", "application/json").
+		SetAuthToken(tokens.AccessToken).Get(provider.UserinfoEndpoint)
+	if err != nil || resp.StatusCode() != http.StatusOK {
+		log.Printf("Failed to query OpenID Connect user info of %v: %v", claims["sub"], err)
+		return claims, nil
+	}
+
+	var userinfo map[string]interface{}
+	err = json.Unmarshal(resp.Body(), &userinfo)
+	if err != nil || userinfo["sub"] != claims["sub"] {
+		log.Printf("Ignoring invalid OpenID Connect user info of %v", claims["sub"])
+		return claims, nil
+	}
+
+	for k, v := range userinfo {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+
+	return claims, nil
+}
+
+func verifyIDToken(cfg oidcConfig, provider oidcProvider, rawIDToken string, nonce string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing alg: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return fetchOIDCKey(provider, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid ID token")
+	}
+
+	if !claims.VerifyIssuer(provider.Issuer, true) {
+		return nil, fmt.Errorf("invalid issuer of ID token")
+	}
+
+	if _, found := helper.Find(claimStrings(claims["aud"]), cfg.ClientID); !found {
+		return nil, fmt.Errorf("invalid audience of ID token")
+	}
+
+	if claims["nonce"] != nonce {
+		return nil, fmt.Errorf("invalid nonce of ID token")
+	}
+
+	return claims, nil
+}
+
+// fetchOIDCKey returns the public key with the given ID from the key set of the provider; the key set
+// is cached for oidcCacheTTL and queried again if it lacks the key, e.g. after the provider rotated its keys
+func fetchOIDCKey(provider oidcProvider, kid string) (interface{}, error) {
+	oidcCache.Lock()
+	cached, ok := oidcCache.keySets[provider.JWKSURI]
+	oidcCache.Unlock()
+
+	refresh := !ok || time.Since(cached.fetched) >= oidcCacheTTL
+	if _, found := findOIDCKey(cached.keys, kid); !found && time.Since(cached.fetched) >= oidcKeySetRefreshInterval {
+		refresh = true
+	}
+
+	if refresh {
+		keys, err := fetchOIDCKeySet(provider.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+
+		cached = cachedKeySet{keys: keys, fetched: time.Now()}
+		oidcCache.Lock()
+		oidcCache.keySets[provider.JWKSURI] = cached
+		oidcCache.Unlock()
+	}
+
+	key, found := findOIDCKey(cached.keys, kid)
+	if !found {
+		return nil, fmt.Errorf("unknown key %v", kid)
+	}
+
+	return key.publicKey()
+}
+
+func fetchOIDCKeySet(uri string) ([]jsonWebKey, error) {
+	resp, err := resty.New().R().SetHeader("Accept", "application/json").Get(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query key set: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to query key set: %v", resp.Status())
+	}
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.Unmarshal(resp.Body(), &keySet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key set: %w", err)
+	}
+
+	return keySet.Keys, nil
+}
+
+func findOIDCKey(keys []jsonWebKey, kid string) (jsonWebKey, bool) {
+	for _, key := range keys {
+		if key.Kid == kid || (kid == "" && len(keys) == 1) {
+			return key, true
+		}
+	}
+
+	return jsonWebKey{}, false
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key %v: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key %v: %w", k.Kid, err)
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %v of key %v", k.Crv, k.Kid)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key %v: %w", k.Kid, err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key %v: %w", k.Kid, err)
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %v of key %v", k.Kty, k.Kid)
+}
+
+// claimStrings returns the strings of a claim which is either a
+// single (comma-separated) string or a list of strings
+func claimStrings(claim interface{}) []string {
+	var values []string
+
+	switch claim := claim.(type) {
+	case string:
+		for _, v := range strings.Split(claim, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	case []interface{}:
+		for _, v := range claim {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	return values
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random string: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
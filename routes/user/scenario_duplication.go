@@ -18,6 +18,7 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -26,7 +27,9 @@ import (
 	"time"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
 	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
 	"github.com/jinzhu/gorm/dialects/postgres"
 )
 
@@ -59,9 +62,33 @@ func IsExclusiveAccess(sc *database.Scenario, u *database.User, ug *database.Use
 	return true
 }
 
+// ScenarioDuplicationJob is the type of the jobs duplicating scenarios for users
+const ScenarioDuplicationJob = "scenario-duplication"
+
+// time to wait for duplicated ICs to be created by their manager
+const icDuplicationTimeout = 20 * time.Second
+
+// SubmitScenarioDuplication duplicates the scenario s for the user as a job
+func SubmitScenarioDuplication(s database.Scenario, user *database.User, uuidstr string) (database.Job, error) {
+	u := *user
+	return jobs.Submit(ScenarioDuplicationJob, u.ID, s.ID, func(ctx context.Context, j *jobs.Job) error {
+		return duplicateScenarioForUser(ctx, j, s, &u, uuidstr)
+	})
+}
+
 func DuplicateScenarioForUser(s database.Scenario, user *database.User, uuidstr string) {
+	err := duplicateScenarioForUser(context.Background(), nil, s, user, uuidstr)
+	if err != nil {
+		log.Printf("duplicate scenario %v fails with error %v", s.Name, err.Error())
+	}
+}
+
+// duplicateScenarioForUser duplicates the ICs used by the scenario if required, waits until
+// the duplicated ICs are created and duplicates the scenario; j is nil if not run as job
+func duplicateScenarioForUser(ctx context.Context, j *jobs.Job, s database.Scenario, user *database.User, uuidstr string) error {
 	if IsAlreadyDuplicated(&s, user) {
-		return
+		reportProgress(j, 100, "scenario was already duplicated")
+		return nil
 	}
 	// get all component configs of the scenario
 	db := database.GetDB()
@@ -71,14 +98,17 @@ func DuplicateScenarioForUser(s database.Scenario, user *database.User, uuidstr
 		log.Printf("Warning: scenario to duplicate (id=%d) has no component configurations", s.ID)
 	}
 
+	reportProgress(j, 0, "duplicating ICs")
+
 	icIdmap := make(map[uint]uint)             // key: original IC id, value: duplicated IC id
-	duplicatedICuuids := make(map[uint]string) // key: original icID; value: UUID of duplicate
+	duplicatedICuuids := make(map[uint]string) // key: original icID; value: UUID of duplicate which is not yet in DB
 
 	// iterate over component configs to check for ICs to duplicate
 	for _, config := range configs {
 		icID := config.ICID
 
-		if _, ok := duplicatedICuuids[icID]; ok { // this IC was already added
+		_, waiting := duplicatedICuuids[icID]
+		if _, ok := icIdmap[icID]; ok || waiting { // this IC was already added
 			log.Println("IC already added while ranging configs")
 			continue
 		}
@@ -102,40 +132,23 @@ func DuplicateScenarioForUser(s database.Scenario, user *database.User, uuidstr
 
 			duplicatedICuuids[ic.ID] = duplicateUUID
 		} else if alreadyDuplicated {
-			duplicatedICuuids[ic.ID] = "alreadyduplicated"
 			icIdmap[ic.ID] = dupID
-			err = nil
 		} else { // use existing IC
-			duplicatedICuuids[ic.ID] = "useoriginal"
 			icIdmap[ic.ID] = ic.ID
-			err = nil
 		}
 	}
 
 	// copy scenario after all new external ICs are in DB
 	icsToWaitFor := len(duplicatedICuuids)
-	var timeout = 20 // seconds
+	deadline := time.Now().Add(icDuplicationTimeout)
 
-	for i := 0; i < timeout; i++ {
-		// duplicate scenario after all duplicated ICs have been found in the DB
-		log.Printf("Number of ICs to wait for: %d", icsToWaitFor)
-		if icsToWaitFor <= 0 {
-			err := duplicateScenario(s, icIdmap, user)
-			if err != nil {
-				log.Printf("duplicate scenario %v fails with error %v", s.Name, err.Error())
-			}
-
-			return
-		} else {
-			time.Sleep(1 * time.Second)
-		}
+	for len(duplicatedICuuids) > 0 {
+		log.Printf("Number of ICs to wait for: %d", len(duplicatedICuuids))
+		reportProgress(j, uint(10+70*(icsToWaitFor-len(duplicatedICuuids))/icsToWaitFor),
+			fmt.Sprintf("waiting for %d duplicated ICs", len(duplicatedICuuids)))
 
 		// check for new ICs with previously created UUIDs
 		for icId, uuid_r := range duplicatedICuuids {
-			if uuid_r == "alreadyduplicated" || uuid_r == "useoriginal" {
-				icsToWaitFor--
-				continue
-			}
 			log.Printf("Looking for duplicated IC with UUID %s", uuid_r)
 
 			// a new IC is searched by UUID, otherwise by string comparison of IC name
@@ -147,11 +160,41 @@ func DuplicateScenarioForUser(s database.Scenario, user *database.User, uuidstr
 				log.Printf("Didn't find duplicated IC: %s, keep waiting for it..", err)
 			} else {
 				log.Printf("Found duplicated IC! Original IC id: %d, duplicated IC id: %d", icId, duplicatedIC.ID)
-				icsToWaitFor--
 				icIdmap[icId] = duplicatedIC.ID
-				uuid_r = ""
+				delete(duplicatedICuuids, icId)
 			}
 		}
+
+		if len(duplicatedICuuids) == 0 {
+			break
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("timeout after %v waiting for %d duplicated ICs", icDuplicationTimeout, len(duplicatedICuuids))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+	}
+
+	// duplicate scenario after all duplicated ICs have been found in the DB
+	reportProgress(j, 80, "duplicating scenario")
+	duplicateSo, err := CloneScenario(s, s.Name+` `+user.Username, user, icIdmap)
+	if err != nil {
+		return err
+	}
+
+	if j != nil {
+		return j.SetResult(map[string]uint{"scenarioID": duplicateSo.ID})
+	}
+
+	return nil
+}
+
+func reportProgress(j *jobs.Job, progress uint, message string) {
+	if j != nil {
+		j.SetProgress(progress, message)
 	}
 }
 
@@ -232,24 +275,49 @@ func RemoveAccess(sc *database.Scenario, u *database.User, ug *database.UserGrou
 	return err
 }
 
-func duplicateScenario(s database.Scenario, icIds map[uint]uint, user *database.User) error {
+// CloneScenario creates an independent deep copy of the scenario s named name and
+// owned by owner; the ICs of the component configurations are replaced according
+// to icIds (key: original IC id, value: IC id to be used by the copy). The copy is
+// created in one transaction, so nothing is left behind if any step fails.
+func CloneScenario(s database.Scenario, name string, owner *database.User, icIds map[uint]uint) (database.Scenario, error) {
+	var duplicateSo database.Scenario
+	var copiedFiles []database.File
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		duplicateSo, err = cloneScenario(tx, s, name, owner, icIds, &copiedFiles)
+		return err
+	})
+	if err != nil {
+		// the copied data of the files is not referenced by any file
+		for _, f := range copiedFiles {
+			delErr := deleteFileData(f)
+			if delErr != nil {
+				log.Printf("Failed to delete the data of copied file %v: %v", f.Name, delErr)
+			}
+		}
+		return database.Scenario{}, err
+	}
+	return duplicateSo, nil
+}
 
-	db := database.GetDB()
+func cloneScenario(db *gorm.DB, s database.Scenario, name string, owner *database.User,
+	icIds map[uint]uint, copiedFiles *[]database.File) (database.Scenario, error) {
 
 	var duplicateSo database.Scenario
-	duplicateSo.Name = s.Name + ` ` + user.Username
+	duplicateSo.Name = name
 	duplicateSo.StartParameters.RawMessage = s.StartParameters.RawMessage
 
 	err := db.Create(&duplicateSo).Error
 	if err != nil {
 		log.Printf("Could not create duplicate of scenario %d", s.ID)
-		return err
+		return duplicateSo, err
 	}
 
 	// associate user to new scenario
-	err = db.Model(&duplicateSo).Association("Users").Append(user).Error
+	err = db.Model(&duplicateSo).Association("Users").Append(owner).Error
 	if err != nil {
-		log.Printf("Could not associate User %s to scenario %d", user.Username, duplicateSo.ID)
+		log.Printf("Could not associate User %s to scenario %d", owner.Username, duplicateSo.ID)
+		return duplicateSo, err
 	}
 	log.Println("Associated user to duplicated scenario")
 
@@ -258,16 +326,14 @@ func duplicateScenario(s database.Scenario, icIds map[uint]uint, user *database.
 	fileidmap := make(map[uint]uint) // key: original file id, value: duplicated file id
 	err = db.Order("ID asc").Model(s).Related(&files, "Files").Error
 	if err != nil {
-		log.Printf("error getting files for scenario %d", s.ID)
+		return duplicateSo, err
 	}
 	for _, f := range files {
-		duplicateFileID, err := duplicateFile(f, duplicateSo.ID)
+		duplicateFileID, err := duplicateFile(db, f, duplicateSo.ID, copiedFiles)
 		if err != nil {
-			log.Printf("error creating duplicate file %d: %s", f.ID, err)
-			continue
-		} else {
-			fileidmap[f.ID] = duplicateFileID
+			return duplicateSo, fmt.Errorf("error creating duplicate file %d: %w", f.ID, err)
 		}
+		fileidmap[f.ID] = duplicateFileID
 	}
 
 	var configs []database.ComponentConfiguration
@@ -275,42 +341,52 @@ func duplicateScenario(s database.Scenario, icIds map[uint]uint, user *database.
 	// map existing signal IDs to duplicated signal IDs for widget duplication
 	signalMap := make(map[uint]uint)
 	err = db.Order("ID asc").Model(s).Related(&configs, "ComponentConfigurations").Error
-	if err == nil {
-		for _, c := range configs {
-			duplicatConfigID, err := duplicateComponentConfig(c, duplicateSo.ID, icIds, &signalMap)
-			if err != nil {
-				log.Printf("Error duplicating component config %d: %s", c.ID, err)
-				continue
-			} else {
-				configidmap[c.ID] = duplicatConfigID
-			}
+	if err != nil {
+		return duplicateSo, err
+	}
+	for _, c := range configs {
+		duplicatConfigID, err := duplicateComponentConfig(db, c, duplicateSo.ID, icIds, fileidmap, &signalMap)
+		if err != nil {
+			return duplicateSo, fmt.Errorf("error duplicating component config %d: %w", c.ID, err)
 		}
-	} else {
-		return err
+		configidmap[c.ID] = duplicatConfigID
 	}
 
 	var dabs []database.Dashboard
 	err = db.Order("ID asc").Model(s).Related(&dabs, "Dashboards").Error
 	if err != nil {
-		log.Printf("Error getting dashboards for scenario %d: %s", s.ID, err)
+		return duplicateSo, err
 	}
 
 	for _, dab := range dabs {
-		err = duplicateDashboard(dab, duplicateSo.ID, signalMap, configidmap, fileidmap, icIds)
+		err = duplicateDashboard(db, dab, duplicateSo.ID, signalMap, configidmap, fileidmap, icIds)
 		if err != nil {
-			log.Printf("Error duplicating dashboard %d: %s", dab.ID, err)
-			continue
+			return duplicateSo, fmt.Errorf("error duplicating dashboard %d: %w", dab.ID, err)
 		}
 	}
 
-	return err
+	var results []database.Result
+	err = db.Order("ID asc").Model(s).Related(&results, "Results").Error
+	if err != nil {
+		return duplicateSo, err
+	}
+
+	for _, r := range results {
+		err = duplicateResult(db, r, duplicateSo.ID, fileidmap)
+		if err != nil {
+			return duplicateSo, fmt.Errorf("error duplicating result %d: %w", r.ID, err)
+		}
+	}
+
+	return duplicateSo, nil
 }
 
-func duplicateFile(f database.File, scenarioID uint) (uint, error) {
+func duplicateFile(db *gorm.DB, f database.File, scenarioID uint, copiedFiles *[]database.File) (uint, error) {
 
 	var dup database.File
 	dup.Name = f.Name
 	dup.Key = f.Key
+	dup.Storage = f.Storage
 	dup.Type = f.Type
 	dup.Size = f.Size
 	dup.Date = f.Date
@@ -319,11 +395,20 @@ func duplicateFile(f database.File, scenarioID uint) (uint, error) {
 	dup.ImageHeight = f.ImageHeight
 	dup.ImageWidth = f.ImageWidth
 
-	// file duplicate will point to the same data blob in the DB (SQL or postgres)
+	// the file duplicate gets a copy of the data under a new key, so that the data of the
+	// original and of the duplicate can be updated and deleted independently
+	storage, err := database.GetFileStorage()
+	if err != nil {
+		return 0, err
+	}
+	err = storage.CopyData(context.Background(), &dup)
+	if err != nil {
+		return 0, err
+	}
+	*copiedFiles = append(*copiedFiles, dup)
 
 	// Add duplicate File object with parameters to DB
-	db := database.GetDB()
-	err := db.Create(&dup).Error
+	err = db.Create(&dup).Error
 	if err != nil {
 		return 0, err
 	}
@@ -341,15 +426,46 @@ func duplicateFile(f database.File, scenarioID uint) (uint, error) {
 	return dup.ID, err
 }
 
-func duplicateComponentConfig(m database.ComponentConfiguration, scenarioID uint, icIds map[uint]uint, signalMap *map[uint]uint) (uint, error) {
+func deleteFileData(f database.File) error {
+	storage, err := database.GetFileStorage()
+	if err != nil {
+		return err
+	}
+	return storage.DeleteData(context.Background(), &f)
+}
+
+func duplicateResult(db *gorm.DB, r database.Result, scenarioID uint, fileIDmap map[uint]uint) error {
 
-	db := database.GetDB()
+	var dup database.Result
+	dup.Description = r.Description
+	dup.ConfigSnapshots = r.ConfigSnapshots
+	dup.ScenarioID = scenarioID
+
+	dup.ResultFileIDs = []int64{}
+	for _, id := range r.ResultFileIDs {
+		if dupID, ok := fileIDmap[uint(id)]; ok {
+			dup.ResultFileIDs = append(dup.ResultFileIDs, int64(dupID))
+		}
+	}
+
+	return db.Create(&dup).Error
+}
+
+func duplicateComponentConfig(db *gorm.DB, m database.ComponentConfiguration, scenarioID uint, icIds map[uint]uint,
+	fileIDmap map[uint]uint, signalMap *map[uint]uint) (uint, error) {
 
 	var dup database.ComponentConfiguration
 	dup.Name = m.Name
 	dup.StartParameters = m.StartParameters
 	dup.ScenarioID = scenarioID
 
+	dup.FileIDs = []int64{}
+	for _, id := range m.FileIDs {
+		if dupID, ok := fileIDmap[uint(id)]; ok {
+			dup.FileIDs = append(dup.FileIDs, int64(dupID))
+		}
+	}
+
 	if val, ok := icIds[m.ICID]; ok {
 		var duplicatedIC database.InfrastructureComponent
 		err := db.Find(&duplicatedIC, "ID = ?", val).Error
@@ -378,12 +494,13 @@ func duplicateComponentConfig(m database.ComponentConfiguration, scenarioID uint
 	// associate IC with component configuration
 	var ic database.InfrastructureComponent
 	err = db.Find(&ic, dup.ICID).Error
-	if err != nil {
-		return 0, err
-	}
-	err = db.Model(&ic).Association("ComponentConfigurations").Append(&dup).Error
-	if err != nil {
-		return 0, err
+	if err == nil {
+		err = db.Model(&ic).Association("ComponentConfigurations").Append(&dup).Error
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		log.Println("INFO: duplicated component config", dup.Name, "(ID=", dup.ID, ") could not be associated to IC; IC ID not found in DB")
 	}
 
 	// associate component configuration with scenario
@@ -431,7 +548,7 @@ func duplicateComponentConfig(m database.ComponentConfiguration, scenarioID uint
 	return dup.ID, nil
 }
 
-func duplicateDashboard(d database.Dashboard, scenarioID uint, signalMap map[uint]uint,
+func duplicateDashboard(db *gorm.DB, d database.Dashboard, scenarioID uint, signalMap map[uint]uint,
 	configIDmap map[uint]uint, fileIDmap map[uint]uint, icIds map[uint]uint) error {
 
 	var duplicateD database.Dashboard
@@ -440,7 +557,6 @@ func duplicateDashboard(d database.Dashboard, scenarioID uint, signalMap map[uin
 	duplicateD.ScenarioID = scenarioID
 	duplicateD.Height = d.Height
 
-	db := database.GetDB()
 	var so database.Scenario
 	err := db.Find(&so, duplicateD.ScenarioID).Error
 	if err != nil {
@@ -464,21 +580,20 @@ func duplicateDashboard(d database.Dashboard, scenarioID uint, signalMap map[uin
 	var widgets []database.Widget
 	err = db.Order("ID asc").Model(d).Related(&widgets, "Widgets").Error
 	if err != nil {
-		log.Printf("Error getting widgets for dashboard %d: %s", d.ID, err)
+		return err
 	}
 	for _, w := range widgets {
 
-		err = duplicateWidget(w, duplicateD.ID, signalMap, configIDmap, fileIDmap, icIds)
+		err = duplicateWidget(db, w, duplicateD.ID, signalMap, configIDmap, fileIDmap, icIds)
 		if err != nil {
-			log.Printf("error creating duplicate for widget %d: %s", w.ID, err)
-			continue
+			return fmt.Errorf("error creating duplicate for widget %d: %w", w.ID, err)
 		}
 	}
 
 	return nil
 }
 
-func duplicateWidget(w database.Widget, dashboardID uint, signalMap map[uint]uint,
+func duplicateWidget(db *gorm.DB, w database.Widget, dashboardID uint, signalMap map[uint]uint,
 	configIDmap map[uint]uint, fileIDmap map[uint]uint, icIds map[uint]uint) error {
 
 	var duplicateW database.Widget
@@ -498,17 +613,8 @@ func duplicateWidget(w database.Widget, dashboardID uint, signalMap map[uint]uin
 		duplicateW.SignalIDs = append(duplicateW.SignalIDs, int64(signalMap[uint(id)]))
 	}
 
-	if w.Type == "ICstatus" {
-		duplicateW.CustomProperties = duplicateICStatusCustomProps(w.CustomProperties, icIds)
-	} else if w.Type == "Player" {
-		duplicateW.CustomProperties = duplicatePlayerCustomProps(w.CustomProperties, configIDmap)
-	} else if w.Type == "Image" {
-		duplicateW.CustomProperties = duplicateImageCustomProps(w.CustomProperties, fileIDmap)
-	} else {
-		duplicateW.CustomProperties = w.CustomProperties
-	}
+	duplicateW.CustomProperties = DuplicateCustomProperties(w, configIDmap, fileIDmap, icIds)
 
-	db := database.GetDB()
 	var dab database.Dashboard
 	err := db.Find(&dab, duplicateW.DashboardID).Error
 	if err != nil {
@@ -526,6 +632,20 @@ func duplicateWidget(w database.Widget, dashboardID uint, signalMap map[uint]uin
 	return err
 }
 
+// DuplicateCustomProperties returns the custom properties of a widget with all
+// contained IC, component configuration and file IDs replaced by their duplicates
+func DuplicateCustomProperties(w database.Widget, configIDmap map[uint]uint, fileIDmap map[uint]uint, icIds map[uint]uint) postgres.Jsonb {
+	if w.Type == "ICstatus" {
+		return duplicateICStatusCustomProps(w.CustomProperties, icIds)
+	} else if w.Type == "Player" {
+		return duplicatePlayerCustomProps(w.CustomProperties, configIDmap)
+	} else if w.Type == "Image" {
+		return duplicateImageCustomProps(w.CustomProperties, fileIDmap)
+	}
+
+	return w.CustomProperties
+}
+
 func duplicateICStatusCustomProps(customProps postgres.Jsonb, icIds map[uint]uint) postgres.Jsonb {
 	type ICstatusCustomProps struct {
 		CheckedIDs []uint `json:"checkedIDs"`
@@ -540,7 +660,11 @@ func duplicateICStatusCustomProps(customProps postgres.Jsonb, icIds map[uint]uin
 
 	var IDs []string
 	for _, id := range props.CheckedIDs {
-		IDs = append(IDs, strconv.FormatUint(uint64(icIds[id]), 10))
+		// ICs without duplicate are shared with the original scenario
+		if dupID, ok := icIds[id]; ok {
+			id = dupID
+		}
+		IDs = append(IDs, strconv.FormatUint(uint64(id), 10))
 	}
 
 	customProperties := fmt.Sprintf(`{"checkedIDs": [%s]}`, strings.Join(IDs, ","))
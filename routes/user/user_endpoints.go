@@ -106,6 +106,7 @@ func addUser(c *gin.Context) {
 		return
 	}
 
+	database.Audit(c, database.Create, database.ModelUser, newUser.ID, 0, nil, newUser.User)
 	c.JSON(http.StatusOK, gin.H{"user": newUser.User})
 }
 
@@ -134,6 +135,12 @@ func updateUser(c *gin.Context) {
 	//	return
 	//}
 
+	// API tokens must not be used to change passwords or roles
+	if database.IsAPITokenRequest(c) {
+		helper.ForbiddenError(c, "Users cannot be updated with API tokens")
+		return
+	}
+
 	// Get the user's (to be updated) ID from the context
 	toBeUpdatedID, err := helper.GetIDOfElement(c, "userID", "path", -1)
 	if err != nil {
@@ -194,9 +201,11 @@ func updateUser(c *gin.Context) {
 		return
 	}
 
-	// Finally update the user
+	// Finally update the user, the state before the update is kept for the audit log
+	before := oldUser.User
 	err = oldUser.update(updatedUser)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelUser, oldUser.ID, 0, before, updatedUser.User)
 		c.JSON(http.StatusOK, gin.H{"user": updatedUser.User})
 	}
 
@@ -280,6 +289,7 @@ func deleteUser(c *gin.Context) {
 	// Try to remove user
 	err = user.remove()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelUser, user.ID, 0, user.User, nil)
 		c.JSON(http.StatusOK, gin.H{"user": user.User})
 	}
 
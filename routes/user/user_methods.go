@@ -76,7 +76,11 @@ func (u *User) save() error {
 func (u *User) remove() error {
 	db := database.GetDB()
 	err := db.Delete(u).Error
-	return err
+	if err != nil {
+		return err
+	}
+
+	return database.RevokeUserSessions(u.ID)
 }
 
 func (u *User) byUsername(username string) error {
@@ -112,6 +116,10 @@ func (u *User) validatePassword(password string) error {
 
 func (u *User) update(updatedUser User) error {
 
+	// tokens issued before a change of the credentials or privileges must no longer be accepted
+	revokeSessions := u.Password != updatedUser.Password || u.Role != updatedUser.Role ||
+		u.Active != updatedUser.Active
+
 	u.Username = updatedUser.Username
 	u.Password = updatedUser.Password
 	u.Mail = updatedUser.Mail
@@ -126,6 +134,42 @@ func (u *User) update(updatedUser User) error {
 
 	// extra update for bool Active since it is ignored if false
 	err = db.Model(u).Updates(map[string]interface{}{"Active": updatedUser.Active}).Error
+	if err != nil || !revokeSessions {
+		return err
+	}
 
-	return err
+	return database.RevokeUserSessions(u.ID)
+}
+
+// ResetPassword sets a new password for the user with the given username,
+// the sessions of the user are revoked
+func ResetPassword(username, password string) (User, error) {
+	var u User
+	err := u.byUsername(username)
+	if err != nil {
+		return u, err
+	}
+
+	updatedUser := u
+	err = updatedUser.setPassword(password)
+	if err != nil {
+		return u, err
+	}
+
+	return u, u.update(updatedUser)
+}
+
+// Deactivate deactivates the user with the given username so that the user can no longer log in,
+// the sessions of the user are revoked
+func Deactivate(username string) (User, error) {
+	var u User
+	err := u.byUsername(username)
+	if err != nil {
+		return u, err
+	}
+
+	updatedUser := u
+	updatedUser.Active = false
+
+	return u, u.update(updatedUser)
 }
@@ -19,6 +19,9 @@ package user
 
 import (
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
@@ -41,20 +44,84 @@ func claimsToContext(c *gin.Context, claims jwt.MapClaims) error {
 	if err != nil {
 		return err
 	}
+	if !user.Active {
+		return fmt.Errorf("user is inactive")
+	}
+
+	// tokens are valid only as long as their session was not revoked
+	tokenID, ok := claims["jti"].(string)
+	if !ok {
+		return fmt.Errorf("token does not belong to a session")
+	}
+	s, err := database.ActiveSession(tokenID)
+	if err != nil || s.UserID != user.ID {
+		return fmt.Errorf("session was revoked")
+	}
 
 	c.Set(database.UserRoleCtx, user.Role)
 	c.Set(database.UserIDCtx, uint(userID))
+	c.Set(database.SessionIDCtx, s.ID)
+
+	return nil
+}
+
+// tokenExtractor extracts login JWTs and API tokens from requests
+var tokenExtractor = request.MultiExtractor{
+	request.AuthorizationHeaderExtractor,
+	request.ArgumentExtractor{"token"},
+}
+
+func apiTokenToContext(c *gin.Context, secret string) error {
+	db := database.GetDB()
+
+	var token database.APIToken
+	err := db.Where("hash = ?", database.HashAPIToken(secret)).First(&token).Error
+	if err != nil {
+		return fmt.Errorf("unknown or revoked API token")
+	}
+
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return fmt.Errorf("API token expired")
+	}
+
+	var user User
+	err = user.byID(token.UserID)
+	if err != nil {
+		return err
+	}
+	if !user.Active {
+		return fmt.Errorf("user of API token is inactive")
+	}
+
+	c.Set(database.UserRoleCtx, user.Role)
+	c.Set(database.UserIDCtx, user.ID)
+	c.Set(database.APITokenScopeCtx, token.Scope)
+	if token.Scope == database.TokenScopeScenario {
+		c.Set(database.APITokenScenarioCtx, token.ScenarioID)
+	}
+
+	// UpdateColumn does not touch UpdatedAt
+	err = db.Model(&token).UpdateColumn("last_used_at", time.Now()).Error
+	if err != nil {
+		log.Printf("Failed to record use of API token %d: %v", token.ID, err)
+	}
 
 	return nil
 }
 
 func isAuthenticated(c *gin.Context) (bool, error) {
+	// API tokens are no JWTs and are looked up in the DB instead
+	if raw, err := tokenExtractor.ExtractToken(c.Request); err == nil && strings.HasPrefix(raw, database.APITokenPrefix) {
+		err = apiTokenToContext(c, raw)
+		if err != nil {
+			return false, fmt.Errorf("Authentication failed (%s)", err)
+		}
+		return true, nil
+	}
+
 	// Authentication's access token extraction
 	token, err := request.ParseFromRequest(c.Request,
-		request.MultiExtractor{
-			request.AuthorizationHeaderExtractor,
-			request.ArgumentExtractor{"token"},
-		},
+		tokenExtractor,
 		func(token *jwt.Token) (interface{}, error) {
 			// Validate alg for signing the jwt
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -76,7 +143,7 @@ func isAuthenticated(c *gin.Context) (bool, error) {
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		err = claimsToContext(c, claims)
 		if err != nil {
-			return false, fmt.Errorf("Authentication failed (claims casting: %s)", err)
+			return false, fmt.Errorf("Authentication failed (%s)", err)
 		}
 	}
 
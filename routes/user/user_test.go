@@ -19,20 +19,32 @@ package user
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math/big"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	ber "github.com/go-asn1-ber/asn1-ber"
 	"github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/stretchr/testify/assert"
 
@@ -759,6 +771,580 @@ func TestModifyAddedUserAsAdmin(t *testing.T) {
 	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
 }
 
+func TestRefreshAndLogout(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	type authResponse struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	// login as user A
+	code, resp, err := helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/internal", "POST", database.UserACredentials)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	var login authResponse
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &login))
+	assert.NotEmpty(t, login.RefreshToken)
+
+	// refresh the token
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/refresh", "POST", gin.H{"refreshToken": login.RefreshToken})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	var refreshed authResponse
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &refreshed))
+
+	// the token issued at login was revoked by the refresh
+	code, resp, err = helper.TestEndpoint(router, login.Token,
+		"/api/v2/users/2", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// the refreshed token is valid
+	code, resp, err = helper.TestEndpoint(router, refreshed.Token,
+		"/api/v2/users/2", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// try to use the refresh token a second time
+	// should result in unauthorized
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/refresh", "POST", gin.H{"refreshToken": login.RefreshToken})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// try to refresh without a refresh token
+	// should result in bad request
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/refresh", "POST", gin.H{})
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	// logout
+	code, resp, err = helper.TestEndpoint(router, refreshed.Token,
+		"/api/v2/authenticate/logout", "POST", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// neither the token nor the refresh token of the session can be used after logout
+	code, resp, err = helper.TestEndpoint(router, refreshed.Token,
+		"/api/v2/users/2", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/refresh", "POST", gin.H{"refreshToken": refreshed.RefreshToken})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// login as user A again and change the password
+	token, err := helper.AuthenticateForTest(router, database.UserACredentials)
+	assert.NoError(t, err)
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/users/2", "PUT", helper.KeyModels{"user": UserRequest{
+			Password:    "n3w_p@ssword",
+			OldPassword: database.UserACredentials.Password,
+		}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// the token issued before the password change is revoked
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/users/2", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// login as user B and let admin deactivate user B
+	token, err = helper.AuthenticateForTest(router, database.UserBCredentials)
+	assert.NoError(t, err)
+	adminToken, err := helper.AuthenticateForTest(router, database.AdminCredentials)
+	assert.NoError(t, err)
+	code, resp, err = helper.TestEndpoint(router, adminToken,
+		"/api/v2/users/3", "PUT", helper.KeyModels{"user": UserRequest{Active: "no"}})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// the token of the deactivated user is revoked
+	code, resp, err = helper.TestEndpoint(router, token,
+		"/api/v2/users/3", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// the token of admin is still valid
+	code, resp, err = helper.TestEndpoint(router, adminToken,
+		"/api/v2/users/3", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	code, resp, err := helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/internal", "POST", database.UserACredentials)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	var login struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &login))
+
+	// use the refresh token in concurrent requests, only one of them starts a new session
+	const requests = 5
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _, err := helper.TestEndpoint(router, "",
+				"/api/v2/authenticate/refresh", "POST", gin.H{"refreshToken": login.RefreshToken})
+			assert.NoError(t, err)
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	refreshed := 0
+	for code := range codes {
+		if code == 200 {
+			refreshed++
+		} else {
+			assert.Equal(t, 401, code)
+		}
+	}
+	assert.Equal(t, 1, refreshed)
+}
+func TestAuthenticateOIDC(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	// mock OpenID Connect provider
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	var challenge, nonce, username string
+	var discoveries, keySetQueries int32
+	mux := http.NewServeMux()
+	provider := httptest.NewServer(mux)
+	defer provider.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&discoveries, 1)
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.URL,
+			"authorization_endpoint": provider.URL + "/authorize",
+			"token_endpoint":         provider.URL + "/token",
+			"userinfo_endpoint":      provider.URL + "/userinfo",
+			"jwks_uri":               provider.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&keySetQueries, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "mock-code" ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// the groups are only part of the user info
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                provider.URL,
+			"aud":                []string{"villas"},
+			"sub":                "sub-" + username,
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              nonce,
+			"preferred_username": username,
+			"email":              username + "@oidc.test",
+		})
+		idToken.Header["kid"] = "test"
+		signed, err := idToken.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"id_token":     signed,
+			"access_token": "mock-access-token",
+			"token_type":   "Bearer",
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer mock-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":    "sub-" + username,
+			"groups": []string{"admin", "staff"},
+		})
+	})
+
+	// try to login while OpenID Connect is disabled
+	// should result in bad request
+	code, resp, err := helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/oidc", "POST", gin.H{"code": "mock-code", "state": "state"})
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	t.Setenv("AUTH_OIDC_ENABLED", "true")
+	t.Setenv("AUTH_OIDC_ISSUER", provider.URL)
+	t.Setenv("AUTH_OIDC_CLIENT_ID", "villas")
+	t.Setenv("AUTH_OIDC_REDIRECT_URL", "https://villas.test/login/oidc")
+
+	// startLogin starts a login and returns its state
+	startLogin := func() string {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/api/v2/authenticate/oidc", nil)
+		assert.NoError(t, err)
+		router.ServeHTTP(w, req)
+		assert.Equalf(t, 302, w.Code, "Response body: \n%v\n", w.Body)
+
+		location, err := url.Parse(w.Header().Get("Location"))
+		assert.NoError(t, err)
+		assert.Equal(t, provider.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+
+		params := location.Query()
+		assert.Equal(t, "code", params.Get("response_type"))
+		assert.Equal(t, "villas", params.Get("client_id"))
+		assert.Equal(t, "S256", params.Get("code_challenge_method"))
+		challenge = params.Get("code_challenge")
+		nonce = params.Get("nonce")
+
+		return params.Get("state")
+	}
+
+	username = "oidcUser"
+	state := startLogin()
+
+	// try to login with an unknown state
+	// should result in unauthorized
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/oidc", "POST", gin.H{"code": "mock-code", "state": "unknown"})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// login, the user is created as admin due to its groups
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/oidc", "POST", gin.H{"code": "mock-code", "state": state})
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"user": map[string]interface{}{
+		"username": "oidcUser",
+		"mail":     "oidcUser@oidc.test",
+		"role":     "Admin",
+	}})
+	assert.NoError(t, err)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &login))
+	code, resp, err = helper.TestEndpoint(router, login.Token,
+		"/api/v2/users", "GET", nil)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+
+	// try to use the state a second time
+	// should result in unauthorized
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/oidc", "POST", gin.H{"code": "mock-code", "state": state})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// try to login with a wrong code
+	// should result in unauthorized
+	state = startLogin()
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/oidc", "POST", gin.H{"code": "wrong-code", "state": state})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// try to login as an internal user via the provider
+	// should result in unauthorized
+	username = database.UserA.Username
+	state = startLogin()
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/oidc", "POST", gin.H{"code": "mock-code", "state": state})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// the metadata and the key set of the provider are cached
+	assert.Equal(t, int32(1), atomic.LoadInt32(&discoveries))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&keySetQueries))
+
+	// logins which expired can no longer be completed
+	state = startLogin()
+	assert.NoError(t, database.GetDB().Model(&database.OIDCLogin{}).UpdateColumn("expires_at", time.Now()).Error)
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/oidc", "POST", gin.H{"code": "mock-code", "state": state})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+}
+
+// mockLDAPServer is a minimal LDAP server serving a static directory
+type mockLDAPServer struct {
+	sync.Mutex
+	listener  net.Listener
+	passwords map[string]string
+	entries   map[string]map[string][]string
+}
+
+func newMockLDAPServer(t *testing.T) *mockLDAPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	s := &mockLDAPServer{
+		listener:  l,
+		passwords: map[string]string{},
+		entries:   map[string]map[string][]string{},
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *mockLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *mockLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	respond := func(id interface{}, op *ber.Packet) {
+		msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Message")
+		msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+		msg.AppendChild(op)
+		conn.Write(msg.Bytes())
+	}
+	result := func(tag ber.Tag, code int) *ber.Packet {
+		op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+		op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+		return op
+	}
+
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		id, op := msg.Children[0].Value, msg.Children[1]
+
+		s.Lock()
+		switch op.Tag {
+		case 0: // bind
+			dn, password := op.Children[1].Value.(string), op.Children[2].Data.String()
+			code := 49
+			if pw, ok := s.passwords[dn]; ok && pw == password {
+				code = 0
+			}
+			respond(id, result(1, code))
+		case 2: // unbind
+			s.Unlock()
+			return
+		case 3: // search
+			base, filter := op.Children[0].Value.(string), op.Children[6]
+			for dn, attrs := range s.entries {
+				if !strings.HasSuffix(dn, base) || !mockLDAPMatch(filter, attrs) {
+					continue
+				}
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, 4, nil, "Search Result Entry")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+				list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+				for name, values := range attrs {
+					attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+					attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+					set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+					for _, v := range values {
+						set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+					}
+					attr.AppendChild(set)
+					list.AppendChild(attr)
+				}
+				entry.AppendChild(list)
+				respond(id, entry)
+			}
+			respond(id, result(5, 0))
+		case 23: // extended request, e.g. StartTLS
+			respond(id, result(24, 2))
+		}
+		s.Unlock()
+	}
+}
+
+// mockLDAPMatch evaluates equality and present filters
+func mockLDAPMatch(filter *ber.Packet, attrs map[string][]string) bool {
+	switch filter.Tag {
+	case 3:
+		values := attrs[filter.Children[0].Value.(string)]
+		_, found := helper.Find(values, filter.Children[1].Value.(string))
+		return found
+	case 7:
+		_, found := attrs[filter.Data.String()]
+		return found
+	}
+	return false
+}
+
+func TestAuthenticateLDAP(t *testing.T) {
+
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	const userDN = "uid=ldapUser,ou=people,dc=test"
+	directory := newMockLDAPServer(t)
+	defer directory.listener.Close()
+	directory.passwords[userDN] = "ldap_pw"
+	directory.entries[userDN] = map[string][]string{"uid": {"ldapUser"}, "mail": {"ldapUser@ldap.test"}}
+	directory.entries["cn=staff,ou=groups,dc=test"] = map[string][]string{"cn": {"staff"}, "member": {userDN}}
+	directory.entries["cn=alumni,ou=groups,dc=test"] = map[string][]string{"cn": {"alumni"}}
+
+	// user groups matching the groups of the directory and a manually managed user group
+	db := database.GetDB()
+	so := database.Scenario{Name: "LDAP scenario"}
+	assert.NoError(t, db.Create(&so).Error)
+	staff := database.UserGroup{Name: "staff", ScenarioMappings: []database.ScenarioMapping{
+		{ScenarioID: so.ID, Role: database.ScenarioViewer},
+	}}
+	assert.NoError(t, db.Create(&staff).Error)
+	alumni := database.UserGroup{Name: "alumni"}
+	assert.NoError(t, db.Create(&alumni).Error)
+	manual := database.UserGroup{Name: "manual"}
+	assert.NoError(t, db.Create(&manual).Error)
+
+	userGroupNames := func(username string) []string {
+		var u database.User
+		assert.NoError(t, db.Find(&u, "username = ?", username).Error)
+		var groups []database.UserGroup
+		assert.NoError(t, db.Model(&u).Related(&groups, "UserGroups").Error)
+		var names []string
+		for _, g := range groups {
+			names = append(names, g.Name)
+		}
+		return names
+	}
+
+	// try to login while LDAP is disabled
+	// should result in bad request
+	credentials := database.Credentials{Username: "ldapUser", Password: "ldap_pw"}
+	code, resp, err := helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/ldap", "POST", credentials)
+	assert.NoError(t, err)
+	assert.Equalf(t, 400, code, "Response body: \n%v\n", resp)
+
+	t.Setenv("AUTH_LDAP_ENABLED", "true")
+	t.Setenv("AUTH_LDAP_URL", directory.URL())
+	t.Setenv("AUTH_LDAP_USER_BASE_DN", "ou=people,dc=test")
+	t.Setenv("AUTH_LDAP_GROUP_BASE_DN", "ou=groups,dc=test")
+
+	// try to login with a wrong password
+	// should result in unauthorized
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/ldap", "POST", database.Credentials{Username: "ldapUser", Password: "wrong_pw"})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// try to login as a user unknown to the directory
+	// should result in unauthorized
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/ldap", "POST", database.Credentials{Username: "nobody", Password: "ldap_pw"})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+
+	// login, the user is created and added to the user group staff
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/ldap", "POST", credentials)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	err = helper.CompareResponse(resp, helper.KeyModels{"user": map[string]interface{}{
+		"username": "ldapUser",
+		"mail":     "ldapUser@ldap.test",
+		"role":     "User",
+	}})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"staff"}, userGroupNames("ldapUser"))
+
+	// the scenario mapping of the user group staff was applied
+	var u database.User
+	assert.NoError(t, db.Find(&u, "username = ?", "ldapUser").Error)
+	membership, err := database.GetScenarioMembership(so.ID, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, database.ScenarioViewer, membership.Role)
+
+	// the user moves from staff to alumni in the directory and is added to a group manually
+	assert.NoError(t, db.Model(&manual).Association("Users").Append(&u).Error)
+	directory.Lock()
+	directory.entries["cn=staff,ou=groups,dc=test"]["member"] = nil
+	directory.entries["cn=alumni,ou=groups,dc=test"]["member"] = []string{userDN}
+	directory.Unlock()
+
+	// login again, the user groups are synced and the manual group is kept
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/ldap", "POST", credentials)
+	assert.NoError(t, err)
+	assert.Equalf(t, 200, code, "Response body: \n%v\n", resp)
+	assert.ElementsMatch(t, []string{"alumni", "manual"}, userGroupNames("ldapUser"))
+
+	// the user lost the access to the scenario of the user group staff
+	_, err = database.GetScenarioMembership(so.ID, u.ID)
+	assert.Error(t, err)
+
+	// try to login with StartTLS which is not supported by the directory
+	// should result in an internal server error instead of an unencrypted login
+	t.Setenv("AUTH_LDAP_START_TLS", "true")
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/ldap", "POST", credentials)
+	assert.NoError(t, err)
+	assert.Equalf(t, 500, code, "Response body: \n%v\n", resp)
+	t.Setenv("AUTH_LDAP_START_TLS", "false")
+
+	// try to login as an internal user via the directory
+	// should result in unauthorized
+	directory.Lock()
+	directory.passwords["uid=User_A,ou=people,dc=test"] = "ldap_pw"
+	directory.entries["uid=User_A,ou=people,dc=test"] = map[string][]string{"uid": {"User_A"}, "mail": {"a@ldap.test"}}
+	directory.Unlock()
+	code, resp, err = helper.TestEndpoint(router, "",
+		"/api/v2/authenticate/ldap", "POST", database.Credentials{Username: "User_A", Password: "ldap_pw"})
+	assert.NoError(t, err)
+	assert.Equalf(t, 401, code, "Response body: \n%v\n", resp)
+}
+
 func TestDeleteUser(t *testing.T) {
 
 	database.DropTables()
@@ -1564,3 +2150,35 @@ func addSignals(token string) error {
 
 	return err
 }
+
+func TestExternalUserScenarioRoles(t *testing.T) {
+	database.DropTables()
+	database.MigrateModels()
+	assert.NoError(t, database.AddTestUsers())
+
+	db := database.GetDB()
+	viewed := database.Scenario{Name: "Viewed"}
+	assert.NoError(t, db.Create(&viewed).Error)
+	owned := database.Scenario{Name: "Owned"}
+	assert.NoError(t, db.Create(&owned).Error)
+
+	groupMap := configuration.ScenarioGroupMap
+	defer func() { configuration.ScenarioGroupMap = groupMap }()
+	configuration.ScenarioGroupMap = map[string][]configuration.GroupedScenario{
+		"viewers": {{Scenario: int(viewed.ID), Role: database.ScenarioViewer}},
+		"owners":  {{Scenario: int(owned.ID)}},
+	}
+
+	// the external user is added to the scenarios of its groups with the roles of the groups
+	myUser, err := externalUser("external", "external@example.com", []string{"viewers", "owners"}, "admin")
+	assert.NoError(t, err)
+
+	membership, err := database.GetScenarioMembership(viewed.ID, myUser.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, database.ScenarioViewer, membership.Role)
+
+	// users are owners if no role is given
+	membership, err = database.GetScenarioMembership(owned.ID, myUser.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, database.ScenarioOwner, membership.Role)
+}
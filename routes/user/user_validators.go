@@ -30,6 +30,15 @@ type loginRequest struct {
 	Password string `form:"Password" validate:"required"`
 }
 
+type oidcLoginRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
 type validUpdatedRequest struct {
 	Username    string `form:"Username" validate:"omitempty,min=3"`
 	Password    string `form:"Password" validate:"omitempty,min=6"`
@@ -60,6 +69,18 @@ func (r *loginRequest) validate() error {
 	return errs
 }
 
+func (r *oidcLoginRequest) validate() error {
+	validate = validator.New()
+	errs := validate.Struct(r)
+	return errs
+}
+
+func (r *refreshRequest) validate() error {
+	validate = validator.New()
+	errs := validate.Struct(r)
+	return errs
+}
+
 func (r *updateUserRequest) validate() error {
 	validate = validator.New()
 	errs := validate.Struct(r)
@@ -87,6 +87,7 @@ func addUserGroup(c *gin.Context) {
 	// Save the new user group to the database
 	err := newUserGroup.save()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelUserGroup, newUserGroup.ID, 0, nil, newUserGroup.UserGroup)
 		c.JSON(http.StatusOK, gin.H{"usergroup": newUserGroup.UserGroup})
 	}
 }
@@ -130,6 +131,7 @@ func updateUserGroup(c *gin.Context) {
 	// update the user group in the database
 	err := oldUserGroup.update(updatedUserGroup, req.UserGroup.ScenarioMappings)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelUserGroup, oldUserGroup_r.ID, 0, oldUserGroup_r, updatedUserGroup.UserGroup)
 		c.JSON(http.StatusOK, gin.H{"usergroup": updatedUserGroup.UserGroup})
 	}
 }
@@ -236,6 +238,7 @@ func deleteUserGroup(c *gin.Context) {
 	// Try to remove user group
 	err = ug.remove()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelUserGroup, ug_r.ID, 0, ug_r, nil)
 		c.JSON(http.StatusOK, gin.H{"usergroup": ug})
 	}
 
@@ -322,16 +325,20 @@ func addUserToUserGroup(c *gin.Context) {
 
 		if sm.Duplicate {
 			// Duplicate scenario
-			user.DuplicateScenarioForUser(s, &u, "")
+			_, err = user.SubmitScenarioDuplication(s, &u, "")
+			if helper.DBError(c, err) {
+				return
+			}
 		} else {
 			// Add user to scenario
-			err = db.Model(&s).Association("Users").Append(&u).Error
+			err = database.AddScenarioMember(s.ID, u.ID, mappingRole(sm.Role))
 			if helper.DBError(c, err) {
 				return
 			}
 		}
 	}
 
+	database.Audit(c, database.Update, database.ModelUserGroup, ug.ID, 0, nil, gin.H{"addedUser": u.Username})
 	c.JSON(http.StatusOK, gin.H{"user": u})
 }
 
@@ -397,5 +404,6 @@ func deleteUserFromUserGroup(c *gin.Context) {
 	if helper.DBError(c, err) {
 		return
 	}
+	database.Audit(c, database.Update, database.ModelUserGroup, ug.ID, 0, nil, gin.H{"removedUser": u.Username})
 	c.JSON(http.StatusOK, gin.H{"usergroup": ug})
 }
@@ -84,13 +84,17 @@ func (ug *UserGroup) updateScenarioMappings(groupID uint, reqScenarioMappings []
 		if err != nil {
 			return err
 		}
+		role := mappingRole(reqMapping.Role)
 		if oldMapping, exists := oldMappingsMap[reqMapping.ScenarioID]; exists {
 			// Update
 			if oldMapping.Duplicate != reqMapping.Duplicate {
 				if reqMapping.Duplicate {
 					for _, u := range users {
 						user.RemoveAccess(&sc, &u, &ug.UserGroup)
-						user.DuplicateScenarioForUser(sc, &u, "")
+						_, err = user.SubmitScenarioDuplication(sc, &u, "")
+						if err != nil {
+							return err
+						}
 					}
 				} else {
 					for _, u := range users {
@@ -98,15 +102,24 @@ func (ug *UserGroup) updateScenarioMappings(groupID uint, reqScenarioMappings []
 						if err != nil {
 							return err
 						}
-						err = db.Model(&sc).Association("Users").Append(&u).Error
+						err = database.AddScenarioMember(sc.ID, u.ID, role)
 						if err != nil {
 							return err
 						}
 
 					}
 				}
+			} else if !reqMapping.Duplicate && oldMapping.Role != role {
+				// the role of the group in the scenario changed
+				for _, u := range users {
+					err = database.SetScenarioMember(sc.ID, u.ID, role)
+					if err != nil {
+						return err
+					}
+				}
 			}
 			oldMapping.Duplicate = reqMapping.Duplicate
+			oldMapping.Role = role
 			err = db.Save(&oldMapping).Error
 			if err != nil {
 				return err
@@ -118,15 +131,19 @@ func (ug *UserGroup) updateScenarioMappings(groupID uint, reqScenarioMappings []
 				ScenarioID:  reqMapping.ScenarioID,
 				UserGroupID: groupID,
 				Duplicate:   reqMapping.Duplicate,
+				Role:        role,
 			}
 
 			if reqMapping.Duplicate {
 				for _, u := range users {
-					user.DuplicateScenarioForUser(sc, &u, "")
+					_, err = user.SubmitScenarioDuplication(sc, &u, "")
+					if err != nil {
+						return err
+					}
 				}
 			} else {
 				for _, u := range users {
-					err = db.Model(&sc).Association("Users").Append(&u).Error
+					err = database.AddScenarioMember(sc.ID, u.ID, role)
 					if err != nil {
 						return err
 					}
@@ -0,0 +1,80 @@
+/**
+* This file is part of VILLASweb-backend-go
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*********************************************************************************/
+
+package usergroup
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
+	"github.com/jinzhu/gorm"
+)
+
+// SyncGroups creates the user groups of the map (e.g. read from the groups file) and replaces their
+// scenario mappings with those of the map, the members of the groups are added to or removed from
+// the scenarios accordingly; user groups which are not in the map are not changed
+func SyncGroups(groups map[string][]configuration.GroupedScenario) error {
+
+	names := make([]string, 0, len(groups))
+	mappings := map[string][]validUpdatedScenarioMapping{}
+	for name, scenarios := range groups {
+		for _, gs := range scenarios {
+			if gs.Scenario <= 0 {
+				return fmt.Errorf("invalid scenario ID %v of user group %v", gs.Scenario, name)
+			}
+			if gs.Role != "" && !database.IsScenarioRole(gs.Role) {
+				return fmt.Errorf("invalid role %v of user group %v in scenario %v", gs.Role, name, gs.Scenario)
+			}
+
+			mappings[name] = append(mappings[name], validUpdatedScenarioMapping{
+				ScenarioID: uint(gs.Scenario),
+				Duplicate:  gs.Duplicate,
+				Role:       gs.Role,
+			})
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	db := database.GetDB()
+	for _, name := range names {
+		var ug UserGroup
+		err := db.Find(&ug, "name = ?", name).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ug.Name = name
+			err = ug.save()
+			if err == nil {
+				log.Println("Created user group", name)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		err = ug.updateScenarioMappings(ug.ID, mappings[name])
+		if err != nil {
+			return fmt.Errorf("failed to update the scenario mappings of user group %v: %v", name, err)
+		}
+		log.Printf("Synchronized %d scenario mappings of user group %v\n", len(mappings[name]), name)
+	}
+
+	return nil
+}
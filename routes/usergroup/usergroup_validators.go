@@ -30,18 +30,20 @@ type validNewUserGroup struct {
 }
 
 type validNewScenarioMapping struct {
-	ScenarioID uint `form:"scenario_id" validate:"required"`
-	Duplicate  bool `form:"duplicate" validate:"omitempty"`
+	ScenarioID uint   `form:"scenario_id" validate:"required"`
+	Duplicate  bool   `form:"duplicate" validate:"omitempty"`
+	Role       string `form:"role" validate:"omitempty,oneof=owner editor viewer"`
 }
 
 type validUpdatedUserGroup struct {
 	Name             string                        `form:"name" validate:"omitempty"`
-	ScenarioMappings []validUpdatedScenarioMapping `form:"scenarioMappings" validate:"omitempty"`
+	ScenarioMappings []validUpdatedScenarioMapping `form:"scenarioMappings" validate:"omitempty,dive"`
 }
 
 type validUpdatedScenarioMapping struct {
-	ScenarioID uint `form:"scenarioID" validate:"omitempty"`
-	Duplicate  bool `form:"duplicate" validate:"omitempty"`
+	ScenarioID uint   `form:"scenarioID" validate:"omitempty"`
+	Duplicate  bool   `form:"duplicate" validate:"omitempty"`
+	Role       string `form:"role" validate:"omitempty,oneof=owner editor viewer"`
 }
 
 type addUserGroupRequest struct {
@@ -77,11 +79,21 @@ func convertScenarioMappings(validMappings []validNewScenarioMapping) []database
 		scenarioMappings[i] = database.ScenarioMapping{
 			ScenarioID: v.ScenarioID,
 			Duplicate:  v.Duplicate,
+			Role:       mappingRole(v.Role),
 		}
 	}
 	return scenarioMappings
 }
 
+// mappingRole returns the role of the users of a group in a mapped scenario,
+// users are owners of the scenario if no role is given
+func mappingRole(role string) string {
+	if role == "" {
+		return database.ScenarioOwner
+	}
+	return role
+}
+
 func (r *updateUserGroupRequest) updatedUserGroup(oldUserGroup UserGroup) UserGroup {
 	// Use the old UserGroup as a basis for the updated UserGroup `ug`
 	ug := oldUserGroup
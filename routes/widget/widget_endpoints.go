@@ -102,6 +102,7 @@ func addWidget(c *gin.Context) {
 
 	err := newWidget.addToDashboard()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Create, database.ModelWidget, newWidget.ID, database.ScenarioIDOfDashboard(newWidget.DashboardID), nil, newWidget.Widget)
 		c.JSON(http.StatusOK, gin.H{"widget": newWidget.Widget})
 	}
 
@@ -150,6 +151,7 @@ func updateWidget(c *gin.Context) {
 	// Update the widget in the DB
 	err := oldWidget.update(updatedWidget)
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Update, database.ModelWidget, oldWidget_r.ID, database.ScenarioIDOfDashboard(oldWidget_r.DashboardID), oldWidget_r, updatedWidget.Widget)
 		c.JSON(http.StatusOK, gin.H{"widget": updatedWidget.Widget})
 	}
 
@@ -203,6 +205,7 @@ func deleteWidget(c *gin.Context) {
 
 	err := w.delete()
 	if !helper.DBError(c, err) {
+		database.Audit(c, database.Delete, database.ModelWidget, w.ID, database.ScenarioIDOfDashboard(w.DashboardID), w.Widget, nil)
 		c.JSON(http.StatusOK, gin.H{"widget": w.Widget})
 	}
 
@@ -83,21 +83,9 @@ func (w *Widget) update(modifiedWidget Widget) error {
 
 func (w *Widget) delete() error {
 
+	// Delete Widget, the dashboard ID is kept to restore the widget from the trash
 	db := database.GetDB()
-	var dab database.Dashboard
-	err := db.Find(&dab, uint(w.DashboardID)).Error
-	if err != nil {
-		return err
-	}
-
-	// remove association between Dashboard and Widget
-	err = db.Model(&dab).Association("Widgets").Delete(w).Error
-	if err != nil {
-		return err
-	}
-
-	// Delete Widget
-	err = db.Delete(w).Error
+	err := db.Delete(w).Error
 
 	return err
 }
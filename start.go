@@ -17,18 +17,27 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/user"
 
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/commands"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/configuration"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/database"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/helper"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/jobs"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes"
 	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/healthz"
 	infrastructure_component "git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/infrastructure-component"
+	"git.rwth-aachen.de/acs/public/villas/web-backend-go/routes/trash"
 	"github.com/gin-gonic/gin"
 	"github.com/zpatrick/go-config"
 )
@@ -71,11 +80,25 @@ func addData(router *gin.Engine, cfg *config.Config) error {
 func main() {
 	log.Println("Starting VILLASweb-backend-go")
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [command]\n\n%s\n\nflags:\n", os.Args[0], commands.Usage)
+		flag.PrintDefaults()
+	}
+
 	err := configuration.InitConfig()
 	if err != nil {
 		log.Fatalf("Error during initialization of global configuration: %s, aborting.", err)
 	}
 
+	// Run an administrative command instead of the server (e.g. user reset-password)
+	if flag.NArg() > 0 {
+		err = commands.Run(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	dbClear, err := configuration.GlobalConfig.String("db.clear")
 	if err != nil {
 		log.Fatalf("Error reading db.clear parameter from global configuration: %s, aborting.", err)
@@ -93,6 +116,13 @@ func main() {
 	}
 	defer database.DBpool.Close()
 
+	// Start workers for asynchronous jobs
+	workers, err := configuration.GlobalConfig.Int("jobs.workers")
+	if err != nil {
+		log.Fatalf("Error reading jobs.workers parameter from global configuration: %s, aborting.", err)
+	}
+	jobs.Start(workers)
+
 	// Init endpoints
 	gin.SetMode(gin.ReleaseMode)
 
@@ -113,6 +143,9 @@ func main() {
 		infrastructure_component.SetAMQPSession(session) // IC needs to know the session to send amqp messages
 		user.SetAMQPSession(session)                     // User needs to know the session to duplicate ICs upon login
 
+		// send scheduled actions to ICs once they are due
+		infrastructure_component.ScheduleActions(time.Second)
+
 		// send Ping to all externally managed ICs
 		for {
 			if session.IsReady {
@@ -138,12 +171,50 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Stop background work and the server upon SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Update via external APIs of ICs (if not managed via AMQP)
 	intervalStr, _ := configuration.GlobalConfig.String("apiupdateinterval")
 	interval, _ := time.ParseDuration(intervalStr)
-	infrastructure_component.QueryICAPIs(interval)
+	pollWorkers, _ := configuration.GlobalConfig.Int("apiupdateworkers")
+	pollsDone := infrastructure_component.QueryICAPIs(ctx, interval, pollWorkers)
+
+	// Mark ICs as stale which did not send status updates for a while
+	infrastructure_component.DetectStaleICs(time.Minute)
+
+	// Delete the state history of ICs which is older than the retention time
+	infrastructure_component.PruneHistory(time.Hour)
+
+	// Permanently delete items which are in the trash for longer than the retention time
+	trash.PurgePeriodically(24 * time.Hour)
 
 	log.Println("Running...")
 	// Server at port 4000 to match frontend's redirect path
-	r.Run(":" + port)
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	server.RegisterOnShutdown(infrastructure_component.CloseStreams)
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Println("error shutting down server:", err)
+	}
+
+	select {
+	case <-pollsDone:
+	case <-shutdownCtx.Done():
+		log.Println("error shutting down: queries of IC APIs did not finish in time")
+	}
 }